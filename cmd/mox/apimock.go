@@ -0,0 +1,317 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MockRoutes generates a route for every operation of the spec. Each
+// route returns the lowest documented 2xx response, or the default
+// response, with the example given in the spec or one synthesized from
+// the response schema. Paths are prefixed with the prefix and the
+// Swagger 2 base path
+func (spec *OpenAPI) MockRoutes(prefix string) ([]RouteRequest, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	ret := []RouteRequest{}
+	// Literal paths go before templates, so they are matched first
+	for _, p := range spec.sortedPaths() {
+		for _, method := range httpMethods {
+			op := spec.Paths[p].Operation(method)
+			if op == nil {
+				continue
+			}
+			r := RouteRequest{Method: strings.ToUpper(method), Path: prefix + spec.fullPath(p), Return: spec.mockResponse(op)}
+			if _, err := r.BuildRoute(nil); err != nil {
+				return nil, err
+			}
+			ret = append(ret, r)
+		}
+	}
+	return ret, nil
+}
+
+// mockResponse returns the response of the route of an operation
+func (spec *OpenAPI) mockResponse(op *Operation) ReturnData {
+	status, code := 0, ""
+	for c := range op.Responses {
+		if s, err := strconv.Atoi(c); err == nil && s >= 200 && s < 300 && (status == 0 || s < status) {
+			status, code = s, c
+		}
+	}
+	if status == 0 {
+		if _, ok := op.Responses["default"]; ok {
+			code = "default"
+		}
+		status = http.StatusOK
+	}
+	ret := ReturnData{Status: status}
+	rsp := op.Responses[code]
+	if rsp == nil || status == http.StatusNoContent {
+		return ret
+	}
+	contentType, example, ok := spec.mockBody(rsp)
+	if !ok {
+		return ret
+	}
+	ret.Headers = Pairs{{Key: "Content-Type", Value: contentType}}
+	if s, isString := example.(string); isString && !strings.HasSuffix(contentType, "json") {
+		ret.Body = s
+	} else {
+		body, _ := json.MarshalIndent(example, "", "  ")
+		ret.Body = string(body)
+	}
+	return ret
+}
+
+// mockBody returns the content type and the example body of a
+// response. JSON is preferred if the response has several content
+// types
+func (spec *OpenAPI) mockBody(rsp *Response) (string, interface{}, bool) {
+	if rsp.Schema != nil || len(rsp.Examples) > 0 {
+		// Swagger 2
+		if x, ok := rsp.Examples["application/json"]; ok {
+			return "application/json", x, true
+		}
+		for _, t := range sortedKeys(rsp.Examples) {
+			return t, rsp.Examples[t], true
+		}
+		return "application/json", spec.Example(rsp.Schema, "", map[string]bool{}), true
+	}
+	types := make([]string, 0, len(rsp.Content))
+	for t := range rsp.Content {
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return "", nil, false
+	}
+	sort.Slice(types, func(i, j int) bool {
+		ji, jj := strings.HasSuffix(types[i], "json"), strings.HasSuffix(types[j], "json")
+		if ji != jj {
+			return ji
+		}
+		return types[i] < types[j]
+	})
+	mt := rsp.Content[types[0]]
+	if mt == nil {
+		return types[0], nil, false
+	}
+	if mt.Example != nil {
+		return types[0], mt.Example, true
+	}
+	names := make([]string, 0, len(mt.Examples))
+	for name := range mt.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if x := mt.Examples[name]; x != nil && x.Value != nil {
+			return types[0], x.Value, true
+		}
+	}
+	if mt.Schema == nil {
+		return types[0], nil, false
+	}
+	return types[0], spec.Example(mt.Schema, "", map[string]bool{}), true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Example returns the example of a schema, or synthesizes a value of
+// the schema type. name is the property name, used as the value of
+// plain strings. seen has the references being expanded, a recursive
+// reference gives nil
+func (spec *OpenAPI) Example(s *Schema, name string, seen map[string]bool) interface{} {
+	if s != nil && len(s.Ref) > 0 {
+		if seen[s.Ref] {
+			return nil
+		}
+		seen[s.Ref] = true
+		defer delete(seen, s.Ref)
+	}
+	s = spec.Resolve(s)
+	if s == nil {
+		return nil
+	}
+	if s.Example != nil {
+		return s.Example
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	if len(s.AllOf) > 0 {
+		obj := map[string]interface{}{}
+		for _, x := range s.AllOf {
+			if m, ok := spec.Example(x, name, seen).(map[string]interface{}); ok {
+				for k, v := range m {
+					obj[k] = v
+				}
+			}
+		}
+		return obj
+	}
+	if len(s.OneOf) > 0 {
+		return spec.Example(s.OneOf[0], name, seen)
+	}
+	if len(s.AnyOf) > 0 {
+		return spec.Example(s.AnyOf[0], name, seen)
+	}
+	switch {
+	case s.Type == "object" || (len(s.Type) == 0 && len(s.Properties) > 0):
+		obj := map[string]interface{}{}
+		for k, p := range s.Properties {
+			if v := spec.Example(p, k, seen); v != nil {
+				obj[k] = v
+			}
+		}
+		return obj
+	case s.Type == "array":
+		n := 1
+		if s.MinItems != nil && *s.MinItems > n {
+			n = *s.MinItems
+		}
+		if s.MaxItems != nil && *s.MaxItems < n {
+			n = *s.MaxItems
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = spec.Example(s.Items, name, seen)
+		}
+		return items
+	case s.Type == "integer":
+		return int(exampleNumber(s, 1))
+	case s.Type == "number":
+		return exampleNumber(s, 1.5)
+	case s.Type == "boolean":
+		return true
+	case s.Type == "string":
+		return exampleString(s, name)
+	}
+	return nil
+}
+
+// exampleNumber returns def if it is within the bounds of the schema,
+// or the nearest bound
+func exampleNumber(s *Schema, def float64) float64 {
+	if s.Minimum != nil && def < *s.Minimum {
+		def = *s.Minimum
+	}
+	if s.Maximum != nil && def > *s.Maximum {
+		def = *s.Maximum
+	}
+	return def
+}
+
+// exampleString returns an example for the format of a string schema,
+// or the property name
+func exampleString(s *Schema, name string) string {
+	switch s.Format {
+	case "date-time":
+		return "2017-01-01T00:00:00Z"
+	case "date":
+		return "2017-01-01"
+	case "time":
+		return "00:00:00Z"
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "http://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "127.0.0.1"
+	case "ipv6":
+		return "::1"
+	case "byte":
+		return "Ynl0ZXM="
+	}
+	if len(name) == 0 {
+		name = "string"
+	}
+	if s.MinLength != nil && len(name) < *s.MinLength {
+		name += strings.Repeat("x", *s.MinLength-len(name))
+	}
+	if s.MaxLength != nil && len(name) > *s.MaxLength {
+		name = name[:*s.MaxLength]
+	}
+	return name
+}
+
+// ImportOpenAPI adds the mock routes of a spec. source is the name of
+// the spec file if it is imported at startup, routes imported with
+// the admin API have no source, so they are persisted
+func (h *AdminHandler) ImportOpenAPI(spec *OpenAPI, prefix, source string) ([]RouteRequest, error) {
+	reqs, err := spec.MockRoutes(prefix)
+	if err != nil {
+		return nil, err
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	if err := h.addRoutes(withSource(reqs, source)); err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// ImportOpenAPIFile adds the mock routes of a spec file
+func (h *AdminHandler) ImportOpenAPIFile(name, prefix string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	spec, err := ParseOpenAPI(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	_, err = h.ImportOpenAPI(spec, prefix, name)
+	return err
+}
+
+// serveOpenAPIImport adds the mock routes of the posted spec. The
+// prefix query parameter is prepended to the paths
+func (h *AdminHandler) serveOpenAPIImport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	spec, err := ParseOpenAPI(request.Body)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	reqs, err := h.ImportOpenAPI(spec, request.URL.Query().Get("prefix"), "")
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	ret, _ := json.Marshal(reqs)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
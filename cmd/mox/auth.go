@@ -0,0 +1,194 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// AuthPreset enforces an authentication scheme on a route. Requests
+// without credentials get 401, requests with invalid credentials get
+// 403, except invalid bearer tokens, which get 401 (RFC 6750)
+type AuthPreset struct {
+	// Type is "apiKey", "bearer" or "hmac"
+	Type string `json:"type"`
+	// Header carries the credentials. Defaults to X-API-Key for
+	// apiKey, Authorization for bearer, and X-Signature for hmac
+	Header string `json:"header,omitempty"`
+	// Query carries the API key instead of a header
+	Query string `json:"query,omitempty"`
+	// Values are the accepted API keys or bearer tokens
+	Values []string `json:"values,omitempty"`
+	// Introspect accepts the bearer tokens issued by token routes
+	// that have not expired
+	Introspect bool `json:"introspect,omitempty"`
+	// Secret is the HMAC key
+	Secret string `json:"secret,omitempty"`
+	// Algorithm is the HMAC hash, sha256 (default) or sha1
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// Authentication preset types
+const (
+	AuthAPIKey = "apiKey"
+	AuthBearer = "bearer"
+	AuthHMAC   = "hmac"
+)
+
+// authError is the body of an authentication failure
+type authError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// Validate checks the preset definition
+func (a *AuthPreset) Validate() error {
+	switch a.Type {
+	case AuthAPIKey:
+		if len(a.Values) == 0 {
+			return errors.New("auth: " + a.Type + " needs values")
+		}
+	case AuthBearer:
+		if len(a.Values) == 0 && !a.Introspect {
+			return errors.New("auth: bearer needs values or introspect")
+		}
+	case AuthHMAC:
+		if len(a.Secret) == 0 {
+			return errors.New("auth: hmac needs a secret")
+		}
+		if len(a.Algorithm) > 0 && a.Algorithm != "sha256" && a.Algorithm != "sha1" {
+			return errors.New("auth: unknown hmac algorithm " + a.Algorithm)
+		}
+	default:
+		return errors.New("auth: unknown type " + a.Type)
+	}
+	return nil
+}
+
+func (a *AuthPreset) header() string {
+	if len(a.Header) > 0 {
+		return a.Header
+	}
+	switch a.Type {
+	case AuthBearer:
+		return "Authorization"
+	case AuthHMAC:
+		return "X-Signature"
+	}
+	return "X-API-Key"
+}
+
+func (a *AuthPreset) accepts(value string) bool {
+	for _, v := range a.Values {
+		if hmac.Equal([]byte(v), []byte(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsToken returns true if the bearer token is one of the values,
+// or an issued token if the preset introspects
+func (a *AuthPreset) acceptsToken(tokens *Tokens, token string) bool {
+	if a.accepts(token) {
+		return true
+	}
+	if !a.Introspect || tokens == nil {
+		return false
+	}
+	_, ok := tokens.Lookup(token)
+	return ok
+}
+
+// Check checks the credentials of the request. Bearer tokens are
+// looked up in tokens if the preset introspects. If the credentials
+// are missing or invalid, it writes the error response and returns
+// false
+func (a *AuthPreset) Check(tokens *Tokens, writer http.ResponseWriter, request *http.Request) bool {
+	switch a.Type {
+	case AuthAPIKey:
+		var key string
+		if len(a.Query) > 0 {
+			key = request.URL.Query().Get(a.Query)
+		} else {
+			key = request.Header.Get(a.header())
+		}
+		if len(key) == 0 {
+			return a.fail(writer, http.StatusUnauthorized, "unauthorized", "API key required")
+		}
+		if !a.accepts(key) {
+			return a.fail(writer, http.StatusForbidden, "forbidden", "invalid API key")
+		}
+	case AuthBearer:
+		value := request.Header.Get(a.header())
+		if len(value) < 7 || !strings.EqualFold(value[:7], "bearer ") {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="mox"`)
+			return a.fail(writer, http.StatusUnauthorized, "invalid_request", "bearer token required")
+		}
+		if !a.acceptsToken(tokens, strings.TrimSpace(value[7:])) {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="mox", error="invalid_token"`)
+			return a.fail(writer, http.StatusUnauthorized, "invalid_token", "the access token is invalid or expired")
+		}
+	case AuthHMAC:
+		sig := request.Header.Get(a.header())
+		if len(sig) == 0 {
+			return a.fail(writer, http.StatusUnauthorized, "unauthorized", "signature required")
+		}
+		body := captureBody(request)
+		if !a.validSignature(sig, body) {
+			return a.fail(writer, http.StatusForbidden, "forbidden", "invalid signature")
+		}
+	}
+	return true
+}
+
+// validSignature checks a hex or base64 HMAC of the body. The
+// signature may have an "algorithm=" prefix
+func (a *AuthPreset) validSignature(sig string, body []byte) bool {
+	var hf func() hash.Hash = sha256.New
+	if a.Algorithm == "sha1" {
+		hf = sha1.New
+	}
+	if eq := strings.Index(sig, "="); eq != -1 && eq < 8 {
+		sig = sig[eq+1:]
+	}
+	mac := hmac.New(hf, []byte(a.Secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	if got, err := hex.DecodeString(sig); err == nil && hmac.Equal(got, expected) {
+		return true
+	}
+	if got, err := base64.StdEncoding.DecodeString(sig); err == nil && hmac.Equal(got, expected) {
+		return true
+	}
+	return false
+}
+
+func (a *AuthPreset) fail(writer http.ResponseWriter, status int, code, msg string) bool {
+	data, _ := json.Marshal(authError{Error: code, Message: msg})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(data)
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Invalid TLS behaviors
+const (
+	BadTLSExpired    = "expired"
+	BadTLSSelfSigned = "self-signed"
+	BadTLSWrongHost  = "wrong-host"
+	BadTLSWeak       = "weak"
+)
+
+// BadTLSFlags maps SNI names to invalid TLS behaviors
+type BadTLSFlags map[string]string
+
+func (b *BadTLSFlags) String() string {
+	var s []string
+	for k, v := range *b {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set adds a name=behavior mapping. Names are stored in lower case,
+// as they are looked up
+func (b *BadTLSFlags) Set(value string) error {
+	eq := strings.Index(value, "=")
+	if eq <= 0 {
+		return errors.New("expecting name=behavior, got " + value)
+	}
+	switch value[eq+1:] {
+	case BadTLSExpired, BadTLSSelfSigned, BadTLSWrongHost, BadTLSWeak:
+	default:
+		return errors.New("unknown TLS behavior " + value[eq+1:])
+	}
+	if *b == nil {
+		*b = make(BadTLSFlags)
+	}
+	(*b)[strings.ToLower(value[:eq])] = value[eq+1:]
+	return nil
+}
+
+// badTLSConfig returns the certificate options and TLS configuration for a
+// behavior
+func badTLSConfig(behavior, name string) (CertOptions, *tls.Config) {
+	opt := CertOptions{Hosts: []string{name}}
+	config := &tls.Config{}
+	switch behavior {
+	case BadTLSExpired:
+		opt.NotBefore = time.Now().AddDate(-2, 0, 0)
+		opt.NotAfter = time.Now().AddDate(-1, 0, 0)
+	case BadTLSSelfSigned:
+		opt.SelfSigned = true
+	case BadTLSWrongHost:
+		opt.Hosts = []string{"wrong-host.invalid"}
+	case BadTLSWeak:
+		opt.RSABits = 1024
+		config.MinVersion = tls.VersionTLS10
+		config.MaxVersion = tls.VersionTLS10
+		config.CipherSuites = []uint16{tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, tls.TLS_RSA_WITH_RC4_128_SHA}
+	}
+	return opt, config
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestBadTLSFlags(t *testing.T) {
+	tests := []struct {
+		value string
+		name  string
+		err   bool
+	}{
+		{value: "api.test=expired", name: "api.test"},
+		{value: "API.Example.COM=weak", name: "api.example.com"},
+		{value: "=weak", err: true},
+		{value: "api.test", err: true},
+		{value: "api.test=broken", err: true},
+	}
+	for _, x := range tests {
+		var b BadTLSFlags
+		err := b.Set(x.value)
+		if x.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", x.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", x.value, err)
+			continue
+		}
+		if _, ok := b[x.name]; !ok || len(b) != 1 {
+			t.Errorf("%s: got %v", x.value, b)
+		}
+	}
+}
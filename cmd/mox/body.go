@@ -0,0 +1,231 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// BodyMatch restricts a route to requests whose body matches. All
+// given predicates must hold
+type BodyMatch struct {
+	// Equals is the exact body
+	Equals *string `json:"equals,omitempty"`
+	// Contains is a substring of the body
+	Contains string `json:"contains,omitempty"`
+	// Regex is a regular expression matching a part of the body
+	Regex string `json:"regex,omitempty"`
+}
+
+type (
+	// JSONBodyMatch restricts a route to requests with a JSON body.
+	// All given predicates must hold
+	JSONBodyMatch struct {
+		// Contains is a JSON value the body must contain. Object
+		// fields may be in any order and the body may have more
+		// fields, arrays are matched element by element
+		Contains json.RawMessage `json:"contains,omitempty"`
+		// Paths are predicates on values selected by JSONPath
+		Paths []JSONPathMatch `json:"paths,omitempty"`
+	}
+
+	// JSONPathMatch is a predicate on the value at a JSONPath. Without
+	// equals or regex, the value must exist
+	JSONPathMatch struct {
+		Path string `json:"path"`
+		// Equals is the JSON value, contained like JSONBodyMatch.Contains
+		Equals json.RawMessage `json:"equals,omitempty"`
+		// Regex matches a part of a string value, or of the JSON of
+		// other values
+		Regex string `json:"regex,omitempty"`
+		// Absent requires the path not to exist
+		Absent bool `json:"absent,omitempty"`
+	}
+)
+
+// Validate checks the regular expression
+func (b BodyMatch) Validate() error {
+	if b.Equals == nil && len(b.Contains) == 0 && len(b.Regex) == 0 {
+		return errors.New("body: equals, contains or regex required")
+	}
+	if len(b.Regex) > 0 {
+		if _, err := regexp.Compile(b.Regex); err != nil {
+			return errors.New("body: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// bodyMatcher matches requests whose body satisfies the predicates
+func bodyMatcher(b BodyMatch) func(*http.Request) bool {
+	var re *regexp.Regexp
+	if len(b.Regex) > 0 {
+		re = regexp.MustCompile(b.Regex)
+	}
+	return func(request *http.Request) bool {
+		body := captureBody(request)
+		if b.Equals != nil && string(body) != *b.Equals {
+			return false
+		}
+		if len(b.Contains) > 0 && !strings.Contains(string(body), b.Contains) {
+			return false
+		}
+		if re != nil && !re.Match(body) {
+			return false
+		}
+		return true
+	}
+}
+
+// bodyMatchEq returns true if the predicates are the same
+func bodyMatchEq(b1, b2 *BodyMatch) bool {
+	if b1 == nil || b2 == nil {
+		return b1 == b2
+	}
+	if (b1.Equals == nil) != (b2.Equals == nil) || (b1.Equals != nil && *b1.Equals != *b2.Equals) {
+		return false
+	}
+	return b1.Contains == b2.Contains && b1.Regex == b2.Regex
+}
+
+// Validate checks the JSON values, paths and regular expressions
+func (b JSONBodyMatch) Validate() error {
+	var v interface{}
+	if len(b.Contains) > 0 {
+		if err := json.Unmarshal(b.Contains, &v); err != nil {
+			return errors.New("jsonBody: contains: " + err.Error())
+		}
+	}
+	for _, p := range b.Paths {
+		if _, err := jsonPathPointer(p.Path); err != nil {
+			return errors.New("jsonBody: " + err.Error())
+		}
+		if len(p.Equals) > 0 {
+			if err := json.Unmarshal(p.Equals, &v); err != nil {
+				return errors.New("jsonBody: " + p.Path + ": " + err.Error())
+			}
+		}
+		if len(p.Regex) > 0 {
+			if _, err := regexp.Compile(p.Regex); err != nil {
+				return errors.New("jsonBody: " + p.Path + ": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// jsonBodyMatcher matches requests whose JSON body satisfies the
+// predicates
+func jsonBodyMatcher(b JSONBodyMatch) func(*http.Request) bool {
+	var contains interface{}
+	if len(b.Contains) > 0 {
+		json.Unmarshal(b.Contains, &contains)
+	}
+	type pathMatch struct {
+		JSONPathMatch
+		equals interface{}
+		re     *regexp.Regexp
+	}
+	paths := make([]pathMatch, len(b.Paths))
+	for i, p := range b.Paths {
+		paths[i].JSONPathMatch = p
+		if len(p.Equals) > 0 {
+			json.Unmarshal(p.Equals, &paths[i].equals)
+		}
+		if len(p.Regex) > 0 {
+			paths[i].re = regexp.MustCompile(p.Regex)
+		}
+	}
+	return func(request *http.Request) bool {
+		var doc interface{}
+		if err := json.Unmarshal(captureBody(request), &doc); err != nil {
+			return false
+		}
+		if contains != nil && !jsonContains(doc, contains) {
+			return false
+		}
+		for _, p := range paths {
+			v, err := jsonPathGet(doc, p.Path)
+			if p.Absent {
+				if err == nil {
+					return false
+				}
+				continue
+			}
+			if err != nil {
+				return false
+			}
+			if p.equals != nil && !jsonContains(v, p.equals) {
+				return false
+			}
+			if p.re != nil {
+				s, ok := v.(string)
+				if !ok {
+					data, _ := json.Marshal(v)
+					s = string(data)
+				}
+				if !p.re.MatchString(s) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+// jsonContains returns true if doc contains the pattern: objects have
+// at least the fields of the pattern, arrays have the same length and
+// contain the pattern elements in order, and other values are equal
+func jsonContains(doc, pattern interface{}) bool {
+	switch p := pattern.(type) {
+	case map[string]interface{}:
+		d, ok := doc.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, pv := range p {
+			dv, ok := d[k]
+			if !ok || !jsonContains(dv, pv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		d, ok := doc.([]interface{})
+		if !ok || len(d) != len(p) {
+			return false
+		}
+		for i := range p {
+			if !jsonContains(d[i], p[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(doc, pattern)
+}
+
+// jsonBodyMatchEq returns true if the predicates are the same
+func jsonBodyMatchEq(b1, b2 *JSONBodyMatch) bool {
+	if b1 == nil || b2 == nil {
+		return b1 == b2
+	}
+	return reflect.DeepEqual(b1, b2)
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// BodyFiles reads response bodies from files under a root
+	// directory. Files are read for every response, unless Cache is
+	// set. Cached files are read again when they change
+	BodyFiles struct {
+		sync.Mutex
+		Root  string
+		Cache bool
+		files map[string]cachedFile
+	}
+
+	cachedFile struct {
+		modTime time.Time
+		size    int64
+		data    string
+	}
+)
+
+// bodyFiles are the body files under -files
+var bodyFiles = &BodyFiles{Root: "."}
+
+// path returns the file name of a body file, which must be a relative
+// name under the root
+func (f *BodyFiles) path(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("bodyFile: not under the files root: " + name)
+	}
+	return filepath.Join(f.Root, clean), nil
+}
+
+// Validate checks that the body file exists
+func (f *BodyFiles) Validate(name string) error {
+	file, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return errors.New("bodyFile: " + err.Error())
+	}
+	if info.IsDir() {
+		return errors.New("bodyFile: is a directory: " + name)
+	}
+	return nil
+}
+
+// Read returns the contents of a body file
+func (f *BodyFiles) Read(name string) (string, error) {
+	file, err := f.path(name)
+	if err != nil {
+		return "", err
+	}
+	if !f.Cache {
+		data, err := ioutil.ReadFile(file)
+		return string(data), err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if c, ok := f.files[file]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.data, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if f.files == nil {
+		f.files = make(map[string]cachedFile)
+	}
+	f.files[file] = cachedFile{modTime: info.ModTime(), size: info.Size(), data: string(data)}
+	return string(data), nil
+}
+
+// inline returns the response with the body read from its body file,
+// and a Content-Type from the file extension if it has none
+func (f *BodyFiles) inline(ret ReturnData) (ReturnData, error) {
+	if len(ret.BodyFile) == 0 {
+		return ret, nil
+	}
+	body, err := f.Read(ret.BodyFile)
+	if err != nil {
+		return ret, err
+	}
+	ret.Body = body
+	if _, ok := ret.Headers.headerValue("Content-Type"); !ok {
+		if ctype := mime.TypeByExtension(filepath.Ext(ret.BodyFile)); len(ctype) > 0 {
+			ret.Headers = append(append(Pairs(nil), ret.Headers...), Pair{Key: "Content-Type", Value: ctype})
+		}
+	}
+	ret.BodyFile = ""
+	return ret, nil
+}
+
+// withBodyFile returns the response with its body file inlined. A file
+// that cannot be read gives a 500
+func (ret ReturnData) withBodyFile() ReturnData {
+	r, err := bodyFiles.inline(ret)
+	if err != nil {
+		fmt.Println(err)
+		return ReturnData{Status: http.StatusInternalServerError, Body: "bodyFile: " + err.Error()}
+	}
+	return r
+}
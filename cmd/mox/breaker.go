@@ -0,0 +1,97 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type (
+	// Breaker emulates an upstream with its own circuit breaker.
+	// After Failures consecutive 5xx responses the breaker opens, and
+	// requests fail fast with 503 for Cooldown. Then it half-opens:
+	// one trial request is served, and its response closes the
+	// breaker or opens it again
+	Breaker struct {
+		Failures int    `json:"failures"`
+		Cooldown string `json:"cooldown"`
+	}
+
+	// breakerState is the state of a breaker
+	breakerState struct {
+		failures  int
+		openUntil time.Time
+		trial     bool
+	}
+)
+
+// Validate checks the breaker definition
+func (b *Breaker) Validate() error {
+	if b.Failures <= 0 {
+		return errors.New("breaker: failures must be positive")
+	}
+	if d, err := time.ParseDuration(b.Cooldown); err != nil || d <= 0 {
+		return errors.New("breaker: cooldown must be a positive duration")
+	}
+	return nil
+}
+
+// Allow returns true if the breaker kept in the route state lets the
+// request through. If it does not, it writes a 503 response
+func (b *Breaker) Allow(st *RouteState, writer http.ResponseWriter) bool {
+	now := time.Now()
+	st.Lock()
+	bs := &st.breaker
+	ok := true
+	switch {
+	case bs.openUntil.IsZero():
+	case now.Before(bs.openUntil) || bs.trial:
+		ok = false
+	default:
+		bs.trial = true
+	}
+	wait := bs.openUntil.Sub(now)
+	st.Unlock()
+	if ok {
+		return true
+	}
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+	data, _ := json.Marshal(authError{Error: "circuit_open", Message: "circuit breaker is open"})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusServiceUnavailable)
+	writer.Write(data)
+	return false
+}
+
+// Record records the status of a response the breaker let through
+func (b *Breaker) Record(st *RouteState, status int) {
+	cooldown, _ := time.ParseDuration(b.Cooldown)
+	st.Lock()
+	defer st.Unlock()
+	bs := &st.breaker
+	if status < 500 {
+		*bs = breakerState{}
+		return
+	}
+	bs.failures++
+	if bs.trial || bs.failures >= b.Failures {
+		*bs = breakerState{openUntil: time.Now().Add(cooldown)}
+	}
+}
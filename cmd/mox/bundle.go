@@ -0,0 +1,200 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isBundle returns true if the file is a gzipped tar bundle
+func isBundle(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// bundleFiles is the directory of the body files in exported bundles
+const bundleFiles = "files"
+
+// readBundle reads the stub files of a gzipped tar bundle. Stub files
+// are at the top of the bundle and are read in name order, and
+// subdirectories may hold the files they refer to. Body files are
+// relative to the bundle, and are inlined as the bundle is removed
+// once it is read
+func readBundle(name string) ([]RouteRequest, error) {
+	dir, err := ioutil.TempDir("", "mox-bundle")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := extractBundle(name, dir); err != nil {
+		return nil, errors.New(name + ": " + err.Error())
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && isStubFile(f.Name()) {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	var reqs []RouteRequest
+	for _, n := range names {
+		r, err := ReadStubFile(filepath.Join(dir, n))
+		if err != nil {
+			return nil, errors.New(name + ": " + strings.TrimPrefix(err.Error(), dir+string(filepath.Separator)))
+		}
+		reqs = append(reqs, r...)
+	}
+	bodies := &BodyFiles{Root: dir}
+	for i := range reqs {
+		if reqs[i], err = reqs[i].mapResponses(bodies.inline); err != nil {
+			return nil, errors.New(name + ": " + strings.Replace(err.Error(), dir+string(filepath.Separator), "", -1))
+		}
+	}
+	return reqs, nil
+}
+
+// isStubFile returns true for the file types LoadFile accepts
+func isStubFile(name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml", ".mox", ".cue", ".har":
+		return true
+	}
+	return false
+}
+
+// extractBundle extracts the regular files of a gzipped tar into dir.
+// Entries outside dir are rejected
+func extractBundle(name, dir string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	rd := tar.NewReader(gz)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		clean := path.Clean("/" + hdr.Name)
+		if clean == "/" {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(clean[1:]))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, rd)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// serveExport returns the routes as a gzipped JSON file, or as a
+// gzipped tar bundle with format=tar.gz. The bundle has the body files
+// of the routes under files/
+func (h *AdminHandler) serveExport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	routes := h.GetRoutes()
+	tarball := request.URL.Query().Get("format") == "tar.gz"
+	files := make(map[string]string)
+	if tarball {
+		for i := range routes {
+			var err error
+			routes[i], err = routes[i].mapResponses(func(ret ReturnData) (ReturnData, error) {
+				if len(ret.BodyFile) == 0 {
+					return ret, nil
+				}
+				name := path.Join(bundleFiles, filepath.ToSlash(filepath.Clean(filepath.FromSlash(ret.BodyFile))))
+				if _, ok := files[name]; !ok {
+					data, err := bodyFiles.Read(ret.BodyFile)
+					if err != nil {
+						return ret, err
+					}
+					files[name] = data
+				}
+				ret.BodyFile = name
+				return ret, nil
+			})
+			if err != nil {
+				writeError(writer, err)
+				return
+			}
+		}
+	}
+	data, _ := json.MarshalIndent(routes, "", "    ")
+	writer.Header().Set("Content-Type", "application/gzip")
+	if tarball {
+		writer.Header().Set("Content-Disposition", `attachment; filename="routes.tar.gz"`)
+	} else {
+		writer.Header().Set("Content-Disposition", `attachment; filename="routes.json.gz"`)
+	}
+	gz := gzip.NewWriter(writer)
+	defer gz.Close()
+	if !tarball {
+		gz.Write(data)
+		return
+	}
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+	now := time.Now()
+	tw.WriteHeader(&tar.Header{Name: "routes.json", Mode: 0644, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg})
+	tw.Write(data)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), ModTime: now, Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[name]))
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBundle writes a gzipped tar of the files
+func writeBundle(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for n, data := range files {
+		tw.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	gz.Close()
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withFilesRoot sets the body files root for a test
+func withFilesRoot(t *testing.T, root string) {
+	old := bodyFiles.Root
+	bodyFiles.Root = root
+	t.Cleanup(func() { bodyFiles.Root = old })
+}
+
+func TestReadBundleBodyFiles(t *testing.T) {
+	dir := t.TempDir()
+	withFilesRoot(t, t.TempDir())
+	name := filepath.Join(dir, "suite.tar.gz")
+	writeBundle(t, name, map[string]string{
+		"routes.json":      `[{"method": "GET", "path": "/u", "return": {"status": 200, "bodyFile": "bodies/user.json"}}]`,
+		"bodies/user.json": `{"name": "x"}`,
+	})
+	reqs, err := readBundle(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 1 {
+		t.Fatalf("got %d routes", len(reqs))
+	}
+	ret := reqs[0].Return
+	if ret.Body != `{"name": "x"}` || len(ret.BodyFile) != 0 {
+		t.Errorf("body file not inlined: %+v", ret)
+	}
+	if v, _ := ret.Headers.headerValue("Content-Type"); v != "application/json" {
+		t.Errorf("content type: %q", v)
+	}
+
+	writeBundle(t, name, map[string]string{
+		"routes.json": `[{"method": "GET", "path": "/u", "return": {"bodyFile": "missing.json"}}]`,
+	})
+	if _, err := readBundle(name); err == nil {
+		t.Errorf("expected an error for a missing body file")
+	}
+}
+
+func TestExportBundleBodyFiles(t *testing.T) {
+	root := t.TempDir()
+	withFilesRoot(t, root)
+	if err := os.MkdirAll(filepath.Join(root, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(root, "b", "one.txt"), []byte("one"), 0644)
+	a := newTestAdmin(t,
+		RouteRequest{Method: "GET", Path: "/one", Return: ReturnData{Status: http.StatusOK, BodyFile: "b/one.txt"}},
+		RouteRequest{Method: "GET", Path: "/seq", Sequence: []ReturnData{{Status: http.StatusOK, BodyFile: "b/one.txt"}, {Status: http.StatusOK, Body: "two"}}},
+	)
+	rec := httptest.NewRecorder()
+	a.serveExport(rec, httptest.NewRequest("GET", "/export?format=tar.gz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", rec.Code, rec.Body.String())
+	}
+	if a.Routes[0].Return.BodyFile != "b/one.txt" {
+		t.Errorf("export changed the route: %+v", a.Routes[0].Return)
+	}
+	name := filepath.Join(t.TempDir(), "export.tar.gz")
+	ioutil.WriteFile(name, rec.Body.Bytes(), 0644)
+
+	// The exported bundle does not need the files root
+	withFilesRoot(t, t.TempDir())
+	reqs, err := readBundle(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 || reqs[0].Return.Body != "one" || reqs[1].Sequence[0].Body != "one" || reqs[1].Sequence[1].Body != "two" {
+		t.Errorf("got %+v", reqs)
+	}
+}
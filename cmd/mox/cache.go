@@ -0,0 +1,196 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl emits a coherent set of caching headers for a route and
+// answers conditional requests with 304. ETags are computed from the
+// response body, so they change when the response changes
+type CacheControl struct {
+	// Preset is one of "immutable", "revalidate", "private" or
+	// "noStore". Other fields override the preset
+	Preset               string   `json:"preset,omitempty"`
+	MaxAge               *int     `json:"maxAge,omitempty"`
+	SharedMaxAge         *int     `json:"sMaxAge,omitempty"`
+	StaleWhileRevalidate int      `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         int      `json:"staleIfError,omitempty"`
+	Private              bool     `json:"private,omitempty"`
+	NoCache              bool     `json:"noCache,omitempty"`
+	NoStore              bool     `json:"noStore,omitempty"`
+	MustRevalidate       bool     `json:"mustRevalidate,omitempty"`
+	Immutable            bool     `json:"immutable,omitempty"`
+	Vary                 []string `json:"vary,omitempty"`
+	// ETag adds an ETag computed from the body
+	ETag bool `json:"etag,omitempty"`
+	// LastModified is an RFC 3339 time sent as Last-Modified
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func intp(i int) *int { return &i }
+
+// cachePresets are the predefined caching behaviors
+var cachePresets = map[string]CacheControl{
+	"immutable":  {MaxAge: intp(31536000), Immutable: true, ETag: true},
+	"revalidate": {MaxAge: intp(0), NoCache: true, ETag: true},
+	"private":    {MaxAge: intp(0), Private: true, MustRevalidate: true, ETag: true},
+	"noStore":    {NoStore: true},
+}
+
+// Validate checks the preset and Last-Modified time
+func (c *CacheControl) Validate() error {
+	if len(c.Preset) > 0 {
+		if _, ok := cachePresets[c.Preset]; !ok {
+			return errors.New("cache: unknown preset " + c.Preset)
+		}
+	}
+	if len(c.LastModified) > 0 {
+		if _, err := time.Parse(time.RFC3339, c.LastModified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the settings with the preset applied
+func (c *CacheControl) resolve() CacheControl {
+	p, ok := cachePresets[c.Preset]
+	if !ok {
+		return *c
+	}
+	if c.MaxAge != nil {
+		p.MaxAge = c.MaxAge
+	}
+	if c.SharedMaxAge != nil {
+		p.SharedMaxAge = c.SharedMaxAge
+	}
+	if c.StaleWhileRevalidate > 0 {
+		p.StaleWhileRevalidate = c.StaleWhileRevalidate
+	}
+	if c.StaleIfError > 0 {
+		p.StaleIfError = c.StaleIfError
+	}
+	p.Private = p.Private || c.Private
+	p.NoCache = p.NoCache || c.NoCache
+	p.NoStore = p.NoStore || c.NoStore
+	p.MustRevalidate = p.MustRevalidate || c.MustRevalidate
+	p.Immutable = p.Immutable || c.Immutable
+	p.ETag = p.ETag || c.ETag
+	p.Vary = append(p.Vary, c.Vary...)
+	if len(c.LastModified) > 0 {
+		p.LastModified = c.LastModified
+	}
+	return p
+}
+
+// header returns the Cache-Control header value
+func (c CacheControl) header() string {
+	var d []string
+	if c.NoStore {
+		d = append(d, "no-store")
+	}
+	if c.Private {
+		d = append(d, "private")
+	} else if c.MaxAge != nil || c.SharedMaxAge != nil {
+		d = append(d, "public")
+	}
+	if c.NoCache {
+		d = append(d, "no-cache")
+	}
+	if c.MaxAge != nil {
+		d = append(d, "max-age="+strconv.Itoa(*c.MaxAge))
+	}
+	if c.SharedMaxAge != nil {
+		d = append(d, "s-maxage="+strconv.Itoa(*c.SharedMaxAge))
+	}
+	if c.StaleWhileRevalidate > 0 {
+		d = append(d, "stale-while-revalidate="+strconv.Itoa(c.StaleWhileRevalidate))
+	}
+	if c.StaleIfError > 0 {
+		d = append(d, "stale-if-error="+strconv.Itoa(c.StaleIfError))
+	}
+	if c.MustRevalidate {
+		d = append(d, "must-revalidate")
+	}
+	if c.Immutable {
+		d = append(d, "immutable")
+	}
+	return strings.Join(d, ", ")
+}
+
+// BodyETag returns a strong ETag for the body
+func BodyETag(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches checks an If-None-Match header against the ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply adds caching headers to the response. If the request is a
+// conditional request the response satisfies, it returns a 304
+// response instead
+func (c *CacheControl) Apply(request *http.Request, ret ReturnData) ReturnData {
+	cc := c.resolve()
+	headers := append(Pairs(nil), ret.Headers...)
+	if h := cc.header(); len(h) > 0 {
+		headers = append(headers, Pair{Key: "Cache-Control", Value: h})
+	}
+	if len(cc.Vary) > 0 {
+		headers = append(headers, Pair{Key: "Vary", Value: strings.Join(cc.Vary, ", ")})
+	}
+	notModified := false
+	etag := ""
+	if cc.ETag {
+		var ok bool
+		if etag, ok = ret.Headers.headerValue("ETag"); !ok {
+			etag = BodyETag(ret.Body)
+			headers = append(headers, Pair{Key: "ETag", Value: etag})
+		}
+		if inm := request.Header.Get("If-None-Match"); len(inm) > 0 {
+			notModified = etagMatches(inm, etag)
+		}
+	}
+	if lm, err := time.Parse(time.RFC3339, cc.LastModified); err == nil {
+		headers = append(headers, Pair{Key: "Last-Modified", Value: lm.UTC().Format(http.TimeFormat)})
+		if len(request.Header.Get("If-None-Match")) == 0 {
+			if ims, err := http.ParseTime(request.Header.Get("If-Modified-Since")); err == nil {
+				notModified = !lm.Truncate(time.Second).After(ims)
+			}
+		}
+	}
+	ret.Headers = headers
+	if notModified && (request.Method == http.MethodGet || request.Method == http.MethodHead) {
+		ret.Status = http.StatusNotModified
+		ret.Body = ""
+	}
+	return ret
+}
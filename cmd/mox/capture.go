@@ -0,0 +1,206 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// Capture stores a value of the request in a variable. Exactly
+	// one of PathVar, Header, Query and JSONPath gives the value
+	Capture struct {
+		// Name is the variable name
+		Name     string `json:"name"`
+		PathVar  string `json:"pathVar,omitempty"`
+		Header   string `json:"header,omitempty"`
+		Query    string `json:"query,omitempty"`
+		JSONPath string `json:"jsonPath,omitempty"`
+	}
+
+	// Variables are the values captured from requests, shared by all
+	// routes
+	Variables struct {
+		sync.Mutex
+		values map[string]string
+	}
+)
+
+// Validate checks the capture rule
+func (c Capture) Validate() error {
+	if len(c.Name) == 0 {
+		return errors.New("capture: name required")
+	}
+	n := 0
+	for _, s := range []string{c.PathVar, c.Header, c.Query, c.JSONPath} {
+		if len(s) > 0 {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("capture " + c.Name + ": one of pathVar, header, query or jsonPath required")
+	}
+	if len(c.JSONPath) > 0 {
+		if _, err := jsonPathPointer(c.JSONPath); err != nil {
+			return errors.New("capture " + c.Name + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// value returns the captured value of the request, false if the
+// request does not have it
+func (c Capture) value(request *http.Request) (string, bool) {
+	switch {
+	case len(c.PathVar) > 0:
+		v, ok := mux.Vars(request)[c.PathVar]
+		return v, ok
+	case len(c.Header) > 0:
+		v := request.Header.Get(c.Header)
+		return v, len(v) > 0
+	case len(c.Query) > 0:
+		v, ok := request.URL.Query()[c.Query]
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		return v[0], true
+	}
+	var doc interface{}
+	if err := json.Unmarshal(captureBody(request), &doc); err != nil {
+		return "", false
+	}
+	v, err := jsonPathGet(doc, c.JSONPath)
+	if err != nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	data, _ := json.Marshal(v)
+	return string(data), true
+}
+
+// jsonPathPointer converts a JSONPath with member names and array
+// indexes, like $.items[0].id, to a JSON pointer
+func jsonPathPointer(path string) (string, error) {
+	p := strings.TrimPrefix(path, "$")
+	ptr := ""
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			end := strings.IndexAny(p[1:], ".[")
+			if end == -1 {
+				end = len(p) - 1
+			}
+			if end == 0 {
+				return "", errors.New("invalid JSONPath " + path)
+			}
+			ptr += "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(p[1:end+1])
+			p = p[end+1:]
+		case '[':
+			end := strings.Index(p, "]")
+			if end < 2 {
+				return "", errors.New("invalid JSONPath " + path)
+			}
+			ptr += "/" + strings.Trim(p[1:end], `'"`)
+			p = p[end+1:]
+		default:
+			return "", errors.New("invalid JSONPath " + path)
+		}
+	}
+	return ptr, nil
+}
+
+// jsonPathGet returns the value at the JSONPath in the document
+func jsonPathGet(doc interface{}, path string) (interface{}, error) {
+	ptr, err := jsonPathPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	return pointerGet(doc, ptr)
+}
+
+// Capture stores the values of the capture rules from the request
+func (v *Variables) Capture(rules []Capture, request *http.Request) {
+	for _, c := range rules {
+		if value, ok := c.value(request); ok {
+			v.Set(c.Name, value)
+		}
+	}
+}
+
+// Set sets a variable
+func (v *Variables) Set(name, value string) {
+	v.Lock()
+	defer v.Unlock()
+	if v.values == nil {
+		v.values = make(map[string]string)
+	}
+	v.values[name] = value
+}
+
+// Get returns a variable, false if it is not set
+func (v *Variables) Get(name string) (string, bool) {
+	v.Lock()
+	defer v.Unlock()
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// All returns a copy of the variables
+func (v *Variables) All() map[string]string {
+	v.Lock()
+	defer v.Unlock()
+	ret := make(map[string]string, len(v.values))
+	for k, x := range v.values {
+		ret[k] = x
+	}
+	return ret
+}
+
+// Reset clears all variables
+func (v *Variables) Reset() {
+	v.Lock()
+	v.values = nil
+	v.Unlock()
+}
+
+func (h *AdminHandler) serveVars(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ret, _ := json.Marshal(h.M.Vars.All())
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+// varsMatcher matches requests when the variables have the values
+func varsMatcher(vars *Variables, want Pairs) func(*http.Request) bool {
+	return func(*http.Request) bool {
+		for _, p := range want {
+			if v, ok := vars.Get(p.Key); !ok || v != p.Value {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// Cassettes are per-test recording files in a directory. Requests
+	// no route matches are replayed from the routes of the active
+	// cassette, or of the cassette named by the cassette header of
+	// the request. The proxy records the requests a cassette misses
+	// into it, and they are replayed from then on. Ordered cassettes
+	// replay their interactions in the recorded order
+	Cassettes struct {
+		sync.Mutex
+		// Dir is the directory of the cassette files, empty if
+		// cassettes are not used
+		Dir string
+		// Header is the request header naming the cassette of the
+		// request, instead of the active one
+		Header string
+		// Ordered replays all cassettes in order
+		Ordered       bool
+		active        string
+		activeOrdered bool
+		loaded        map[string]*cassette
+		failures      []ReplayFailure
+		// m serves the cassette routes
+		m *MockHandler
+	}
+
+	// cassette is a loaded cassette file
+	cassette struct {
+		routes []RouteRequest
+		router *mux.Router
+		// steps match the routes one by one in ordered replay
+		steps   []*mux.Router
+		ordered bool
+		// next is the index of the next route in ordered replay
+		next int
+	}
+
+	// CassetteRequest selects the active cassette. If Ordered is
+	// true, it is replayed in order
+	CassetteRequest struct {
+		Name    string `json:"name"`
+		Ordered bool   `json:"ordered,omitempty"`
+	}
+
+	// CassetteStatus is the active cassette and the cassettes in the
+	// directory
+	CassetteStatus struct {
+		Active    string   `json:"active"`
+		Ordered   bool     `json:"ordered,omitempty"`
+		Cassettes []string `json:"cassettes"`
+		// Failures are the requests ordered replay rejected
+		Failures []ReplayFailure `json:"failures,omitempty"`
+	}
+
+	// ReplayFailure is a request that was not the next interaction of
+	// an ordered cassette
+	ReplayFailure struct {
+		Cassette string `json:"cassette"`
+		// Expected is the next route of the cassette, empty if all
+		// were replayed
+		Expected string    `json:"expected,omitempty"`
+		Method   string    `json:"method"`
+		Path     string    `json:"path"`
+		Time     time.Time `json:"time"`
+		// Test is the correlation id of the request
+		Test string `json:"test,omitempty"`
+	}
+)
+
+var cassetteName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// validCassette checks a cassette name, which becomes a file name
+func validCassette(name string) error {
+	if !cassetteName.MatchString(name) {
+		return errors.New("cassette: invalid name: " + name)
+	}
+	return nil
+}
+
+// file returns the file of the named cassette
+func (c *Cassettes) file(name string) string {
+	return filepath.Join(c.Dir, name+".json")
+}
+
+// name returns the cassette of the request, empty if there is none
+func (c *Cassettes) name(request *http.Request) string {
+	if len(c.Dir) == 0 {
+		return ""
+	}
+	if len(c.Header) > 0 {
+		if name := request.Header.Get(c.Header); len(name) > 0 {
+			if validCassette(name) != nil {
+				return ""
+			}
+			return name
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.active
+}
+
+// get returns the named cassette, reading its file the first time.
+// The caller holds the lock
+func (c *Cassettes) get(name string) (*cassette, error) {
+	if cs, ok := c.loaded[name]; ok {
+		return cs, nil
+	}
+	cs := &cassette{ordered: c.Ordered || (name == c.active && c.activeOrdered)}
+	if _, err := os.Stat(c.file(name)); err == nil {
+		if cs.routes, err = ReadStubFile(c.file(name)); err != nil {
+			return nil, err
+		}
+	}
+	if err := cs.build(c.m); err != nil {
+		return nil, err
+	}
+	if c.loaded == nil {
+		c.loaded = make(map[string]*cassette)
+	}
+	c.loaded[name] = cs
+	return cs, nil
+}
+
+// build builds the router of the cassette routes
+func (cs *cassette) build(m *MockHandler) error {
+	router := mux.NewRouter()
+	steps := make([]*mux.Router, len(cs.routes))
+	for i, r := range cs.routes {
+		route, err := r.BuildRoute(router)
+		if err != nil {
+			return err
+		}
+		handler := NewMockReqHandler(r, m)
+		route.Handler(handler)
+		steps[i] = mux.NewRouter()
+		route, _ = r.BuildRoute(steps[i])
+		route.Handler(handler)
+	}
+	cs.router, cs.steps = router, steps
+	return nil
+}
+
+// Serve replays the request from its cassette. It returns false if
+// the request has no cassette, or the cassette has no route for it.
+// An ordered cassette only replays its next route, and a request
+// that does not match it fails with 501. Once all are replayed,
+// requests are recorded if there is a proxy, and fail otherwise
+func (c *Cassettes) Serve(writer http.ResponseWriter, request *http.Request, test string) bool {
+	name := c.name(request)
+	if len(name) == 0 {
+		return false
+	}
+	c.Lock()
+	cs, err := c.get(name)
+	if err != nil {
+		c.Unlock()
+		fmt.Println("mox:", err)
+		return false
+	}
+	if !cs.ordered {
+		c.Unlock()
+		var match mux.RouteMatch
+		if !cs.router.Match(request, &match) || match.MatchErr != nil {
+			return false
+		}
+		cs.router.ServeHTTP(writer, request)
+		return true
+	}
+	if cs.next == len(cs.routes) && c.m.Proxy != nil {
+		c.Unlock()
+		return false
+	}
+	var step *mux.Router
+	failure := ReplayFailure{Cassette: name, Method: request.Method, Path: request.URL.Path, Time: time.Now(), Test: test}
+	if cs.next < len(cs.routes) {
+		failure.Expected = cs.routes[cs.next].Name()
+		var match mux.RouteMatch
+		if cs.steps[cs.next].Match(request, &match) && match.MatchErr == nil {
+			step = cs.steps[cs.next]
+			cs.next++
+		}
+	}
+	if step == nil {
+		c.failures = append(c.failures, failure)
+	}
+	c.Unlock()
+	if step != nil {
+		step.ServeHTTP(writer, request)
+		return true
+	}
+	writer.WriteHeader(http.StatusNotImplemented)
+	if len(failure.Expected) == 0 {
+		fmt.Fprintf(writer, "mox: cassette %s: all interactions were replayed, got %s %s\n", name, request.Method, request.URL.RequestURI())
+	} else {
+		fmt.Fprintf(writer, "mox: cassette %s: out of order interaction: expected %s, got %s %s\n", name, failure.Expected, request.Method, request.URL.RequestURI())
+	}
+	return true
+}
+
+// Failures returns the requests ordered replay rejected. If test is
+// not empty, only the requests with that correlation id are returned
+func (c *Cassettes) Failures(test string) []ReplayFailure {
+	c.Lock()
+	defer c.Unlock()
+	ret := []ReplayFailure{}
+	for _, f := range c.failures {
+		if len(test) == 0 || f.Test == test {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// Record adds a recorded route to the cassette of the request and
+// saves the cassette
+func (c *Cassettes) Record(request *http.Request, route RouteRequest) {
+	name := c.name(request)
+	if len(name) == 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	cs, err := c.get(name)
+	if err != nil {
+		fmt.Println("mox:", err)
+		return
+	}
+	replaced := false
+	for i := range cs.routes {
+		// Ordered cassettes keep every interaction
+		if !cs.ordered && RoutesEq(&cs.routes[i], &route) {
+			cs.routes[i] = route
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		cs.routes = append(cs.routes, route)
+	}
+	if cs.ordered {
+		cs.next = len(cs.routes)
+	}
+	if err := cs.build(c.m); err != nil {
+		fmt.Println("mox:", err)
+	}
+	data, _ := json.MarshalIndent(cs.routes, "", "    ")
+	if err := os.MkdirAll(c.Dir, 0755); err == nil {
+		err = ioutil.WriteFile(c.file(name), data, 0644)
+	}
+	if err != nil {
+		fmt.Println("mox: cannot save cassette:", err)
+	}
+}
+
+// Insert makes the named cassette active. Its file is read again, so
+// changes to it are replayed, and ordered replay starts from the
+// first interaction
+func (c *Cassettes) Insert(name string, ordered bool) error {
+	if err := validCassette(name); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.active, c.activeOrdered = name, ordered
+	delete(c.loaded, name)
+	return nil
+}
+
+// Reset ejects the active cassette, forgets the loaded ones, and
+// clears the replay failures
+func (c *Cassettes) Reset() {
+	c.Lock()
+	c.active = ""
+	c.loaded = nil
+	c.failures = nil
+	c.Unlock()
+}
+
+// Status returns the active cassette and the cassettes in the
+// directory
+func (c *Cassettes) Status() CassetteStatus {
+	ret := CassetteStatus{Cassettes: []string{}}
+	files, _ := ioutil.ReadDir(c.Dir)
+	for _, f := range files {
+		if name := f.Name(); !f.IsDir() && strings.HasSuffix(name, ".json") {
+			ret.Cassettes = append(ret.Cassettes, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Strings(ret.Cassettes)
+	ret.Failures = c.Failures("")
+	c.Lock()
+	ret.Active = c.active
+	ret.Ordered = len(c.active) > 0 && (c.Ordered || c.activeOrdered)
+	c.Unlock()
+	return ret
+}
+
+// serveCassette returns the active cassette with GET, inserts a
+// cassette with PUT or POST, and ejects the active cassette with
+// DELETE
+func (h *AdminHandler) serveCassette(writer http.ResponseWriter, request *http.Request) {
+	c := &h.M.Cassettes
+	if len(c.Dir) == 0 {
+		http.NotFound(writer, request)
+		return
+	}
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req CassetteRequest
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+			writeError(writer, err)
+			return
+		}
+		if err := c.Insert(req.Name, req.Ordered); err != nil {
+			writeError(writer, err)
+			return
+		}
+	case http.MethodDelete:
+		c.Lock()
+		c.active = ""
+		c.Unlock()
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ret, _ := json.Marshal(c.Status())
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
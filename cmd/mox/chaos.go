@@ -0,0 +1,124 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// ChaosSettings are the faults injected into the responses of all
+	// routes while chaos is enabled
+	ChaosSettings struct {
+		Enabled bool `json:"enabled"`
+		// ErrorRate is the fraction of responses replaced by an error
+		ErrorRate float64 `json:"errorRate,omitempty"`
+		// Status is the status of the errors, 503 by default
+		Status int `json:"status,omitempty"`
+		// Delay is added to every response, as a duration
+		Delay string `json:"delay,omitempty"`
+	}
+
+	// Chaos keeps the chaos settings of the mock
+	Chaos struct {
+		sync.Mutex
+		settings ChaosSettings
+	}
+)
+
+// Validate checks the error rate, the status and the delay
+func (c ChaosSettings) Validate() error {
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		return errors.New("chaos: errorRate must be between 0 and 1")
+	}
+	if c.Status != 0 && (c.Status < 100 || c.Status > 599) {
+		return errors.New("chaos: invalid status")
+	}
+	if len(c.Delay) > 0 {
+		if _, err := time.ParseDuration(c.Delay); err != nil {
+			return errors.New("chaos: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Get returns the chaos settings
+func (c *Chaos) Get() ChaosSettings {
+	c.Lock()
+	defer c.Unlock()
+	return c.settings
+}
+
+// Set replaces the chaos settings
+func (c *Chaos) Set(settings ChaosSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	c.Lock()
+	c.settings = settings
+	c.Unlock()
+	return nil
+}
+
+// inject returns the response with the chaos faults, and true if it
+// was replaced by an error
+func (c *Chaos) inject(ret ReturnData) (ReturnData, bool) {
+	s := c.Get()
+	if !s.Enabled {
+		return ret, false
+	}
+	failed := false
+	if s.ErrorRate > 0 && rnd.Float64() < s.ErrorRate {
+		status := s.Status
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		ret = ReturnData{Status: status, Delay: ret.Delay, Latency: ret.Latency, DelayProfile: ret.DelayProfile}
+		failed = true
+	}
+	if d, err := time.ParseDuration(s.Delay); err == nil && d > 0 {
+		route, _ := time.ParseDuration(ret.Delay)
+		ret.Delay = (route + d).String()
+	}
+	return ret, failed
+}
+
+func (h *AdminHandler) serveChaos(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var settings ChaosSettings
+		err := json.NewDecoder(request.Body).Decode(&settings)
+		if err == nil {
+			err = h.M.Chaos.Set(settings)
+		}
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+	case http.MethodDelete:
+		h.M.Chaos.Set(ChaosSettings{})
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ret, _ := json.Marshal(h.M.Chaos.Get())
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
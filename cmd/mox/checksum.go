@@ -0,0 +1,87 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// Checksum headers computed from the response body
+const (
+	checksumETag   = "etag"
+	checksumMD5    = "content-md5"
+	checksumDigest = "digest"
+)
+
+// validateChecksums checks the checksum header names
+func validateChecksums(checksums []string) error {
+	for _, c := range checksums {
+		switch c {
+		case checksumETag, checksumMD5, checksumDigest:
+		default:
+			return errors.New("unknown checksum: " + c)
+		}
+	}
+	return nil
+}
+
+// headerValue returns the value of a header, false if there is none
+func (p Pairs) headerValue(key string) (string, bool) {
+	key = http.CanonicalHeaderKey(key)
+	for _, h := range p {
+		if http.CanonicalHeaderKey(h.Key) == key {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// withChecksums sets the checksum headers of the response from its
+// final body, replacing headers with the same names
+func (ret ReturnData) withChecksums() ReturnData {
+	if len(ret.Checksums) == 0 {
+		return ret
+	}
+	values := make(map[string]string)
+	for _, c := range ret.Checksums {
+		switch c {
+		case checksumETag:
+			values["Etag"] = BodyETag(ret.Body)
+		case checksumMD5:
+			sum := md5.Sum([]byte(ret.Body))
+			values["Content-Md5"] = base64.StdEncoding.EncodeToString(sum[:])
+		case checksumDigest:
+			sum := sha256.Sum256([]byte(ret.Body))
+			values["Digest"] = "sha-256=" + base64.StdEncoding.EncodeToString(sum[:])
+		}
+	}
+	headers := make(Pairs, 0, len(ret.Headers)+len(values))
+	for _, h := range ret.Headers {
+		if _, ok := values[http.CanonicalHeaderKey(h.Key)]; !ok {
+			headers = append(headers, h)
+		}
+	}
+	for _, c := range []string{"Etag", "Content-Md5", "Digest"} {
+		if v, ok := values[c]; ok {
+			headers = append(headers, Pair{Key: c, Value: v})
+		}
+	}
+	ret.Headers = headers
+	return ret
+}
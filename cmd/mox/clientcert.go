@@ -0,0 +1,156 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ClientCertMatch restricts a route to TLS requests with a client
+// certificate. All given attributes must match
+type ClientCertMatch struct {
+	// CN is the common name of the subject
+	CN string `json:"cn,omitempty"`
+	// SAN is one of the DNS names, email addresses, URIs or IP
+	// addresses of the certificate
+	SAN string `json:"san,omitempty"`
+	// Fingerprint is the SHA-256 of the certificate in hex. Colons
+	// and case are ignored
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Client certificate modes of the TLS listener
+const (
+	clientCertRequest = "request"
+	clientCertRequire = "require"
+)
+
+// normalizeFingerprint returns the fingerprint in lowercase without
+// colons
+func normalizeFingerprint(s string) string {
+	return strings.ToLower(strings.Replace(s, ":", "", -1))
+}
+
+// Validate checks the fingerprint
+func (c ClientCertMatch) Validate() error {
+	if len(c.Fingerprint) > 0 {
+		if b, err := hex.DecodeString(normalizeFingerprint(c.Fingerprint)); err != nil || len(b) != sha256.Size {
+			return errors.New("clientCert: fingerprint must be a SHA-256 in hex")
+		}
+	}
+	return nil
+}
+
+// hasSAN returns true if the certificate has the subject alternative
+// name
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, n := range cert.DNSNames {
+		if strings.EqualFold(n, san) {
+			return true
+		}
+	}
+	for _, n := range cert.EmailAddresses {
+		if strings.EqualFold(n, san) {
+			return true
+		}
+	}
+	for _, u := range cert.URIs {
+		if u.String() == san {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCertMatcher matches requests whose client certificate has the
+// attributes
+func clientCertMatcher(c ClientCertMatch) func(*http.Request) bool {
+	fingerprint := normalizeFingerprint(c.Fingerprint)
+	return func(request *http.Request) bool {
+		if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+			return false
+		}
+		cert := request.TLS.PeerCertificates[0]
+		if len(c.CN) > 0 && cert.Subject.CommonName != c.CN {
+			return false
+		}
+		if len(c.SAN) > 0 && !hasSAN(cert, c.SAN) {
+			return false
+		}
+		if len(fingerprint) > 0 {
+			sum := sha256.Sum256(cert.Raw)
+			if hex.EncodeToString(sum[:]) != fingerprint {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// clientCertEq returns true if the client certificate predicates are
+// the same
+func clientCertEq(c1, c2 *ClientCertMatch) bool {
+	if c1 == nil || c2 == nil {
+		return c1 == c2
+	}
+	return c1.CN == c2.CN && c1.SAN == c2.SAN && normalizeFingerprint(c1.Fingerprint) == normalizeFingerprint(c2.Fingerprint)
+}
+
+// ClientAuth returns the TLS client authentication of a client
+// certificate mode, verifying certificates with the CAs in the PEM
+// file if one is given
+func ClientAuth(mode, caFile string) (tls.ClientAuthType, *x509.CertPool, error) {
+	var pool *x509.CertPool
+	if len(caFile) > 0 {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return tls.NoClientCert, nil, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return tls.NoClientCert, nil, errors.New("no certificates in " + caFile)
+		}
+	}
+	switch mode {
+	case "":
+		if pool != nil {
+			return tls.VerifyClientCertIfGiven, pool, nil
+		}
+		return tls.NoClientCert, nil, nil
+	case clientCertRequest:
+		if pool != nil {
+			return tls.VerifyClientCertIfGiven, pool, nil
+		}
+		return tls.RequestClientCert, nil, nil
+	case clientCertRequire:
+		if pool != nil {
+			return tls.RequireAndVerifyClientCert, pool, nil
+		}
+		return tls.RequireAnyClientCert, nil, nil
+	}
+	return tls.NoClientCert, nil, errors.New("unknown client certificate mode: " + mode)
+}
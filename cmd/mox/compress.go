@@ -0,0 +1,110 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipWriter compresses an admin response if the client accepts gzip
+// and the response is not compressed already
+type gzipWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	started bool
+}
+
+// acceptsGzip returns true if the request accepts gzip encoding
+func acceptsGzip(request *http.Request) bool {
+	for _, v := range strings.Split(request.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(v, ";")
+		if strings.EqualFold(strings.TrimSpace(params[0]), "gzip") {
+			return qValue(params[1:]) > 0
+		}
+	}
+	return false
+}
+
+// qValue returns the q parameter of an Accept header element, 1 if
+// there is none and 0 if it is invalid
+func qValue(params []string) float64 {
+	for _, p := range params {
+		p = strings.TrimSpace(p)
+		if len(p) < 2 || (p[0] != 'q' && p[0] != 'Q') || p[1] != '=' {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(p[2:]), 64)
+		if err != nil {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+// gunzipBody replaces a gzip encoded request body with a reader of
+// the decompressed body
+func gunzipBody(request *http.Request) error {
+	if !strings.EqualFold(request.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+	gz, err := gzip.NewReader(request.Body)
+	if err != nil {
+		return err
+	}
+	request.Body = struct {
+		io.Reader
+		io.Closer
+	}{gz, request.Body}
+	request.Header.Del("Content-Encoding")
+	request.ContentLength = -1
+	return nil
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if !w.started {
+		w.started = true
+		header := w.ResponseWriter.Header()
+		header.Add("Vary", "Accept-Encoding")
+		if len(header.Get("Content-Encoding")) == 0 && header.Get("Content-Type") != "application/gzip" &&
+			status != http.StatusNoContent && status != http.StatusNotModified {
+			header.Set("Content-Encoding", "gzip")
+			header.Del("Content-Length")
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+// Close flushes the compressed response
+func (w *gzipWriter) Close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
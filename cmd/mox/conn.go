@@ -0,0 +1,61 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConnTracker keeps track of the connections of a server, so handlers
+// can change connection deadlines set by the server
+type ConnTracker struct {
+	sync.Mutex
+	conns map[string]net.Conn
+}
+
+// ConnState is the http.Server ConnState hook
+func (t *ConnTracker) ConnState(conn net.Conn, state http.ConnState) {
+	t.Lock()
+	defer t.Unlock()
+	switch state {
+	case http.StateNew:
+		if t.conns == nil {
+			t.conns = make(map[string]net.Conn)
+		}
+		t.conns[conn.RemoteAddr().String()] = conn
+	case http.StateHijacked, http.StateClosed:
+		delete(t.conns, conn.RemoteAddr().String())
+	}
+}
+
+// Conn returns the connection of the request
+func (t *ConnTracker) Conn(request *http.Request) net.Conn {
+	t.Lock()
+	defer t.Unlock()
+	return t.conns[request.RemoteAddr]
+}
+
+// SetWriteDeadline overrides the server write timeout for the
+// response to the request. Returns false if the connection is unknown
+func (t *ConnTracker) SetWriteDeadline(request *http.Request, timeout time.Duration) bool {
+	conn := t.Conn(request)
+	if conn == nil {
+		return false
+	}
+	return conn.SetWriteDeadline(time.Now().Add(timeout)) == nil
+}
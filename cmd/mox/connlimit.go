@@ -0,0 +1,122 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnLimits limits the number of open connections of listeners, in
+// total and for each client IP. Connections over the limits are shed
+// as soon as they are accepted, instead of waiting for a handler
+type ConnLimits struct {
+	sync.Mutex
+	// Max and PerIP are the connection limits, 0 for no limit
+	Max   int
+	PerIP int
+	total int
+	perIP map[string]int
+	shed  int64
+}
+
+// overloaded is written to shed plain HTTP connections
+var overloaded = []byte("HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Length: 0\r\nRetry-After: 1\r\n\r\n")
+
+// Listener wraps a listener to enforce the limits. If reject is true,
+// shed connections get a 503 response before they are closed, which
+// can only be done for plain HTTP
+func (l *ConnLimits) Listener(ln net.Listener, reject bool) net.Listener {
+	if l == nil || (l.Max <= 0 && l.PerIP <= 0) {
+		return ln
+	}
+	return &limitListener{Listener: ln, limits: l, reject: reject}
+}
+
+// Shed returns the number of connections shed
+func (l *ConnLimits) Shed() int64 {
+	if l == nil {
+		return 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	return l.shed
+}
+
+// acquire reserves a connection for the IP, and returns false if
+// there are too many connections
+func (l *ConnLimits) acquire(ip string) bool {
+	l.Lock()
+	defer l.Unlock()
+	if (l.Max > 0 && l.total >= l.Max) || (l.PerIP > 0 && l.perIP[ip] >= l.PerIP) {
+		l.shed++
+		return false
+	}
+	if l.perIP == nil {
+		l.perIP = make(map[string]int)
+	}
+	l.total++
+	l.perIP[ip]++
+	return true
+}
+
+func (l *ConnLimits) release(ip string) {
+	l.Lock()
+	defer l.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+type limitListener struct {
+	net.Listener
+	limits *ConnLimits
+	reject bool
+}
+
+func (ln *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if ln.limits.acquire(ip) {
+			return &limitConn{Conn: conn, limits: ln.limits, ip: ip}, nil
+		}
+		go func() {
+			if ln.reject {
+				conn.SetWriteDeadline(time.Now().Add(time.Second))
+				conn.Write(overloaded)
+			}
+			conn.Close()
+		}()
+	}
+}
+
+// limitConn releases its connection slot when it is closed
+type limitConn struct {
+	net.Conn
+	limits *ConnLimits
+	ip     string
+	once   sync.Once
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(func() { c.limits.release(c.ip) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,242 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// DNSNames are the host names the DNS server answers, with their
+	// addresses. A nil address is the address of the server. Names
+	// starting with *. match all their subdomains
+	DNSNames map[string]net.IP
+
+	// DNSServer answers DNS queries for the configured names over UDP,
+	// so systems under test resolve dependency host names to mox
+	DNSServer struct {
+		Names DNSNames
+		// IP is the address of names without one
+		IP net.IP
+		// Forward, if set, is the host:port of a DNS server queries for
+		// other names are relayed to. Otherwise they are refused
+		Forward string
+	}
+)
+
+// DNS record types, classes and response codes
+const (
+	dnsTypeA     = 1
+	dnsTypeAAAA  = 28
+	dnsClassIN   = 1
+	dnsRcodeOK   = 0
+	dnsRcodeFail = 2
+	dnsRcodeRefd = 5
+	dnsTTL       = 60
+)
+
+func (n DNSNames) String() string {
+	names := make([]string, 0, len(n))
+	for name := range n {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set adds a name, optionally with an address as name=ip
+func (n DNSNames) Set(value string) error {
+	name, ip := value, ""
+	if eq := strings.Index(value, "="); eq >= 0 {
+		name, ip = value[:eq], value[eq+1:]
+	}
+	if len(name) == 0 {
+		return errors.New("expecting name or name=ip, got " + value)
+	}
+	var addr net.IP
+	if len(ip) > 0 {
+		if addr = net.ParseIP(ip); addr == nil {
+			return errors.New("invalid IP address: " + ip)
+		}
+	}
+	n[strings.ToLower(strings.TrimSuffix(name, "."))] = addr
+	return nil
+}
+
+// lookup returns the address of a name, false if it is not configured
+func (n DNSNames) lookup(name string) (net.IP, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if ip, ok := n[name]; ok {
+		return ip, true
+	}
+	for dot := strings.Index(name, "."); dot >= 0; dot = strings.Index(name, ".") {
+		name = name[dot+1:]
+		if ip, ok := n["*."+name]; ok {
+			return ip, true
+		}
+	}
+	return nil, false
+}
+
+// HostIP returns the address other hosts most likely reach this host
+// with, the source address of outgoing traffic. No packet is sent
+func HostIP() net.IP {
+	conn, err := net.Dial("udp", "192.0.2.1:53")
+	if err != nil {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// ListenAndServe answers DNS queries on the UDP address
+func (s *DNSServer) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	buf := make([]byte, 512)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if reply := s.reply(query); reply != nil {
+				conn.WriteTo(reply, from)
+			}
+		}()
+	}
+}
+
+// parseQuestion returns the name and type of the first question of a
+// query, and the offset after the question
+func parseQuestion(query []byte) (string, uint16, int, error) {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[4:6]) == 0 {
+		return "", 0, 0, errors.New("no question")
+	}
+	var labels []string
+	i := 12
+	for {
+		if i >= len(query) {
+			return "", 0, 0, errors.New("short question")
+		}
+		l := int(query[i])
+		i++
+		if l == 0 {
+			break
+		}
+		if l&0xc0 != 0 || i+l > len(query) {
+			return "", 0, 0, errors.New("invalid name")
+		}
+		labels = append(labels, string(query[i:i+l]))
+		i += l
+	}
+	if i+4 > len(query) {
+		return "", 0, 0, errors.New("short question")
+	}
+	return strings.Join(labels, "."), binary.BigEndian.Uint16(query[i : i+2]), i + 4, nil
+}
+
+// reply returns the response to a query, nil if the query cannot be
+// answered at all
+func (s *DNSServer) reply(query []byte) []byte {
+	name, qtype, end, err := parseQuestion(query)
+	if err != nil {
+		if len(query) < 12 {
+			return nil
+		}
+		return dnsResponse(query[:12], nil, dnsRcodeFail, nil)
+	}
+	question := query[12:end]
+	ip, ok := s.Names.lookup(name)
+	if !ok {
+		if len(s.Forward) > 0 {
+			if reply, err := s.forward(query); err == nil {
+				return reply
+			}
+			return dnsResponse(query[:12], question, dnsRcodeFail, nil)
+		}
+		return dnsResponse(query[:12], question, dnsRcodeRefd, nil)
+	}
+	if ip == nil {
+		ip = s.IP
+	}
+	var rdata []byte
+	if ip4 := ip.To4(); ip4 != nil && qtype == dnsTypeA {
+		rdata = ip4
+	} else if ip4 == nil && qtype == dnsTypeAAAA {
+		rdata = ip.To16()
+	}
+	var answer []byte
+	if rdata != nil {
+		// The name is a pointer to the question
+		answer = make([]byte, 12, 12+len(rdata))
+		answer[0], answer[1] = 0xc0, 12
+		binary.BigEndian.PutUint16(answer[2:4], qtype)
+		binary.BigEndian.PutUint16(answer[4:6], dnsClassIN)
+		binary.BigEndian.PutUint32(answer[6:10], dnsTTL)
+		binary.BigEndian.PutUint16(answer[10:12], uint16(len(rdata)))
+		answer = append(answer, rdata...)
+	}
+	return dnsResponse(query[:12], question, dnsRcodeOK, answer)
+}
+
+// dnsResponse builds a response with the header of the query, the
+// question, and an answer if it is not nil
+func dnsResponse(header, question []byte, rcode byte, answer []byte) []byte {
+	ret := append([]byte(nil), header...)
+	// QR and AA set, opcode and RD kept, RA set
+	ret[2] = 0x84 | ret[2]&0x79
+	ret[3] = 0x80 | rcode
+	qd, an := 0, 0
+	if question != nil {
+		qd = 1
+	}
+	if answer != nil {
+		an = 1
+	}
+	binary.BigEndian.PutUint16(ret[4:6], uint16(qd))
+	binary.BigEndian.PutUint16(ret[6:8], uint16(an))
+	binary.BigEndian.PutUint16(ret[8:10], 0)
+	binary.BigEndian.PutUint16(ret[10:12], 0)
+	return append(append(ret, question...), answer...)
+}
+
+// forward relays a query to the forward server
+func (s *DNSServer) forward(query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", s.Forward, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
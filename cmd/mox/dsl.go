@@ -0,0 +1,255 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompileDSL compiles stub definitions written one per line:
+//
+//	METHOD PATH STATUS [BODY | @FILE] [OPTION=VALUE...]
+//
+// For example: GET /users/{id} 200 @users.json header=X-Env:test.
+// Bodies with spaces are quoted, and a quoted body is never taken for
+// an option or a file. Files are relative to dir. Options
+// are id, header, query, type, timeout and delay. A line starting with
+// "default" gives options for the lines after it, which the options
+// of a line add to or override. Blank lines and
+// lines starting with # are skipped
+func CompileDSL(rd io.Reader, dir string) ([]RouteRequest, error) {
+	var reqs []RouteRequest
+	var defaults []dslToken
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		tokens, err := splitDSL(line)
+		var req RouteRequest
+		if err == nil && tokens[0].text == "default" {
+			if err = applyDSLOptions(&req, tokens[1:]); err == nil {
+				defaults = tokens[1:]
+				continue
+			}
+		} else if err == nil {
+			req, err = compileDSLLine(tokens, defaults, dir)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, scanner.Err()
+}
+
+// dslToken is a token of a DSL line. A literal token has a quote
+// before any '=', so it is a body and never an option
+type dslToken struct {
+	text    string
+	literal bool
+}
+
+// splitDSL splits a line into tokens separated by spaces. Single or
+// double quotes group a token with spaces, and are removed
+func splitDSL(line string) ([]dslToken, error) {
+	var tokens []dslToken
+	var token []byte
+	var quote byte
+	inToken, literal, eq := false, false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				token = append(token, c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+			literal = literal || !eq
+		case c == ' ' || c == '\t':
+			if inToken {
+				tokens = append(tokens, dslToken{text: string(token), literal: literal})
+				token = token[:0]
+				inToken, literal, eq = false, false, false
+			}
+		default:
+			token = append(token, c)
+			inToken = true
+			eq = eq || c == '='
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inToken {
+		tokens = append(tokens, dslToken{text: string(token), literal: literal})
+	}
+	return tokens, nil
+}
+
+func compileDSLLine(tokens, defaults []dslToken, dir string) (RouteRequest, error) {
+	var req RouteRequest
+	if len(tokens) < 3 {
+		return req, errors.New("expecting METHOD PATH STATUS")
+	}
+	req.Method = strings.ToUpper(tokens[0].text)
+	req.Path = tokens[1].text
+	if !strings.HasPrefix(req.Path, "/") {
+		return req, errors.New("invalid path: " + req.Path)
+	}
+	status, err := strconv.Atoi(tokens[2].text)
+	if err != nil {
+		return req, errors.New("invalid status: " + tokens[2].text)
+	}
+	req.Return.Status = status
+	if err := applyDSLOptions(&req, defaults); err != nil {
+		return req, err
+	}
+	hasBody := false
+	var options []dslToken
+	for _, token := range tokens[3:] {
+		if isDSLOption(token) {
+			options = append(options, token)
+			continue
+		}
+		t := token.text
+		if hasBody {
+			return req, errors.New("unexpected " + t + ", quote bodies with spaces")
+		}
+		hasBody = true
+		if strings.HasPrefix(t, "@") && !token.literal {
+			name := t[1:]
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return req, err
+			}
+			req.Return.Body = string(data)
+			if ct := mime.TypeByExtension(filepath.Ext(name)); len(ct) > 0 && !hasContentType(req.Return.Headers) {
+				req.Return.Headers = append(req.Return.Headers, Pair{Key: "Content-Type", Value: ct})
+			}
+		} else {
+			req.Return.Body = t
+			if (strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[")) && !hasContentType(req.Return.Headers) {
+				req.Return.Headers = append(req.Return.Headers, Pair{Key: "Content-Type", Value: "application/json"})
+			}
+		}
+	}
+	return req, applyDSLOptions(&req, options)
+}
+
+func isDSLOption(token dslToken) bool {
+	eq := strings.Index(token.text, "=")
+	if eq <= 0 || token.literal {
+		return false
+	}
+	switch token.text[:eq] {
+	case "id", "header", "query", "type", "timeout", "delay":
+		return true
+	}
+	return false
+}
+
+func applyDSLOptions(req *RouteRequest, options []dslToken) error {
+	for _, token := range options {
+		opt := token.text
+		if !isDSLOption(token) {
+			return errors.New("invalid option: " + opt)
+		}
+		eq := strings.Index(opt, "=")
+		value := opt[eq+1:]
+		switch opt[:eq] {
+		case "id":
+			req.ID = value
+		case "header":
+			colon := strings.Index(value, ":")
+			if colon <= 0 {
+				return errors.New("expecting header=NAME:VALUE: " + opt)
+			}
+			req.Return.Headers = append(req.Return.Headers, Pair{Key: value[:colon], Value: strings.TrimSpace(value[colon+1:])})
+		case "query":
+			qeq := strings.Index(value, "=")
+			if qeq <= 0 {
+				return errors.New("expecting query=NAME=VALUE: " + opt)
+			}
+			req.Queries = append(req.Queries, Pair{Key: value[:qeq], Value: value[qeq+1:]})
+		case "type":
+			if value == "json" {
+				value = "application/json"
+			}
+			headers := Pairs{{Key: "Content-Type", Value: value}}
+			for _, h := range req.Return.Headers {
+				if !strings.EqualFold(h.Key, "Content-Type") {
+					headers = append(headers, h)
+				}
+			}
+			req.Return.Headers = headers
+		case "timeout":
+			if _, err := time.ParseDuration(value); err != nil {
+				return err
+			}
+			req.Timeout = value
+		case "delay":
+			if _, err := time.ParseDuration(value); err != nil {
+				return err
+			}
+			req.Return.Delay = value
+		}
+	}
+	return nil
+}
+
+// runCompile prints the routes compiled from DSL files as JSON
+func runCompile(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: mox compile FILE...")
+		os.Exit(1)
+	}
+	var reqs []RouteRequest
+	for _, f := range args {
+		file, err := os.Open(f)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		r, err := CompileDSL(file, filepath.Dir(f))
+		file.Close()
+		if err != nil {
+			fmt.Printf("%s: %s\n", f, err)
+			os.Exit(1)
+		}
+		reqs = append(reqs, r...)
+	}
+	out, _ := json.MarshalIndent(reqs, "", "    ")
+	fmt.Println(string(out))
+}
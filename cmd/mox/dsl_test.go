@@ -0,0 +1,95 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileDSL(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"id": 1}`), 0644)
+	tests := []struct {
+		line    string
+		body    string
+		headers Pairs
+		queries Pairs
+		id      string
+		err     bool
+	}{
+		{line: `GET /x 200`},
+		{line: `GET /x 200 plain`, body: "plain"},
+		{line: `GET /x 200 'two words'`, body: "two words"},
+		{line: `GET /x 200 "id=5"`, body: "id=5"},
+		{line: `GET /x 200 'delay=1s' id=r1`, body: "delay=1s", id: "r1"},
+		{line: `GET /x 200 '@user.json'`, body: "@user.json"},
+		{line: `GET /x 200 @user.json`, body: `{"id": 1}`, headers: Pairs{{Key: "Content-Type", Value: "application/json"}}},
+		{line: `GET /x 200 '{"a": 1}'`, body: `{"a": 1}`, headers: Pairs{{Key: "Content-Type", Value: "application/json"}}},
+		{line: `GET /x 200 header="X-Msg:a = b"`, headers: Pairs{{Key: "X-Msg", Value: "a = b"}}},
+		{line: `GET /x 200 query=q=none`, queries: Pairs{{Key: "q", Value: "none"}}},
+		{line: `GET /x 200 a b`, err: true},
+		{line: `GET x 200`, err: true},
+		{line: `GET /x ok`, err: true},
+		{line: `GET /x 200 'open`, err: true},
+		{line: `GET /x 200 delay=soon`, err: true},
+		{line: `GET /x 200 header=bad`, err: true},
+	}
+	for _, x := range tests {
+		reqs, err := CompileDSL(strings.NewReader(x.line), dir)
+		if x.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", x.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", x.line, err)
+			continue
+		}
+		if len(reqs) != 1 {
+			t.Errorf("%s: got %d routes", x.line, len(reqs))
+			continue
+		}
+		r := reqs[0]
+		if r.Return.Body != x.body || r.ID != x.id || !reflect.DeepEqual(r.Return.Headers, x.headers) || !reflect.DeepEqual(r.Queries, x.queries) {
+			t.Errorf("%s: got %+v", x.line, r)
+		}
+	}
+}
+
+func TestCompileDSLDefaults(t *testing.T) {
+	reqs, err := CompileDSL(strings.NewReader(`
+# comment
+GET /a 200
+default header=X-Env:test delay=10ms
+GET /b 200 delay=20ms
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("got %d routes", len(reqs))
+	}
+	if len(reqs[0].Return.Headers) != 0 || len(reqs[0].Return.Delay) != 0 {
+		t.Errorf("defaults applied before the default line: %+v", reqs[0])
+	}
+	if v, _ := reqs[1].Return.Headers.headerValue("X-Env"); v != "test" || reqs[1].Return.Delay != "20ms" {
+		t.Errorf("got %+v", reqs[1])
+	}
+}
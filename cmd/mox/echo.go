@@ -0,0 +1,57 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+)
+
+// Echo reflects parts of the request into response headers, so a
+// test can check what the client sent from the response alone
+type Echo struct {
+	// Headers are the request headers to echo
+	Headers []string `json:"headers,omitempty"`
+	// Queries are the query parameters to echo
+	Queries []string `json:"queries,omitempty"`
+	// Body echoes the length and SHA-256 of the request body
+	Body bool `json:"body,omitempty"`
+	// Prefix of the response headers, X-Echo- by default
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Apply adds the echo headers to the response
+func (e *Echo) Apply(header http.Header, request *http.Request) {
+	prefix := orDefault(e.Prefix, "X-Echo-")
+	for _, h := range e.Headers {
+		for _, v := range request.Header[http.CanonicalHeaderKey(h)] {
+			header.Add(prefix+h, v)
+		}
+	}
+	query := request.URL.Query()
+	for _, q := range e.Queries {
+		for _, v := range query[q] {
+			header.Add(prefix+"Query-"+q, v)
+		}
+	}
+	if e.Body {
+		body := captureBody(request)
+		sum := sha256.Sum256(body)
+		header.Set(prefix+"Body-Length", strconv.Itoa(len(body)))
+		header.Set(prefix+"Body-SHA256", hex.EncodeToString(sum[:]))
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// EgressAllow are the host names calls to real services may go
+	// to. Names starting with *. match all their subdomains
+	EgressAllow []string
+
+	// EgressCall is a call to a real service the egress guard blocked
+	EgressCall struct {
+		Method string    `json:"method"`
+		URL    string    `json:"url"`
+		Time   time.Time `json:"time"`
+		// Test is the correlation id of the request
+		Test string `json:"test,omitempty"`
+	}
+
+	// Egress guards the calls to real services made for requests no
+	// route matches: forward targets, the proxy upstream and, in
+	// forward proxy mode, the destinations of the requests. When it is
+	// enabled, calls to hosts that are not allowed are blocked and
+	// reported, and calls through the forward proxy to allowed hosts
+	// are passed through
+	Egress struct {
+		sync.Mutex
+		Enabled bool
+		Allow   EgressAllow
+		blocked []EgressCall
+	}
+)
+
+type destinationKey struct{}
+
+// egressClient passes forward proxy requests through
+var egressClient = &http.Client{Timeout: 15 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+func (a *EgressAllow) String() string {
+	return strings.Join(*a, ",")
+}
+
+// Set adds a host name
+func (a *EgressAllow) Set(value string) error {
+	*a = append(*a, strings.ToLower(strings.TrimSuffix(value, ".")))
+	return nil
+}
+
+// allowed returns true if the host, without port, is in the allowlist
+func (a EgressAllow) allowed(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.ToLower(host)
+	for _, name := range a {
+		if name == host || (strings.HasPrefix(name, "*.") && strings.HasSuffix(host, name[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// withDestination marks a request sent through a forward proxy tunnel
+// with its destination
+func withDestination(request *http.Request, dest *url.URL) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), destinationKey{}, dest))
+}
+
+// destination returns the real service a forward proxy request is
+// for, false if the request is not a forward proxy request
+func destination(request *http.Request) (*url.URL, bool) {
+	if dest, ok := request.Context().Value(destinationKey{}).(*url.URL); ok {
+		return dest, true
+	}
+	if request.URL.IsAbs() {
+		return &url.URL{Scheme: request.URL.Scheme, Host: request.URL.Host}, true
+	}
+	return nil, false
+}
+
+// Check returns true if a call to the target is allowed. Otherwise
+// it records the call and writes a 403
+func (e *Egress) Check(writer http.ResponseWriter, request *http.Request, target *url.URL, test string) bool {
+	if !e.Enabled || e.Allow.allowed(target.Host) {
+		return true
+	}
+	u := *target
+	u.Path = strings.TrimSuffix(u.Path, "/") + request.URL.Path
+	u.RawQuery = request.URL.RawQuery
+	fmt.Printf("mox: blocked egress: %s %s\n", request.Method, u.String())
+	e.Lock()
+	e.blocked = append(e.blocked, EgressCall{Method: request.Method, URL: u.String(), Time: time.Now(), Test: test})
+	e.Unlock()
+	data, _ := json.Marshal(authError{Error: "egress_blocked", Message: "mox: calls to " + target.Host + " are not allowed"})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusForbidden)
+	writer.Write(data)
+	return false
+}
+
+// PassThrough passes a forward proxy request no route matches through
+// to its destination if it is allowed
+func (e *Egress) PassThrough(writer http.ResponseWriter, request *http.Request, dest *url.URL, test string) {
+	if e.Check(writer, request, dest, test) {
+		(&Proxy{Upstream: dest, client: egressClient}).ServeHTTP(writer, request)
+	}
+}
+
+// Blocked returns the blocked calls, only those with the correlation
+// id if test is not empty
+func (e *Egress) Blocked(test string) []EgressCall {
+	e.Lock()
+	defer e.Unlock()
+	ret := []EgressCall{}
+	for _, c := range e.blocked {
+		if len(test) == 0 || c.Test == test {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// Reset clears the blocked calls
+func (e *Egress) Reset() {
+	e.Lock()
+	e.blocked = nil
+	e.Unlock()
+}
+
+// serveEgress returns the blocked calls with GET, and clears them with
+// DELETE
+func (h *AdminHandler) serveEgress(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		ret, _ := json.Marshal(h.M.Egress.Blocked(request.URL.Query().Get("test")))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(ret)
+	case http.MethodDelete:
+		h.M.Egress.Reset()
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// TemplateKeys are the AES keys of the encrypt and decrypt template
+// functions, by name
+type TemplateKeys map[string][]byte
+
+// templateKeys are the keys given with -template-key
+var templateKeys = TemplateKeys{}
+
+func (k TemplateKeys) String() string {
+	names := make([]string, 0, len(k))
+	for name := range k {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set adds a key of the form name=hex. The key must be 16, 24 or 32
+// bytes
+func (k TemplateKeys) Set(value string) error {
+	eq := strings.Index(value, "=")
+	if eq <= 0 {
+		return errors.New("expecting name=hexkey, got " + value)
+	}
+	key, err := hex.DecodeString(value[eq+1:])
+	if err != nil {
+		return err
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return err
+	}
+	k[value[:eq]] = key
+	return nil
+}
+
+// gcm returns the AES-GCM cipher of the named key
+func (k TemplateKeys) gcm(name string) (cipher.AEAD, error) {
+	key, ok := k[name]
+	if !ok {
+		return nil, errors.New("unknown key " + name)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt encrypts s with AES-GCM, and returns the nonce followed by
+// the ciphertext
+func (k TemplateKeys) encrypt(name, s string) (string, error) {
+	aead, err := k.gcm(name)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return string(aead.Seal(nonce, nonce, []byte(s), nil)), nil
+}
+
+// decrypt decrypts the output of encrypt
+func (k TemplateKeys) decrypt(name, s string) (string, error) {
+	aead, err := k.gcm(name)
+	if err != nil {
+		return "", err
+	}
+	if len(s) < aead.NonceSize() {
+		return "", errors.New("decrypt: ciphertext too short")
+	}
+	data, err := aead.Open(nil, []byte(s[:aead.NonceSize()]), []byte(s[aead.NonceSize():]), nil)
+	return string(data), err
+}
+
+func gzipString(s string) (string, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func gunzipString(s string) (string, error) {
+	gz, err := gzip.NewReader(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(gz)
+	return string(data), err
+}
+
+func init() {
+	templateFuncs["base64"] = func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	templateFuncs["base64url"] = func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	templateFuncs["base64dec"] = func(s string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			data, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		}
+		return string(data), err
+	}
+	templateFuncs["hex"] = func(s string) string { return hex.EncodeToString([]byte(s)) }
+	templateFuncs["hexdec"] = func(s string) (string, error) {
+		data, err := hex.DecodeString(s)
+		return string(data), err
+	}
+	templateFuncs["urlencode"] = url.QueryEscape
+	templateFuncs["urldecode"] = url.QueryUnescape
+	templateFuncs["pathescape"] = url.PathEscape
+	templateFuncs["gzip"] = gzipString
+	templateFuncs["gunzip"] = gunzipString
+	templateFuncs["encrypt"] = func(key, s string) (string, error) { return templateKeys.encrypt(key, s) }
+	templateFuncs["decrypt"] = func(key, s string) (string, error) { return templateKeys.decrypt(key, s) }
+}
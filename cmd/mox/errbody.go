@@ -0,0 +1,133 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"text/template"
+)
+
+type (
+	// ErrorTemplate is the default body of error responses whose stub
+	// gives no body. Body is a text/template executed with ErrorData
+	ErrorTemplate struct {
+		ContentType string `json:"contentType"`
+		Body        string `json:"body"`
+		tmpl        *template.Template
+	}
+
+	// ErrorBodies maps a status code ("404") or a status class
+	// ("4xx") to its error template
+	ErrorBodies map[string]*ErrorTemplate
+
+	// ErrorData is available to error templates
+	ErrorData struct {
+		Status int
+		// Title is the standard text of the status
+		Title  string
+		Method string
+		Path   string
+		// URI is the request URI, with the query
+		URI string
+	}
+)
+
+// problemTemplate is the default error template, an RFC 7807 problem
+// document
+var problemTemplate = &ErrorTemplate{
+	ContentType: "application/problem+json",
+	Body:        `{"type":"about:blank","title":{{json .Title}},"status":{{.Status}},"instance":{{json .URI}}}`,
+}
+
+// defaultErrorBodies is used unless an error bodies file is given
+var defaultErrorBodies = ErrorBodies{"4xx": problemTemplate, "5xx": problemTemplate}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	},
+}
+
+func init() {
+	for _, t := range defaultErrorBodies {
+		t.compile()
+	}
+}
+
+func (t *ErrorTemplate) compile() error {
+	tmpl, err := template.New("error").Funcs(templateFuncs).Parse(t.Body)
+	t.tmpl = tmpl
+	return err
+}
+
+// LoadErrorBodies reads error templates from a JSON file
+func LoadErrorBodies(name string) (ErrorBodies, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var bodies ErrorBodies
+	if err := json.Unmarshal(data, &bodies); err != nil {
+		return nil, err
+	}
+	for k, t := range bodies {
+		if t == nil {
+			return nil, errors.New("errorBodies: no template for " + k)
+		}
+		if err := t.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return bodies, nil
+}
+
+// newErrorData returns the template data for an error response
+func newErrorData(status int, request *http.Request) ErrorData {
+	return ErrorData{Status: status,
+		Title:  http.StatusText(status),
+		Method: request.Method,
+		Path:   request.URL.Path,
+		URI:    request.URL.RequestURI()}
+}
+
+// Apply adds the error body for the status if the response is an
+// error without a body or a content type
+func (b ErrorBodies) Apply(request *http.Request, ret ReturnData) ReturnData {
+	if ret.Status < 400 || len(ret.Body) > 0 || hasContentType(ret.Headers) {
+		return ret
+	}
+	t, ok := b[strconv.Itoa(ret.Status)]
+	if !ok {
+		t, ok = b[strconv.Itoa(ret.Status/100)+"xx"]
+	}
+	if !ok || t == nil || t.tmpl == nil || len(t.Body) == 0 {
+		return ret
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := t.tmpl.Execute(buf, newErrorData(ret.Status, request)); err != nil {
+		return ret
+	}
+	ret.Body = buf.String()
+	if len(t.ContentType) > 0 {
+		ret.Headers = append(append(Pairs(nil), ret.Headers...), Pair{Key: "Content-Type", Value: t.ContentType})
+	}
+	return ret
+}
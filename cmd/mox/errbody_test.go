@@ -0,0 +1,54 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadErrorBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  bool
+	}{
+		{name: "valid", data: `{"404": {"contentType": "text/plain", "body": "no {{.Path}}"}}`},
+		{name: "null", data: `{"404": null}`, err: true},
+		{name: "bad template", data: `{"5xx": {"body": "{{"}}`, err: true},
+		{name: "not json", data: `[`, err: true},
+	}
+	for _, x := range tests {
+		name := filepath.Join(t.TempDir(), "errors.json")
+		ioutil.WriteFile(name, []byte(x.data), 0644)
+		bodies, err := LoadErrorBodies(name)
+		if x.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", x.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", x.name, err)
+			continue
+		}
+		ret := bodies.Apply(httptest.NewRequest("GET", "/x", nil), ReturnData{Status: 404})
+		if ret.Body != "no /x" {
+			t.Errorf("%s: got %q", x.name, ret.Body)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// Fallbacks are the responses to requests that match no route, instead
+// of the plain 404 and 405. They are stubs, so they can have templates,
+// headers and delays
+type Fallbacks struct {
+	NotFound         *ReturnData `json:"notFound,omitempty"`
+	MethodNotAllowed *ReturnData `json:"methodNotAllowed,omitempty"`
+}
+
+// Validate checks the fallback responses
+func (f *Fallbacks) Validate() error {
+	for _, ret := range []*ReturnData{f.NotFound, f.MethodNotAllowed} {
+		if ret != nil {
+			if err := ret.Validate(); err != nil {
+				return errors.New("fallbacks: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFallbacks reads fallback responses from a JSON file
+func LoadFallbacks(name string) (*Fallbacks, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var f Fallbacks
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, f.Validate()
+}
+
+// get returns the fallback response for the status
+func (f *Fallbacks) get(status int) (ReturnData, bool) {
+	if f == nil {
+		return ReturnData{}, false
+	}
+	var ret *ReturnData
+	switch status {
+	case http.StatusNotFound:
+		ret = f.NotFound
+	case http.StatusMethodNotAllowed:
+		ret = f.MethodNotAllowed
+	}
+	if ret == nil {
+		return ReturnData{}, false
+	}
+	if ret.Status == 0 {
+		r := *ret
+		r.Status = status
+		return r, true
+	}
+	return *ret, true
+}
+
+// writeFallback writes a fallback response. The caller holds the read
+// lock of the mock handler, which is released before the response is
+// delayed
+func (h *MockHandler) writeFallback(writer http.ResponseWriter, request *http.Request, ret ReturnData) {
+	ret = ret.withBodyFile()
+	if ret.Template {
+		ret = ret.render(TemplateData{Request: newTemplateRequest(request), Vars: h.Vars.All()})
+	}
+	ret = ret.problem(request)
+	ret = h.ErrorBodies.Apply(request, ret)
+	if ret.PadTo > 0 {
+		ret.Body = Pad(ret.Body, ret.PadTo)
+	}
+	ret = ret.withChecksums()
+	releaseLock(request)
+	if !ret.wait(request, &h.Stats, unmatchedRoute) {
+		return
+	}
+	ret.Headers.CanonicalHeaders().ToMap(writer.Header())
+	writer.WriteHeader(ret.Status)
+	writer.Write([]byte(ret.Body))
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 reply codes
+const (
+	socksOK             = 0
+	socksNotSupported   = 7
+	socksBadAddressType = 8
+)
+
+// serveTunnel serves the requests sent through a tunnel to host from
+// the mock. With intercept, a TLS connection in the tunnel is
+// terminated with a certificate for the host from the mox CA, so
+// HTTPS requests are mocked like plain ones
+func (h *MockHandler) serveTunnel(conn *bufferedConn, host string, intercept bool) {
+	var c net.Conn = conn
+	if intercept && h.TunnelTLS != nil {
+		conn.SetReadDeadline(time.Now().Add(15 * time.Second))
+		first, err := conn.r.Peek(1)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		// A TLS connection starts with a handshake record
+		if first[0] == 0x16 {
+			c = tls.Server(conn, tunnelConfig(h.TunnelTLS, host))
+		}
+	}
+	dest := &url.URL{Scheme: "http", Host: host}
+	if _, ok := c.(*tls.Conn); ok {
+		dest.Scheme = "https"
+	}
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		h.ServeHTTP(writer, withDestination(request, dest))
+	})
+	srv := &http.Server{Handler: handler, ReadTimeout: 15 * time.Second, WriteTimeout: 15 * time.Second}
+	srv.Serve(&tunnelListener{conn: c})
+}
+
+// tunnelConfig returns the TLS configuration of a tunnel to host,
+// which uses the host name for clients that do not send SNI
+func tunnelConfig(config *tls.Config, host string) *tls.Config {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return &tls.Config{
+		NextProtos: config.NextProtos,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if len(hello.ServerName) == 0 {
+				hello.ServerName = host
+			}
+			return config.GetConfigForClient(hello)
+		}}
+}
+
+// ServeSOCKS accepts SOCKS5 connections on addr, and serves the
+// requests sent through them from the mock
+func ServeSOCKS(addr string, h *MockHandler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go h.serveSOCKS(conn)
+	}
+}
+
+func (h *MockHandler) serveSOCKS(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+	r := bufio.NewReader(conn)
+	host, err := socksHandshake(r, conn)
+	if err != nil {
+		fmt.Println("mox: socks: " + err.Error())
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	h.serveTunnel(&bufferedConn{Conn: conn, r: r}, host, true)
+}
+
+// socksHandshake accepts a SOCKS5 CONNECT request without
+// authentication, and returns its destination as host:port
+func socksHandshake(r *bufio.Reader, w io.Writer) (string, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", err
+	}
+	if hdr[0] != 5 {
+		return "", errors.New("not a SOCKS5 request")
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(methods, 0) < 0 {
+		w.Write([]byte{5, 0xff})
+		return "", errors.New("authentication required by the client")
+	}
+	w.Write([]byte{5, 0})
+	var req [4]byte
+	if _, err := io.ReadFull(r, req[:]); err != nil {
+		return "", err
+	}
+	var addr []byte
+	switch req[3] {
+	case 1:
+		addr = make([]byte, net.IPv4len)
+	case 4:
+		addr = make([]byte, net.IPv6len)
+	case 3:
+		n, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		addr = make([]byte, n)
+	default:
+		socksReply(w, socksBadAddressType)
+		return "", errors.New("unknown address type")
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	if req[1] != 1 {
+		socksReply(w, socksNotSupported)
+		return "", errors.New("only CONNECT is supported")
+	}
+	host := string(addr)
+	if req[3] != 3 {
+		host = net.IP(addr).String()
+	}
+	socksReply(w, socksOK)
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))), nil
+}
+
+// socksReply writes a reply with an empty bound address
+func socksReply(w io.Writer, code byte) {
+	w.Write([]byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0})
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Generator generates example JSON and CRUD route skeletons from Go
+	// struct definitions
+	Generator struct {
+		// Prefix is prepended to generated paths
+		Prefix string
+		types  map[string]*ast.StructType
+	}
+
+	// jsonField is a field of an ordered JSON object
+	jsonField struct {
+		Name  string
+		Value interface{}
+	}
+
+	// jsonObject is a JSON object that keeps field order
+	jsonObject []jsonField
+)
+
+// MarshalJSON writes the object fields in order
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.Name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Load parses Go files, or all Go files in a directory, and collects
+// struct type definitions
+func (g *Generator) Load(path string) error {
+	if g.types == nil {
+		g.types = make(map[string]*ast.StructType)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		pkgs, err := parser.ParseDir(fset, path, func(fi os.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, 0)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			for _, f := range pkg.Files {
+				files = append(files, f)
+			}
+		}
+	} else {
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					g.types[spec.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+	return nil
+}
+
+// Types returns the exported struct type names, sorted
+func (g *Generator) Types() []string {
+	var ret []string
+	for name := range g.types {
+		if ast.IsExported(name) {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Example returns an example value for the named struct type
+func (g *Generator) Example(name string) (interface{}, error) {
+	st, ok := g.types[name]
+	if !ok {
+		return nil, errors.New("gen: unknown type " + name)
+	}
+	return g.structExample(st, map[string]bool{name: true}), nil
+}
+
+func (g *Generator) structExample(st *ast.StructType, seen map[string]bool) jsonObject {
+	obj := jsonObject{}
+	for _, field := range st.Fields.List {
+		name := ""
+		if field.Tag != nil {
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			name = strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+		}
+		if len(field.Names) == 0 {
+			// Embedded struct, fields are promoted
+			if id, ok := field.Type.(*ast.Ident); ok && len(name) == 0 {
+				if emb, ok := g.types[id.Name]; ok && !seen[id.Name] {
+					seen[id.Name] = true
+					obj = append(obj, g.structExample(emb, seen)...)
+					delete(seen, id.Name)
+				}
+			}
+			continue
+		}
+		for _, n := range field.Names {
+			if !n.IsExported() {
+				continue
+			}
+			fieldName := name
+			if len(fieldName) == 0 {
+				fieldName = n.Name
+			}
+			obj = append(obj, jsonField{Name: fieldName, Value: g.example(field.Type, fieldName, seen)})
+		}
+	}
+	return obj
+}
+
+func (g *Generator) example(expr ast.Expr, fieldName string, seen map[string]bool) interface{} {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return g.example(t.X, fieldName, seen)
+	case *ast.ArrayType:
+		if id, ok := t.Elt.(*ast.Ident); ok && id.Name == "byte" {
+			return "Ynl0ZXM="
+		}
+		return []interface{}{g.example(t.Elt, fieldName, seen)}
+	case *ast.MapType:
+		return map[string]interface{}{}
+	case *ast.StructType:
+		return g.structExample(t, seen)
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" && t.Sel.Name == "Time" {
+			return "2017-01-01T00:00:00Z"
+		}
+		return nil
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return fieldName
+		case "bool":
+			return true
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "byte", "rune":
+			return 1
+		case "float32", "float64":
+			return 1.5
+		}
+		if st, ok := g.types[t.Name]; ok && !seen[t.Name] {
+			seen[t.Name] = true
+			defer delete(seen, t.Name)
+			return g.structExample(st, seen)
+		}
+	}
+	return nil
+}
+
+// Routes returns CRUD route skeletons for the named struct type
+func (g *Generator) Routes(name string) ([]RouteRequest, error) {
+	ex, err := g.Example(name)
+	if err != nil {
+		return nil, err
+	}
+	item, _ := json.MarshalIndent(ex, "", "  ")
+	list, _ := json.MarshalIndent([]interface{}{ex}, "", "  ")
+	coll := g.Prefix + "/" + strings.ToLower(name) + "s"
+	one := coll + "/{id}"
+	jsonHdr := Pairs{{Key: "Content-Type", Value: "application/json"}}
+	return []RouteRequest{
+		{Method: "GET", Path: coll, Return: ReturnData{Status: 200, Headers: jsonHdr, Body: string(list)}},
+		{Method: "POST", Path: coll, Return: ReturnData{Status: 201, Headers: jsonHdr, Body: string(item)}},
+		{Method: "GET", Path: one, Return: ReturnData{Status: 200, Headers: jsonHdr, Body: string(item)}},
+		{Method: "PUT", Path: one, Return: ReturnData{Status: 200, Headers: jsonHdr, Body: string(item)}},
+		{Method: "DELETE", Path: one, Return: ReturnData{Status: 204}},
+	}, nil
+}
+
+// runGen runs the gen command:
+//
+//	mox gen [-prefix /api] PATH [TYPE...]
+//
+// PATH is a Go file or a package directory. Routes are generated for
+// the given types, or for all exported structs, and written to stdout
+func runGen(args []string) {
+	g := Generator{}
+	if len(args) > 1 && args[0] == "-prefix" {
+		g.Prefix = strings.TrimSuffix(args[1], "/")
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		fmt.Println("Usage: mox gen [-prefix /api] PATH [TYPE...]")
+		os.Exit(1)
+	}
+	if err := g.Load(args[0]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	names := args[1:]
+	if len(names) == 0 {
+		names = g.Types()
+	}
+	routes := make([]RouteRequest, 0)
+	for _, name := range names {
+		r, err := g.Routes(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		routes = append(routes, r...)
+	}
+	out, _ := json.MarshalIndent(routes, "", "    ")
+	fmt.Println(string(out))
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RouteGroup is a collection of routes sharing default response
+// fields. A member route inherits the default status and delays unless
+// it sets them, and the default headers it does not set itself
+type RouteGroup struct {
+	Group    string         `json:"group"`
+	Defaults ReturnData     `json:"defaults"`
+	Routes   []RouteRequest `json:"routes"`
+}
+
+// Expand returns the member routes with the defaults applied
+func (g RouteGroup) Expand() []RouteRequest {
+	ret := make([]RouteRequest, len(g.Routes))
+	for i, r := range g.Routes {
+		r.Return = g.inherit(r.Return)
+		if r.Variants != nil {
+			r.Variants = append([]Variant(nil), r.Variants...)
+			for j := range r.Variants {
+				r.Variants[j].Return = g.inherit(r.Variants[j].Return)
+			}
+		}
+		if r.Sequence != nil {
+			r.Sequence = append([]ReturnData(nil), r.Sequence...)
+			for j := range r.Sequence {
+				r.Sequence[j] = g.inherit(r.Sequence[j])
+			}
+		}
+		if r.Schedule != nil {
+			r.Schedule = append([]Window(nil), r.Schedule...)
+			for j := range r.Schedule {
+				r.Schedule[j].Return = g.inherit(r.Schedule[j].Return)
+			}
+		}
+		ret[i] = r
+	}
+	return ret
+}
+
+func (g RouteGroup) inherit(ret ReturnData) ReturnData {
+	if ret.Status == 0 {
+		ret.Status = g.Defaults.Status
+	}
+	if len(ret.Delay) == 0 {
+		ret.Delay = g.Defaults.Delay
+	}
+	if ret.Latency == nil {
+		ret.Latency = g.Defaults.Latency
+	}
+	if ret.DelayProfile == nil {
+		ret.DelayProfile = g.Defaults.DelayProfile
+	}
+	if len(g.Defaults.Headers) == 0 {
+		return ret
+	}
+	set := make(map[string]bool)
+	for _, h := range ret.Headers {
+		set[http.CanonicalHeaderKey(h.Key)] = true
+	}
+	headers := append(Pairs(nil), ret.Headers...)
+	for _, h := range g.Defaults.Headers {
+		if !set[http.CanonicalHeaderKey(h.Key)] {
+			headers = append(headers, h)
+		}
+	}
+	ret.Headers = headers
+	return ret
+}
+
+// ParseRoutes parses a route, a route group, or an array of routes
+// and route groups
+func ParseRoutes(data []byte) ([]RouteRequest, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		items = []json.RawMessage{data}
+	}
+	var ret []RouteRequest
+	for _, item := range items {
+		var probe struct {
+			Routes json.RawMessage `json:"routes"`
+		}
+		if err := json.Unmarshal(item, &probe); err != nil {
+			return nil, err
+		}
+		if probe.Routes != nil {
+			var g RouteGroup
+			if err := json.Unmarshal(item, &g); err != nil {
+				return nil, err
+			}
+			ret = append(ret, g.Expand()...)
+			continue
+		}
+		var r RouteRequest
+		if err := json.Unmarshal(item, &r); err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseRoutesGroup(t *testing.T) {
+	routes, err := ParseRoutes([]byte(`[
+  {"group": "g", "defaults": {"status": 202, "delay": "10ms", "headers": [{"key": "X-Env", "value": "test"}]},
+   "routes": [
+     {"method": "GET", "path": "/a", "return": {"delay": "1s", "headers": [{"key": "x-env", "value": "own"}]}},
+     {"method": "GET", "path": "/b", "sequence": [{"body": "1"}, {"status": 500}]}
+   ]},
+  {"method": "GET", "path": "/c"}
+]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("got %d routes", len(routes))
+	}
+	if r := routes[0].Return; r.Status != 202 || r.Delay != "1s" || len(r.Headers) != 1 || r.Headers[0].Value != "own" {
+		t.Errorf("route a: %+v", r)
+	}
+	seq := routes[1].Sequence
+	if len(seq) != 2 || seq[0].Status != 202 || seq[1].Status != 500 {
+		t.Fatalf("sequence: %+v", seq)
+	}
+	for i, r := range seq {
+		if r.Delay != "10ms" {
+			t.Errorf("sequence %d delay: %q", i, r.Delay)
+		}
+		if len(r.Headers) != 1 || r.Headers[0].Key != "X-Env" {
+			t.Errorf("sequence %d headers: %v", i, r.Headers)
+		}
+	}
+	if routes[2].Return.Status != 0 {
+		t.Errorf("route outside the group got %d", routes[2].Return.Status)
+	}
+	if _, err := ParseRoutes([]byte(`[{"routes": 1}]`)); err == nil {
+		t.Errorf("expected an error")
+	}
+}
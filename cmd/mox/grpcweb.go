@@ -0,0 +1,236 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// GRPCWeb makes a route a gRPC-Web method. The route path is the
+// method, like /pkg.Service/Method. It matches gRPC-Web requests,
+// binary or text, whose message has the fields, and frames the
+// response body, the base64 encoded response message, with the gRPC
+// status in the trailers
+type GRPCWeb struct {
+	// Fields are the values of message fields by field number.
+	// Nested message fields are given as dotted numbers like 2.1.
+	// Strings and bytes are compared as text, integers in decimal
+	Fields map[string]string `json:"fields,omitempty"`
+	// Status is the grpc-status of the response
+	Status int `json:"status,omitempty"`
+	// Message is the grpc-message of the response
+	Message string `json:"message,omitempty"`
+}
+
+// gRPC-Web content types
+const (
+	grpcWebProto = "application/grpc-web+proto"
+	grpcWebText  = "application/grpc-web-text"
+)
+
+// isGRPCWeb returns true if the request has a gRPC-Web content type
+func isGRPCWeb(request *http.Request) bool {
+	return strings.HasPrefix(request.Header.Get("Content-Type"), "application/grpc-web")
+}
+
+// isGRPCWebText returns true for the base64 encoded gRPC-Web variant
+func isGRPCWebText(request *http.Request) bool {
+	return strings.HasPrefix(request.Header.Get("Content-Type"), grpcWebText)
+}
+
+// Validate checks the field numbers
+func (g *GRPCWeb) Validate() error {
+	for k := range g.Fields {
+		for _, n := range strings.Split(k, ".") {
+			if i, err := strconv.Atoi(n); err != nil || i <= 0 {
+				return errors.New("grpcWeb: invalid field number " + k)
+			}
+		}
+	}
+	return nil
+}
+
+// grpcWebMessage returns the message of the first data frame of a
+// gRPC-Web request body
+func grpcWebMessage(request *http.Request) ([]byte, error) {
+	body := captureBody(request)
+	if isGRPCWebText(request) {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(string(body)); err != nil {
+			return nil, err
+		}
+	}
+	if len(body) < 5 {
+		return nil, errors.New("grpcWeb: short frame")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if body[0]&0x80 != 0 || uint32(len(body)-5) < n {
+		return nil, errors.New("grpcWeb: invalid data frame")
+	}
+	return body[5 : 5+n], nil
+}
+
+// protoFields decodes the top level fields of a protobuf message.
+// Varints are returned as numbers, length delimited fields as bytes
+func protoFields(msg []byte) (map[int][]interface{}, error) {
+	ret := make(map[int][]interface{})
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf key")
+		}
+		msg = msg[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errors.New("invalid protobuf varint")
+			}
+			ret[field] = append(ret[field], v)
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return nil, errors.New("invalid protobuf fixed64")
+			}
+			ret[field] = append(ret[field], binary.LittleEndian.Uint64(msg))
+			msg = msg[8:]
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return nil, errors.New("invalid protobuf length")
+			}
+			ret[field] = append(ret[field], msg[n:n+int(l)])
+			msg = msg[n+int(l):]
+		case 5:
+			if len(msg) < 4 {
+				return nil, errors.New("invalid protobuf fixed32")
+			}
+			ret[field] = append(ret[field], uint64(binary.LittleEndian.Uint32(msg)))
+			msg = msg[4:]
+		default:
+			return nil, errors.New("unsupported protobuf wire type")
+		}
+	}
+	return ret, nil
+}
+
+// protoHas returns true if a field at the dotted path of the message
+// has the value
+func protoHas(msg []byte, path []string, value string) bool {
+	fields, err := protoFields(msg)
+	if err != nil {
+		return false
+	}
+	n, _ := strconv.Atoi(path[0])
+	for _, v := range fields[n] {
+		switch x := v.(type) {
+		case uint64:
+			if len(path) == 1 && (strconv.FormatUint(x, 10) == value || strconv.FormatInt(int64(x), 10) == value) {
+				return true
+			}
+		case []byte:
+			if len(path) == 1 && string(x) == value {
+				return true
+			}
+			if len(path) > 1 && protoHas(x, path[1:], value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// grpcWebMatcher matches gRPC-Web requests whose message has the
+// fields
+func grpcWebMatcher(g GRPCWeb) func(*http.Request) bool {
+	return func(request *http.Request) bool {
+		if !isGRPCWeb(request) {
+			return false
+		}
+		if len(g.Fields) == 0 {
+			return true
+		}
+		msg, err := grpcWebMessage(request)
+		if err != nil {
+			return false
+		}
+		for k, v := range g.Fields {
+			if !protoHas(msg, strings.Split(k, "."), v) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// grpcWebEq returns true if the gRPC-Web matchers are the same
+func grpcWebEq(g1, g2 *GRPCWeb) bool {
+	if g1 == nil || g2 == nil {
+		return g1 == g2
+	}
+	return reflect.DeepEqual(g1.Fields, g2.Fields)
+}
+
+// frame returns the response as a gRPC-Web response: the message in
+// a data frame followed by a trailer frame with the status, in the
+// content type of the request
+func (g *GRPCWeb) frame(request *http.Request, ret ReturnData) ReturnData {
+	msg, err := base64.StdEncoding.DecodeString(ret.Body)
+	if err != nil {
+		return ReturnData{Status: http.StatusInternalServerError, Body: "mox: grpcWeb: " + err.Error()}
+	}
+	var out []byte
+	if len(msg) > 0 || g.Status == 0 {
+		out = appendFrame(out, 0, msg)
+	}
+	trailer := fmt.Sprintf("grpc-status:%d\r\n", g.Status)
+	if len(g.Message) > 0 {
+		trailer += "grpc-message:" + g.Message + "\r\n"
+	}
+	out = appendFrame(out, 0x80, []byte(trailer))
+	contentType := grpcWebProto
+	if isGRPCWebText(request) {
+		contentType = grpcWebText + "+proto"
+		out = []byte(base64.StdEncoding.EncodeToString(out))
+	}
+	headers := Pairs{}
+	for _, h := range ret.Headers {
+		if http.CanonicalHeaderKey(h.Key) != "Content-Type" {
+			headers = append(headers, h)
+		}
+	}
+	ret.Headers = append(headers, Pair{Key: "Content-Type", Value: contentType})
+	if ret.Status == 0 {
+		ret.Status = http.StatusOK
+	}
+	ret.Body = string(out)
+	return ret
+}
+
+// appendFrame appends a gRPC-Web frame with the flags and the data
+func appendFrame(out []byte, flags byte, data []byte) []byte {
+	var hdr [5]byte
+	hdr[0] = flags
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	return append(append(out, hdr[:]...), data...)
+}
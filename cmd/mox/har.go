@@ -0,0 +1,172 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type (
+	// HAR is the subset of an HTTP Archive used to build routes
+	HAR struct {
+		Log struct {
+			Entries []HAREntry `json:"entries"`
+		} `json:"log"`
+	}
+
+	// HAREntry is a recorded exchange
+	HAREntry struct {
+		Request struct {
+			Method string `json:"method"`
+			URL    string `json:"url"`
+		} `json:"request"`
+		Response struct {
+			Status  int         `json:"status"`
+			Headers []HARHeader `json:"headers"`
+			Content struct {
+				MimeType string `json:"mimeType"`
+				Text     string `json:"text"`
+				Encoding string `json:"encoding"`
+			} `json:"content"`
+		} `json:"response"`
+	}
+
+	// HARHeader is a header of a recorded request or response
+	HARHeader struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+)
+
+// harSkipHeaders are response headers that do not apply to the
+// replayed response. HAR content is already decoded
+var harSkipHeaders = map[string]bool{
+	"Content-Encoding": true,
+}
+
+// ParseHAR returns the routes of the exchanges in an HTTP Archive.
+// Entries that are not HTTP, or got no response, are skipped. A later
+// exchange of the same route replaces the earlier one
+func ParseHAR(data []byte) ([]RouteRequest, error) {
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, err
+	}
+	if har.Log.Entries == nil {
+		return nil, errors.New("har: no entries in archive")
+	}
+	routes := make([]RouteRequest, 0, len(har.Log.Entries))
+	for i, e := range har.Log.Entries {
+		if e.Response.Status <= 0 || !(strings.HasPrefix(e.Request.URL, "http://") || strings.HasPrefix(e.Request.URL, "https://")) {
+			continue
+		}
+		request, err := http.NewRequest(e.Request.Method, e.Request.URL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("har: entry %d: %s", i, err)
+		}
+		response := &http.Response{StatusCode: e.Response.Status, Header: http.Header{}}
+		for _, h := range e.Response.Headers {
+			// HTTP/2 pseudo headers start with a colon
+			if name := http.CanonicalHeaderKey(h.Name); !strings.HasPrefix(name, ":") && !harSkipHeaders[name] {
+				response.Header.Add(name, h.Value)
+			}
+		}
+		if len(response.Header.Get("Content-Type")) == 0 && len(e.Response.Content.MimeType) > 0 {
+			response.Header.Set("Content-Type", e.Response.Content.MimeType)
+		}
+		body := []byte(e.Response.Content.Text)
+		if e.Response.Content.Encoding == "base64" {
+			if body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				return nil, fmt.Errorf("har: entry %d: %s", i, err)
+			}
+		}
+		route := RouteFromExchange(request, response, body)
+		replaced := false
+		for j := range routes {
+			if RoutesEq(&routes[j], &route) {
+				routes[j] = route
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+// serveHAR adds the routes of the posted HTTP Archive
+func (h *AdminHandler) serveHAR(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	reqs, err := ParseHAR(data)
+	if err == nil {
+		for i := range reqs {
+			reqs[i] = domainMap.RewriteRoute(reqs[i])
+		}
+		h.M.Lock()
+		err = h.addRoutes(reqs)
+		h.M.Unlock()
+	}
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	ret, _ := json.Marshal(reqs)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+// runHAR runs the har command:
+//
+//	mox har FILE
+//
+// It writes the exchanges in the HTTP Archive as routes to stdout
+func runHAR(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: mox har FILE")
+		os.Exit(1)
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	routes, err := ParseHAR(data)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for i := range routes {
+		routes[i] = domainMap.RewriteRoute(routes[i])
+	}
+	out, _ := json.MarshalIndent(routes, "", "    ")
+	fmt.Println(string(out))
+}
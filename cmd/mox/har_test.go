@@ -0,0 +1,77 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseHAR(t *testing.T) {
+	routes, err := ParseHAR([]byte(`{"log": {"entries": [
+	  {"request": {"method": "GET", "url": "https://api.test/users?id=1"},
+	   "response": {"status": 200, "headers": [{"name": ":status", "value": "200"}, {"name": "content-encoding", "value": "gzip"}, {"name": "x-trace", "value": "a"}],
+	    "content": {"mimeType": "application/json", "text": "{\"id\": 1}"}}},
+	  {"request": {"method": "GET", "url": "https://api.test/users?id=1"},
+	   "response": {"status": 200, "content": {"mimeType": "application/json", "text": "{\"id\": 2}"}}},
+	  {"request": {"method": "GET", "url": "https://api.test/logo"},
+	   "response": {"status": 200, "content": {"mimeType": "image/png", "text": "aGk=", "encoding": "base64"}}},
+	  {"request": {"method": "GET", "url": "data:text/plain,x"}, "response": {"status": 200}},
+	  {"request": {"method": "GET", "url": "https://api.test/aborted"}, "response": {"status": 0}}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes: %+v", len(routes), routes)
+	}
+	users := routes[0]
+	if users.Method != "GET" || users.Path != "/users" || len(users.Queries) != 1 || users.Queries[0] != (Pair{Key: "id", Value: "1"}) {
+		t.Errorf("route: %+v", users)
+	}
+	if users.Return.Body != `{"id": 2}` {
+		t.Errorf("later exchange did not replace the route: %q", users.Return.Body)
+	}
+	if v, _ := users.Return.Headers.headerValue("Content-Type"); v != "application/json" {
+		t.Errorf("content type: %q", v)
+	}
+	if routes[1].Return.Body != "hi" {
+		t.Errorf("base64 body: %q", routes[1].Return.Body)
+	}
+
+	tests := []string{
+		`{"log": {}}`,
+		`{"log": {"entries": [{"request": {"method": "GET", "url": "https://x/"}, "response": {"status": 200, "content": {"text": "!", "encoding": "base64"}}}]}}`,
+		`[`,
+	}
+	for _, x := range tests {
+		if _, err := ParseHAR([]byte(x)); err == nil {
+			t.Errorf("%s: expected an error", x)
+		}
+	}
+}
+
+func TestParseHARHeaders(t *testing.T) {
+	routes, err := ParseHAR([]byte(`{"log": {"entries": [
+	  {"request": {"method": "GET", "url": "http://x/a"},
+	   "response": {"status": 200, "headers": [{"name": ":status", "value": "200"}, {"name": "content-encoding", "value": "gzip"}, {"name": "x-trace", "value": "a"}]}}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := routes[0].Return.Headers
+	if len(headers) != 1 || headers[0] != (Pair{Key: "X-Trace", Value: "a"}) {
+		t.Errorf("got %v", headers)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type (
+	// DomainMapping maps URLs of a recorded upstream to another base URL
+	DomainMapping struct {
+		From string
+		To   string
+	}
+
+	// DomainMap is a list of domain mappings applied to recordings
+	DomainMap []DomainMapping
+)
+
+func (m *DomainMap) String() string {
+	s := make([]string, len(*m))
+	for i, x := range *m {
+		s[i] = x.From + "=" + x.To
+	}
+	return strings.Join(s, ",")
+}
+
+// Set adds a mapping of the form upstream=base
+func (m *DomainMap) Set(value string) error {
+	eq := strings.Index(value, "=")
+	if eq <= 0 {
+		return errors.New("expecting upstream=base, got " + value)
+	}
+	*m = append(*m, DomainMapping{From: value[:eq], To: strings.TrimSuffix(value[eq+1:], "/")})
+	return nil
+}
+
+// replaceAfter replaces URL prefixes of the mapping that follow the
+// delimiter, or start s if delim is empty
+func (x DomainMapping) replaceAfter(s, delim string) string {
+	for _, prefix := range hostPrefixes(x.From) {
+		if len(delim) == 0 {
+			if strings.HasPrefix(s, prefix) {
+				if end, ok := hostEnd(s, len(prefix)); ok {
+					return x.To + s[end:]
+				}
+			}
+			continue
+		}
+		s = replaceURLPrefix(s, delim+prefix, delim+x.To)
+	}
+	return s
+}
+
+// RewriteRoute rewrites hyperlinks to mapped upstreams in a recorded
+// route: Link, Location and Content-Location headers, and URL string
+// values in JSON bodies
+func (m DomainMap) RewriteRoute(r RouteRequest) RouteRequest {
+	if len(m) == 0 {
+		return r
+	}
+	headers := make(Pairs, len(r.Return.Headers))
+	isJSON := false
+	for i, h := range r.Return.Headers {
+		switch http.CanonicalHeaderKey(h.Key) {
+		case "Link":
+			for _, x := range m {
+				h.Value = x.replaceAfter(h.Value, "<")
+			}
+		case "Location", "Content-Location":
+			for _, x := range m {
+				h.Value = x.replaceAfter(h.Value, "")
+			}
+		case "Content-Type":
+			t, _, _ := mime.ParseMediaType(h.Value)
+			isJSON = strings.HasSuffix(t, "json")
+		}
+		headers[i] = h
+	}
+	r.Return.Headers = headers
+	if isJSON {
+		for _, x := range m {
+			r.Return.Body = x.replaceAfter(r.Return.Body, `"`)
+		}
+	}
+	return r
+}
+
+// BaseURL returns the scheme and host the request was sent to
+func BaseURL(request *http.Request) string {
+	if request.TLS != nil {
+		return "https://" + request.Host
+	}
+	return "http://" + request.Host
+}
+
+// hostPrefixes returns the URL prefixes for a host. A host without a
+// scheme matches both http and https
+func hostPrefixes(host string) []string {
+	host = strings.TrimSuffix(host, "/")
+	if strings.Contains(host, "://") {
+		return []string{host}
+	}
+	return []string{"https://" + host, "http://" + host}
+}
+
+// endsHost returns true if c cannot continue the host of a URL, like
+// the "/", ":", "?" or "#" after it, or a quote around the URL
+func endsHost(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return false
+	}
+	return !strings.ContainsRune(".-_~%@+", rune(c))
+}
+
+// hostEnd returns where the host of a URL that continues at s[i]
+// ends, after the port if there is one, and false if the host goes on
+func hostEnd(s string, i int) (int, bool) {
+	if i == len(s) {
+		return i, true
+	}
+	if !endsHost(s[i]) {
+		return i, false
+	}
+	if s[i] == ':' {
+		j := i + 1
+		for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+			j++
+		}
+		if j > i+1 {
+			return j, true
+		}
+	}
+	return i, true
+}
+
+// replaceURLPrefix replaces prefix with base where the host of the
+// prefix ends, so http://api.test does not match http://api.test.evil.
+// A port after the host is replaced with it
+func replaceURLPrefix(s, prefix, base string) string {
+	var out strings.Builder
+	for {
+		i := strings.Index(s, prefix)
+		if i < 0 {
+			break
+		}
+		end, ok := hostEnd(s, i+len(prefix))
+		out.WriteString(s[:i])
+		if ok {
+			out.WriteString(base)
+		} else {
+			out.WriteString(prefix)
+		}
+		s = s[end:]
+	}
+	out.WriteString(s)
+	return out.String()
+}
+
+// RewriteURLs replaces absolute URLs pointing to the given hosts with
+// URLs pointing to base
+func RewriteURLs(s string, hosts []string, base string) string {
+	for _, host := range hosts {
+		for _, prefix := range hostPrefixes(host) {
+			s = replaceURLPrefix(s, prefix, base)
+		}
+	}
+	return s
+}
+
+// RewriteHosts returns a copy of the response with absolute URLs to
+// the given hosts in headers and body pointing to base
+func (r ReturnData) RewriteHosts(hosts []string, base string) ReturnData {
+	if len(hosts) == 0 {
+		return r
+	}
+	headers := make(Pairs, len(r.Headers))
+	for i, h := range r.Headers {
+		headers[i] = Pair{Key: h.Key, Value: RewriteURLs(h.Value, hosts, base)}
+	}
+	r.Headers = headers
+	r.Body = RewriteURLs(r.Body, hosts, base)
+	return r
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRewriteURLs(t *testing.T) {
+	hosts := []string{"api.example.com"}
+	base := "http://localhost:8000"
+	tests := []struct{ in, want string }{
+		{"http://api.example.com", "http://localhost:8000"},
+		{"https://api.example.com/v1/users?x=1", "http://localhost:8000/v1/users?x=1"},
+		{"http://api.example.com:8080/x", "http://localhost:8000/x"},
+		{"http://api.example.com:8080", "http://localhost:8000"},
+		{`"http://api.example.com":1`, `"http://localhost:8000":1`},
+		{"http://api.example.com:/x", "http://localhost:8000:/x"},
+		{"http://api.example.com?x", "http://localhost:8000?x"},
+		{"http://api.example.com#top", "http://localhost:8000#top"},
+		{`{"next":"http://api.example.com"}`, `{"next":"http://localhost:8000"}`},
+		{"http://api.example.com.evil/x", "http://api.example.com.evil/x"},
+		{"http://api.example.comfoo", "http://api.example.comfoo"},
+		{"http://api.example.com-2/x", "http://api.example.com-2/x"},
+		{"a http://api.example.com.evil b http://api.example.com/c", "a http://api.example.com.evil b http://localhost:8000/c"},
+	}
+	for _, x := range tests {
+		if got := RewriteURLs(x.in, hosts, base); got != x.want {
+			t.Errorf("%s: got %s, expected %s", x.in, got, x.want)
+		}
+	}
+}
+
+func TestDomainMapRewriteRoute(t *testing.T) {
+	var m DomainMap
+	if err := m.Set("api.test=http://localhost:8000"); err != nil {
+		t.Fatal(err)
+	}
+	r := m.RewriteRoute(RouteRequest{Return: ReturnData{
+		Headers: Pairs{
+			{Key: "Content-Type", Value: "application/json"},
+			{Key: "Location", Value: "https://api.test:443/users/1"},
+			{Key: "Content-Location", Value: "https://api.testing.com/users/1"},
+			{Key: "Link", Value: `<https://api.test/p2>; rel="next", <https://api.test.evil/p3>; rel="last"`},
+		},
+		Body: `{"self": "http://api.test/u", "other": "http://api.test.evil/u", "more": "http://api.testing.com"}`,
+	}})
+	want := Pairs{
+		{Key: "Content-Type", Value: "application/json"},
+		{Key: "Location", Value: "http://localhost:8000/users/1"},
+		{Key: "Content-Location", Value: "https://api.testing.com/users/1"},
+		{Key: "Link", Value: `<http://localhost:8000/p2>; rel="next", <https://api.test.evil/p3>; rel="last"`},
+	}
+	for i, h := range r.Return.Headers {
+		if h != want[i] {
+			t.Errorf("got %s: %s, expected %s", h.Key, h.Value, want[i].Value)
+		}
+	}
+	if want := `{"self": "http://localhost:8000/u", "other": "http://api.test.evil/u", "more": "http://api.testing.com"}`; r.Return.Body != want {
+		t.Errorf("got %s", r.Return.Body)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"time"
+)
+
+type (
+	// Idempotency makes a route store the response for each
+	// idempotency key. A repeated request with the same key and payload
+	// gets the stored response, a request with the same key and a
+	// different payload gets 409
+	Idempotency struct {
+		// Header carries the key, Idempotency-Key by default
+		Header string `json:"header,omitempty"`
+		// TTL is how long responses are kept, as a duration. Forever
+		// if empty
+		TTL string `json:"ttl,omitempty"`
+	}
+
+	idempotentEntry struct {
+		fingerprint [sha256.Size]byte
+		response    ReturnData
+		expires     time.Time
+	}
+)
+
+func (i *Idempotency) header() string {
+	if len(i.Header) > 0 {
+		return i.Header
+	}
+	return "Idempotency-Key"
+}
+
+// fingerprint hashes the request method, URI and body, and restores
+// the body for later readers
+func fingerprint(request *http.Request) [sha256.Size]byte {
+	body := captureBody(request)
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	var ret [sha256.Size]byte
+	copy(ret[:], hash.Sum(nil))
+	return ret
+}
+
+// idempotent returns the stored response for the request. If there is
+// none, it stores the response computed by next. next runs without the
+// route state lock, as sequences and cached renders take it
+func (i *Idempotency) idempotent(st *RouteState, request *http.Request, next func() ReturnData) ReturnData {
+	key := request.Header.Get(i.header())
+	if len(key) == 0 {
+		return next()
+	}
+	fp := fingerprint(request)
+	now := time.Now()
+	st.Lock()
+	ret, ok := st.storedResponse(key, fp, now)
+	st.Unlock()
+	if ok {
+		return ret
+	}
+	entry := idempotentEntry{fingerprint: fp, response: next()}
+	if ttl, err := time.ParseDuration(i.TTL); err == nil && ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	st.Lock()
+	defer st.Unlock()
+	// A concurrent request with the same key may have stored its
+	// response first
+	if ret, ok := st.storedResponse(key, fp, now); ok {
+		return ret
+	}
+	if st.idempotent == nil {
+		st.idempotent = make(map[string]idempotentEntry)
+	}
+	st.idempotent[key] = entry
+	return entry.response
+}
+
+// storedResponse returns the response stored for the key, or 409 if
+// it was stored for a different request. The state must be locked
+func (st *RouteState) storedResponse(key string, fp [sha256.Size]byte, now time.Time) (ReturnData, bool) {
+	entry, ok := st.idempotent[key]
+	if !ok || !(entry.expires.IsZero() || now.Before(entry.expires)) {
+		return ReturnData{}, false
+	}
+	if entry.fingerprint != fp {
+		return ReturnData{Status: http.StatusConflict,
+			Headers: Pairs{{Key: "Content-Type", Value: "application/json"}},
+			Body:    `{"error":"conflict","message":"idempotency key reused with a different request"}`}, true
+	}
+	ret := entry.response
+	ret.Headers = append(append(Pairs(nil), ret.Headers...), Pair{Key: "Idempotent-Replayed", Value: "true"})
+	return ret, true
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveKey sends a POST with an idempotency key, failing the test if
+// it does not complete
+func serveKey(t *testing.T, a *AdminHandler, target, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", target, strings.NewReader(body))
+		request.Header.Set("Idempotency-Key", key)
+		a.M.ServeHTTP(rec, request)
+		done <- rec
+	}()
+	select {
+	case rec := <-done:
+		return rec
+	case <-time.After(2 * time.Second):
+		t.Fatalf("POST %s with key %s did not complete", target, key)
+	}
+	return nil
+}
+
+func TestIdempotentSequence(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{Method: "POST", Path: "/pay", Idempotency: &Idempotency{},
+		Sequence: []ReturnData{{Status: http.StatusCreated, Body: "first"}, {Status: http.StatusCreated, Body: "second"}}})
+	tests := []struct {
+		key, body, want string
+		status          int
+		replayed        bool
+	}{
+		{"k1", "a", "first", http.StatusCreated, false},
+		{"k1", "a", "first", http.StatusCreated, true},
+		{"k2", "a", "second", http.StatusCreated, false},
+		{"k1", "b", "", http.StatusConflict, false},
+	}
+	for _, x := range tests {
+		rec := serveKey(t, a, "/pay", x.key, x.body)
+		if rec.Code != x.status || (len(x.want) > 0 && rec.Body.String() != x.want) || (rec.Header().Get("Idempotent-Replayed") == "true") != x.replayed {
+			t.Errorf("key %s body %s: got %d %q %v", x.key, x.body, rec.Code, rec.Body.String(), rec.Header())
+		}
+	}
+	// Route changes are not blocked by the requests
+	a.M.Lock()
+	a.M.Unlock()
+}
+
+func TestIdempotentRenderCache(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{Method: "POST", Path: "/r", Idempotency: &Idempotency{}, RenderCache: &RenderCache{TTL: "1m"},
+		Return: ReturnData{Status: http.StatusOK, Template: true, Body: "{{.Request.Method}}"}})
+	if rec := serveKey(t, a, "/r", "k", ""); rec.Body.String() != "POST" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serveKey(t, a, "/r", "k", ""); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("response not replayed: %v", rec.Header())
+	}
+}
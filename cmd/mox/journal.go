@@ -0,0 +1,255 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// JournalEntry is a request received by the mock, and the route
+	// that served it
+	JournalEntry struct {
+		Time    time.Time `json:"time"`
+		Method  string    `json:"method"`
+		Path    string    `json:"path"`
+		Query   string    `json:"query,omitempty"`
+		Headers Pairs     `json:"headers,omitempty"`
+		Body    string    `json:"body,omitempty"`
+		// Route is the name of the route that served the request, or
+		// unmatchedRoute
+		Route string `json:"route"`
+		// RouteID is the id of the route that served the request
+		RouteID string `json:"routeId,omitempty"`
+		// Test is the correlation id of the request
+		Test string `json:"test,omitempty"`
+	}
+
+	// Journal keeps the last requests received by the mock
+	Journal struct {
+		sync.Mutex
+		// Size is the maximum number of entries, 0 to keep none
+		Size    int
+		entries []JournalEntry
+	}
+
+	// ReplayChange is a journal entry that is served by another
+	// route with the current routes
+	ReplayChange struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Query  string `json:"query,omitempty"`
+		Before string `json:"before"`
+		After  string `json:"after"`
+	}
+
+	// ReplayReport is the result of replaying a journal
+	ReplayReport struct {
+		Requests int            `json:"requests"`
+		Changed  []ReplayChange `json:"changed"`
+	}
+)
+
+// unmatchedRoute is the route name of requests that matched no route
+const unmatchedRoute = "unmatched"
+
+// Request returns the request of the journal entry
+func (e JournalEntry) Request() *http.Request {
+	request, _ := http.NewRequest(e.Method, "/", strings.NewReader(e.Body))
+	request.URL = &url.URL{Path: e.Path, RawQuery: e.Query}
+	request.RequestURI = request.URL.RequestURI()
+	for _, h := range e.Headers {
+		request.Header.Add(h.Key, h.Value)
+	}
+	return request
+}
+
+// matchedRoute returns the route that serves the request without
+// serving it, false if no route does
+func matchedRoute(router *mux.Router, request *http.Request) (RouteRequest, bool) {
+	var match mux.RouteMatch
+	if router == nil || !router.Match(request, &match) || match.MatchErr != nil {
+		return RouteRequest{}, false
+	}
+	if h, ok := match.Handler.(PassHandler); ok {
+		return matchedRoute(h.Next, h.passed(request))
+	}
+	return routeOf(match.Handler)
+}
+
+// matchRoute returns the name of the route that serves the request
+// without serving it
+func matchRoute(router *mux.Router, request *http.Request) string {
+	if r, ok := matchedRoute(router, request); ok {
+		return r.Name()
+	}
+	return unmatchedRoute
+}
+
+// correlation returns the value of the correlation header of the
+// request, empty if there is no correlation header
+func (h *MockHandler) correlation(request *http.Request) string {
+	if len(h.CorrelationHeader) == 0 {
+		return ""
+	}
+	return request.Header.Get(h.CorrelationHeader)
+}
+
+// Record adds the request with its correlation id and the route of
+// the router that serves it to the journal, dropping the oldest entry
+// if the journal is full
+func (j *Journal) Record(router *mux.Router, request *http.Request, test string) {
+	if j.Size <= 0 {
+		return
+	}
+	e := JournalEntry{Time: time.Now(),
+		Method: request.Method,
+		Path:   request.URL.Path,
+		Query:  request.URL.RawQuery,
+		Body:   string(captureBody(request)),
+		Route:  unmatchedRoute,
+		Test:   test}
+	for k, values := range request.Header {
+		for _, v := range values {
+			e.Headers = append(e.Headers, Pair{Key: k, Value: v})
+		}
+	}
+	if r, ok := matchedRoute(router, request); ok {
+		e.Route, e.RouteID = r.Name(), r.ID
+	}
+	j.Lock()
+	defer j.Unlock()
+	if len(j.entries) >= j.Size {
+		j.entries = append(j.entries[:0], j.entries[len(j.entries)-j.Size+1:]...)
+	}
+	j.entries = append(j.entries, e)
+}
+
+// Get returns the journal entries with the correlation id, or all
+// entries if test is empty, oldest first
+func (j *Journal) Get(test string) []JournalEntry {
+	j.Lock()
+	defer j.Unlock()
+	ret := make([]JournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if len(test) == 0 || e.Test == test {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// Reset clears the journal
+func (j *Journal) Reset() {
+	j.Lock()
+	j.entries = nil
+	j.Unlock()
+}
+
+// serveJournal returns the journal with GET, only the entries of a
+// correlation id with test=id, and clears it with DELETE
+func (h *AdminHandler) serveJournal(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		ret, _ := json.Marshal(h.M.Journal.Get(request.URL.Query().Get("test")))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(ret)
+	case http.MethodDelete:
+		h.M.Journal.Reset()
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Replay matches the journal entries with the current routes, and
+// reports the entries that would be served by a different route
+func (h *AdminHandler) Replay(entries []JournalEntry) ReplayReport {
+	h.M.RLock()
+	defer h.M.RUnlock()
+	var run Run
+	run.Reset()
+	report := ReplayReport{Requests: len(entries), Changed: []ReplayChange{}}
+	for _, e := range entries {
+		before := e.Route
+		if len(before) == 0 {
+			before = unmatchedRoute
+		}
+		after := matchRoute(h.M.Router, withArrival(e.Request(), &run))
+		if after != before {
+			report.Changed = append(report.Changed, ReplayChange{Method: e.Method, Path: e.Path, Query: e.Query, Before: before, After: after})
+		}
+	}
+	return report
+}
+
+func (h *AdminHandler) serveReplay(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var entries []JournalEntry
+	data, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	ret, _ := json.Marshal(h.Replay(entries))
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+// runReplay replays a journal file with the routes of the stub files
+func runReplay(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: mox replay JOURNAL [FILE...]")
+		os.Exit(1)
+	}
+	data, err := ioutil.ReadFile(args[0])
+	var entries []JournalEntry
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	a := AdminHandler{Routes: make([]*RouteRequest, 0), M: &MockHandler{}}
+	for _, f := range args[1:] {
+		if err := a.LoadFile(f); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	report := a.Replay(entries)
+	out, _ := json.MarshalIndent(report, "", "    ")
+	fmt.Println(string(out))
+	if len(report.Changed) > 0 {
+		os.Exit(2)
+	}
+}
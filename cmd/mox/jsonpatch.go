@@ -0,0 +1,258 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is an RFC 6902 JSON Patch operation
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyPatch applies an RFC 6902 JSON Patch to a JSON document. The
+// operations are applied in order, and the patch fails as a whole if
+// one of them fails
+func ApplyPatch(doc, patch []byte) ([]byte, error) {
+	var ops []PatchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+	var node interface{}
+	if err := json.Unmarshal(doc, &node); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		var err error
+		if node, err = op.apply(node); err != nil {
+			return nil, errors.New(op.Op + " " + op.Path + ": " + err.Error())
+		}
+	}
+	return json.Marshal(node)
+}
+
+func (op PatchOp) apply(doc interface{}) (interface{}, error) {
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value required")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		v, err := pointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	case "remove":
+	default:
+		return nil, errors.New("unknown operation")
+	}
+	switch op.Op {
+	case "add":
+		return pointerSet(doc, op.Path, value, true)
+	case "replace":
+		return pointerSet(doc, op.Path, value, false)
+	case "remove":
+		return pointerRemove(doc, op.Path)
+	case "move":
+		if op.Path == op.From {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		doc, err := pointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerSet(doc, op.Path, value, true)
+	case "copy":
+		// Copy through JSON so the copies do not share containers
+		data, _ := json.Marshal(value)
+		var dup interface{}
+		json.Unmarshal(data, &dup)
+		return pointerSet(doc, op.Path, dup, true)
+	}
+	v, err := pointerGet(doc, op.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(v, value) {
+		return nil, errors.New("test failed")
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into reference tokens
+func parsePointer(ptr string) ([]string, error) {
+	if len(ptr) == 0 {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, errors.New("invalid pointer: " + ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token. If end is true, "-" and
+// the array length are accepted to refer to the end of the array
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !end) || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.New("invalid array index: " + token)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, ptr string) (interface{}, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, errors.New("no such member: " + t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, errors.New("no such member: " + t)
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate replaces the parent of the value referenced by the
+// pointer with the result of fn, and returns the updated document
+func pointerUpdate(doc interface{}, tokens []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, errors.New("no such member: " + tokens[0])
+		}
+		v, err := pointerUpdate(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = v
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(tokens[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		v, err := pointerUpdate(node[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = v
+		return node, nil
+	}
+	return nil, errors.New("no such member: " + tokens[0])
+}
+
+// pointerSet adds or replaces the value referenced by the pointer. An
+// add inserts into arrays, a replace requires the value to exist
+func pointerSet(doc interface{}, ptr string, value interface{}, add bool) (interface{}, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok && !add {
+				return nil, errors.New("no such member: " + token)
+			}
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), add)
+			if err != nil {
+				return nil, err
+			}
+			if !add {
+				node[i] = value
+				return node, nil
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, errors.New("not a container: " + token)
+	})
+}
+
+func pointerRemove(doc interface{}, ptr string) (interface{}, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the document")
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, errors.New("no such member: " + token)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, errors.New("not a container: " + token)
+	})
+}
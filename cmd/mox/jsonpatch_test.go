@@ -0,0 +1,83 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	const doc = `{"a": 1, "b": {"c": [1, 2]}, "d~/e": "x"}`
+	tests := []struct {
+		patch string
+		want  string
+	}{
+		{`[]`, doc},
+		{`[{"op": "add", "path": "/f", "value": true}]`, `{"a": 1, "b": {"c": [1, 2]}, "d~/e": "x", "f": true}`},
+		{`[{"op": "add", "path": "/b/c/-", "value": 3}]`, `{"a": 1, "b": {"c": [1, 2, 3]}, "d~/e": "x"}`},
+		{`[{"op": "add", "path": "/b/c/0", "value": 0}]`, `{"a": 1, "b": {"c": [0, 1, 2]}, "d~/e": "x"}`},
+		{`[{"op": "remove", "path": "/b/c/1"}]`, `{"a": 1, "b": {"c": [1]}, "d~/e": "x"}`},
+		{`[{"op": "replace", "path": "/d~0~1e", "value": "y"}]`, `{"a": 1, "b": {"c": [1, 2]}, "d~/e": "y"}`},
+		{`[{"op": "move", "from": "/a", "path": "/b/a"}]`, `{"b": {"a": 1, "c": [1, 2]}, "d~/e": "x"}`},
+		{`[{"op": "copy", "from": "/b/c", "path": "/g"}]`, `{"a": 1, "b": {"c": [1, 2]}, "d~/e": "x", "g": [1, 2]}`},
+		{`[{"op": "test", "path": "/b", "value": {"c": [1, 2]}}]`, doc},
+		{`[{"op": "replace", "path": "", "value": [1]}]`, `[1]`},
+		{`[{"op": "test", "path": "/a", "value": 2}]`, ""},
+		{`[{"op": "replace", "path": "/missing", "value": 1}]`, ""},
+		{`[{"op": "remove", "path": "/b/c/2"}]`, ""},
+		{`[{"op": "add", "path": "/b/c/01", "value": 1}]`, ""},
+		{`[{"op": "move", "from": "/b", "path": "/b/c/x"}]`, ""},
+		{`[{"op": "add", "path": "/x"}]`, ""},
+		{`[{"op": "frob", "path": "/a"}]`, ""},
+		{`[{"op": "add", "path": "a", "value": 1}]`, ""},
+		{`[{"op": "add", "path": "/x", "value": 1}, {"op": "test", "path": "/x", "value": 2}]`, ""},
+		{`{`, ""},
+	}
+	for _, x := range tests {
+		out, err := ApplyPatch([]byte(doc), []byte(x.patch))
+		if len(x.want) == 0 {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", x.patch, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", x.patch, err)
+			continue
+		}
+		var got, want interface{}
+		json.Unmarshal(out, &got)
+		json.Unmarshal([]byte(x.want), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %s", x.patch, out)
+		}
+	}
+}
+
+func TestApplyPatchCopyIsDeep(t *testing.T) {
+	out, err := ApplyPatch([]byte(`{"a": {"b": 1}}`), []byte(`[
+	  {"op": "copy", "from": "/a", "path": "/c"},
+	  {"op": "replace", "path": "/c/b", "value": 2}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"a":{"b":1}`) {
+		t.Errorf("copy shares the value: %s", out)
+	}
+}
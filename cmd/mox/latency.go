@@ -0,0 +1,205 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Latency is a random delay drawn from a distribution. Durations are
+// strings like "120ms"
+type Latency struct {
+	// Distribution is uniform, normal or lognormal
+	Distribution string `json:"distribution"`
+	// Min and Max bound the delay. Uniform delays are between them
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+	// Median is the center of normal and lognormal delays
+	Median string `json:"median,omitempty"`
+	// StdDev is the standard deviation of normal delays
+	StdDev string `json:"stddev,omitempty"`
+	// Sigma is the shape of lognormal delays, the standard deviation
+	// of their logarithm. Larger values give longer tails
+	Sigma float64 `json:"sigma,omitempty"`
+}
+
+type (
+	// DelayProfile is a delay that changes with the time since the
+	// start of the run. It is either a linear ramp from From to To
+	// over Over, staying at To afterwards, or a list of steps
+	DelayProfile struct {
+		From  string      `json:"from,omitempty"`
+		To    string      `json:"to,omitempty"`
+		Over  string      `json:"over,omitempty"`
+		Steps []DelayStep `json:"steps,omitempty"`
+	}
+
+	// DelayStep is the delay from After since the start of the run
+	// until the next step
+	DelayStep struct {
+		After string `json:"after"`
+		Delay string `json:"delay"`
+	}
+)
+
+// Latency distributions
+const (
+	latencyUniform   = "uniform"
+	latencyNormal    = "normal"
+	latencyLognormal = "lognormal"
+)
+
+// durations parses the durations of the latency, zero if not given
+func (l *Latency) durations() (min, max, median, stddev time.Duration, err error) {
+	ds := []*time.Duration{&min, &max, &median, &stddev}
+	for i, s := range []string{l.Min, l.Max, l.Median, l.StdDev} {
+		if len(s) > 0 {
+			if *ds[i], err = time.ParseDuration(s); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Validate checks the distribution and its parameters
+func (l *Latency) Validate() error {
+	min, max, median, _, err := l.durations()
+	if err != nil {
+		return errors.New("latency: " + err.Error())
+	}
+	if max > 0 && max < min {
+		return errors.New("latency: max is less than min")
+	}
+	switch l.Distribution {
+	case latencyUniform:
+		if max == 0 {
+			return errors.New("latency: uniform needs max")
+		}
+	case latencyNormal:
+		if median == 0 {
+			return errors.New("latency: normal needs median")
+		}
+	case latencyLognormal:
+		if median == 0 || l.Sigma <= 0 {
+			return errors.New("latency: lognormal needs median and sigma")
+		}
+	default:
+		return errors.New("latency: unknown distribution " + l.Distribution)
+	}
+	return nil
+}
+
+// Sample draws a delay from the distribution, bounded by min and max
+func (l *Latency) Sample() time.Duration {
+	min, max, median, stddev, _ := l.durations()
+	var d float64
+	switch l.Distribution {
+	case latencyUniform:
+		d = float64(min) + rnd.Float64()*float64(max-min)
+	case latencyNormal:
+		d = float64(median) + rnd.NormFloat64()*float64(stddev)
+	case latencyLognormal:
+		d = float64(median) * math.Exp(rnd.NormFloat64()*l.Sigma)
+	}
+	if d < float64(min) {
+		d = float64(min)
+	}
+	if max > 0 && d > float64(max) {
+		d = float64(max)
+	}
+	return time.Duration(d)
+}
+
+// Validate checks the ramp or the steps of the profile
+func (p *DelayProfile) Validate() error {
+	if len(p.Steps) > 0 {
+		if len(p.From) > 0 || len(p.To) > 0 || len(p.Over) > 0 {
+			return errors.New("delayProfile: use either a ramp or steps")
+		}
+		var last time.Duration
+		for i, s := range p.Steps {
+			after, err := time.ParseDuration(s.After)
+			if err != nil {
+				return errors.New("delayProfile: " + err.Error())
+			}
+			if i > 0 && after <= last {
+				return errors.New("delayProfile: steps are not in order")
+			}
+			last = after
+			if _, err := time.ParseDuration(s.Delay); err != nil {
+				return errors.New("delayProfile: " + err.Error())
+			}
+		}
+		return nil
+	}
+	for _, s := range []string{p.From, p.To, p.Over} {
+		if _, err := time.ParseDuration(s); err != nil {
+			return errors.New("delayProfile: ramp needs from, to and over: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// At returns the delay of the profile at elapsed since the start of
+// the run
+func (p *DelayProfile) At(elapsed time.Duration) time.Duration {
+	if len(p.Steps) > 0 {
+		var d time.Duration
+		for _, s := range p.Steps {
+			after, _ := time.ParseDuration(s.After)
+			if elapsed < after {
+				break
+			}
+			d, _ = time.ParseDuration(s.Delay)
+		}
+		return d
+	}
+	from, _ := time.ParseDuration(p.From)
+	to, _ := time.ParseDuration(p.To)
+	over, _ := time.ParseDuration(p.Over)
+	if elapsed >= over || over <= 0 {
+		return to
+	}
+	return from + time.Duration(float64(to-from)*float64(elapsed)/float64(over))
+}
+
+// wait waits for the delay, the latency and the delay profile of the
+// response, and records the delay as a fault of the route. It returns
+// false if the request was canceled in the meantime
+func (ret ReturnData) wait(request *http.Request, stats *Stats, route string) bool {
+	d, _ := time.ParseDuration(ret.Delay)
+	if ret.Latency != nil {
+		d += ret.Latency.Sample()
+	}
+	if ret.DelayProfile != nil {
+		if a, ok := request.Context().Value(arrivalKey{}).(Arrival); ok {
+			d += ret.DelayProfile.At(a.Elapsed)
+		}
+	}
+	if d <= 0 {
+		return true
+	}
+	stats.RecordFault(route, faultDelay)
+	select {
+	case <-time.After(d):
+		return true
+	case <-request.Context().Done():
+		return false
+	}
+}
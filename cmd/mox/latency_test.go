@@ -0,0 +1,75 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDelayDoesNotHoldLock(t *testing.T) {
+	a := newTestAdmin(t,
+		RouteRequest{Method: "GET", Path: "/slow", Return: ReturnData{Status: http.StatusOK, Delay: "1s"}},
+		RouteRequest{Method: "GET", Path: "/fast", Return: ReturnData{Status: http.StatusOK}},
+	)
+	done := make(chan int)
+	go func() { done <- serve(a, "GET", "/slow", "").Code }()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	a.M.Lock()
+	a.M.Unlock()
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("route change waited %v for a delayed response", d)
+	}
+	start = time.Now()
+	if rec := serve(a, "GET", "/fast", ""); rec.Code != http.StatusOK {
+		t.Errorf("got %d", rec.Code)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("request waited %v for a delayed response", d)
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("delayed request got %d", code)
+	}
+	if n := a.M.Stats.route("GET /slow").Faults[faultDelay]; n != 1 {
+		t.Errorf("got %d delay faults, expected 1", n)
+	}
+	if n := a.M.Stats.route("GET /fast").Faults[faultDelay]; n != 0 {
+		t.Errorf("got %d delay faults without a delay", n)
+	}
+}
+
+func TestDelayProfileAt(t *testing.T) {
+	ramp := DelayProfile{From: "10ms", To: "2s", Over: "10s"}
+	steps := DelayProfile{Steps: []DelayStep{{After: "0s", Delay: "10ms"}, {After: "5s", Delay: "1s"}}}
+	tests := []struct {
+		p       *DelayProfile
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{&ramp, 0, 10 * time.Millisecond},
+		{&ramp, 5 * time.Second, 1005 * time.Millisecond},
+		{&ramp, time.Minute, 2 * time.Second},
+		{&steps, time.Second, 10 * time.Millisecond},
+		{&steps, 6 * time.Second, time.Second},
+	}
+	for _, x := range tests {
+		if got := x.p.At(x.elapsed); got != x.want {
+			t.Errorf("%+v at %v: got %v, expected %v", *x.p, x.elapsed, got, x.want)
+		}
+	}
+}
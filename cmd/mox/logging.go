@@ -0,0 +1,137 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Log levels of served requests
+const (
+	logNone    = "none"
+	logSummary = "summary"
+	logVerbose = "verbose"
+)
+
+// LogOptions overrides the log level of requests to a route
+type LogOptions struct {
+	// Level is none, summary (one line per request) or verbose
+	// (requests and responses with bodies)
+	Level string `json:"level,omitempty"`
+	// Sample is the fraction of requests logged, all if 0
+	Sample float64 `json:"sample,omitempty"`
+}
+
+// Validate checks the log level and the sample rate
+func (o *LogOptions) Validate() error {
+	if err := validLogLevel(o.Level); err != nil {
+		return err
+	}
+	if o.Sample < 0 || o.Sample > 1 {
+		return errors.New("log sample must be between 0 and 1")
+	}
+	return nil
+}
+
+func validLogLevel(level string) error {
+	switch level {
+	case "", logNone, logSummary, logVerbose:
+		return nil
+	}
+	return errors.New("unknown log level: " + level)
+}
+
+// logLevel returns the level a request to the route is logged with,
+// which is none if the request is not sampled
+func (h MockReqHandler) logLevel() string {
+	level := h.m.LogLevel
+	if h.R.Log == nil {
+		return level
+	}
+	if len(h.R.Log.Level) > 0 {
+		level = h.R.Log.Level
+	}
+	if h.R.Log.Sample > 0 && rnd.Float64() >= h.R.Log.Sample {
+		return logNone
+	}
+	return level
+}
+
+// loggingWriter keeps the status and the body of a response for the
+// log
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	// body keeps the response body for verbose logging, nil otherwise
+	body *bytes.Buffer
+}
+
+func (w *loggingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggingWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.body != nil {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// logDisconnect logs a client that closed the connection before the
+// response was complete, unless the request is not logged
+func (h MockReqHandler) logDisconnect(level string, elapsed time.Duration) {
+	if level != logNone && len(level) > 0 {
+		fmt.Printf("mox: client disconnected from %s after %v\n", h.R.Name(), elapsed)
+	}
+}
+
+// logViolation logs a response that violated the spec, unless the
+// request is not logged
+func (h MockReqHandler) logViolation(level, msg string) {
+	if level != logNone && len(level) > 0 {
+		fmt.Println(msg)
+	}
+}
+
+// logRequest logs a served request. dump is the request dump for
+// verbose logging
+func (h MockReqHandler) logRequest(request *http.Request, w *loggingWriter, dump []byte, elapsed time.Duration) {
+	fmt.Printf("mox: %s %s -> %d [%s] %v\n", request.Method, request.URL.RequestURI(), w.status, h.R.Name(), elapsed)
+	if w.body == nil {
+		return
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.Write(dump)
+	fmt.Fprintf(buf, "\n--\n%d %s\n", w.status, http.StatusText(w.status))
+	w.Header().Write(buf)
+	buf.WriteString("\n")
+	buf.Write(w.body.Bytes())
+	buf.WriteString("\n--\n")
+	os.Stdout.Write(buf.Bytes())
+	putBuffer(w.body)
+	w.body = nil
+}
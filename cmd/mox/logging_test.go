@@ -0,0 +1,69 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what f prints
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = old
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+func TestDisconnectLogLevel(t *testing.T) {
+	tests := []struct {
+		global string
+		route  *LogOptions
+		logged bool
+	}{
+		{logNone, nil, false},
+		{"", nil, false},
+		{logSummary, nil, true},
+		{logSummary, &LogOptions{Level: logNone}, false},
+		{logNone, &LogOptions{Level: logVerbose}, true},
+	}
+	for _, x := range tests {
+		a := newTestAdmin(t, RouteRequest{Method: "GET", Path: "/x", Log: x.route, Return: ReturnData{Status: 200}})
+		a.M.LogLevel = x.global
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		out := captureStdout(t, func() {
+			a.M.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x", nil).WithContext(ctx))
+		})
+		if got := strings.Contains(out, "client disconnected"); got != x.logged {
+			t.Errorf("level %q, route %+v: got %q", x.global, x.route, out)
+		}
+		if n := a.M.Stats.route("GET /x").Disconnects; n != 1 {
+			t.Errorf("got %d disconnects", n)
+		}
+	}
+}
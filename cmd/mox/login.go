@@ -0,0 +1,181 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type (
+	// Login makes a route behave like a login endpoint. It checks the
+	// user name and password in a JSON or form body, delays failed
+	// attempts, and after repeated failures asks for a captcha or locks
+	// the account. Successful logins get the route response
+	Login struct {
+		// Accounts maps user names to passwords
+		Accounts map[string]string `json:"accounts"`
+		// UserField and PasswordField are the body fields with the
+		// credentials, username and password by default
+		UserField     string `json:"userField,omitempty"`
+		PasswordField string `json:"passwordField,omitempty"`
+		// FailDelay delays responses to failed attempts, as a duration
+		FailDelay string `json:"failDelay,omitempty"`
+		// CaptchaAfter asks for the captcha after this many failed
+		// attempts in a row, 0 never
+		CaptchaAfter int `json:"captchaAfter,omitempty"`
+		// Captcha is the accepted answer in the captcha field
+		Captcha string `json:"captcha,omitempty"`
+		// CaptchaField is the body field with the answer, captcha by
+		// default
+		CaptchaField string `json:"captchaField,omitempty"`
+		// LockAfter locks the account after this many failed attempts
+		// in a row, 0 never
+		LockAfter int `json:"lockAfter,omitempty"`
+		// LockFor is how long an account stays locked, as a duration.
+		// Until the route state is reset if empty
+		LockFor string `json:"lockFor,omitempty"`
+	}
+
+	// loginAccount is the state of an account
+	loginAccount struct {
+		failures    int
+		lockedUntil time.Time
+		locked      bool
+	}
+)
+
+// Validate checks the login definition
+func (l *Login) Validate() error {
+	if len(l.Accounts) == 0 {
+		return errors.New("login: accounts required")
+	}
+	for _, d := range []string{l.FailDelay, l.LockFor} {
+		if len(d) > 0 {
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("login: %s", err)
+			}
+		}
+	}
+	if l.CaptchaAfter > 0 && len(l.Captcha) == 0 {
+		return errors.New("login: captchaAfter needs a captcha")
+	}
+	return nil
+}
+
+// orDefault returns name, or def if name is empty
+func orDefault(name, def string) string {
+	if len(name) > 0 {
+		return name
+	}
+	return def
+}
+
+// loginFields returns the fields of a JSON object or form body
+func loginFields(request *http.Request) map[string]string {
+	body := captureBody(request)
+	ret := make(map[string]string)
+	var obj map[string]interface{}
+	if err := json.Unmarshal(body, &obj); err == nil {
+		for k, v := range obj {
+			if s, ok := v.(string); ok {
+				ret[k] = s
+			}
+		}
+		return ret
+	}
+	if values, err := url.ParseQuery(string(body)); err == nil {
+		for k := range values {
+			ret[k] = values.Get(k)
+		}
+	}
+	return ret
+}
+
+// Check checks the credentials of the request, keeping failed
+// attempts in the route state. If the login fails, it writes the
+// error response and returns false
+func (l *Login) Check(st *RouteState, writer http.ResponseWriter, request *http.Request) bool {
+	fields := loginFields(request)
+	user := fields[orDefault(l.UserField, "username")]
+	now := time.Now()
+
+	st.Lock()
+	if st.logins == nil {
+		st.logins = make(map[string]*loginAccount)
+	}
+	acct, ok := st.logins[user]
+	if !ok {
+		acct = &loginAccount{}
+		st.logins[user] = acct
+	}
+	if acct.locked && !acct.lockedUntil.IsZero() && !now.Before(acct.lockedUntil) {
+		*acct = loginAccount{}
+	}
+	if acct.locked {
+		until := acct.lockedUntil
+		st.Unlock()
+		if !until.IsZero() {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(until.Sub(now)/time.Second)+1))
+		}
+		return l.fail(writer, request, http.StatusLocked, "account_locked", "the account is locked")
+	}
+	code, msg := "invalid_credentials", "invalid user name or password"
+	password, ok := l.Accounts[user]
+	ok = ok && hmac.Equal([]byte(password), []byte(fields[orDefault(l.PasswordField, "password")]))
+	if l.CaptchaAfter > 0 && acct.failures >= l.CaptchaAfter {
+		if !hmac.Equal([]byte(fields[orDefault(l.CaptchaField, "captcha")]), []byte(l.Captcha)) {
+			ok = false
+			code, msg = "captcha_required", "solve the captcha to continue"
+		}
+	}
+	if ok {
+		*acct = loginAccount{}
+		st.Unlock()
+		return true
+	}
+	acct.failures++
+	if l.LockAfter > 0 && acct.failures >= l.LockAfter {
+		acct.locked = true
+		if d, err := time.ParseDuration(l.LockFor); err == nil && d > 0 {
+			acct.lockedUntil = now.Add(d)
+		}
+	}
+	st.Unlock()
+	return l.fail(writer, request, http.StatusUnauthorized, code, msg)
+}
+
+// fail waits for the failure delay, and writes the error response
+func (l *Login) fail(writer http.ResponseWriter, request *http.Request, status int, code, msg string) bool {
+	releaseLock(request)
+	if d, err := time.ParseDuration(l.FailDelay); err == nil && d > 0 {
+		select {
+		case <-time.After(d):
+		case <-request.Context().Done():
+			return false
+		}
+	}
+	data, _ := json.Marshal(authError{Error: code, Message: msg})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(data)
+	return false
+}
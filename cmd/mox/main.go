@@ -15,14 +15,22 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httputil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,21 +38,184 @@ import (
 )
 
 var (
-	adminPort = flag.String("adm", "8001", "Admin port (8001)")
-	mockPort  = flag.String("port", "8000", "Port (8000)")
+	adminPort  = flag.String("adm", "8001", "Admin port (8001), or host:port to listen on a specific address")
+	mockPort   = flag.String("port", "8000", "Port (8000)")
+	strict     = flag.Bool("strict", false, "Strict mode: unmatched requests fail /verify/all")
+	strict501  = flag.Bool("strict-501", false, "In strict mode, return 501 for unmatched requests")
+	maxRoutes  = flag.Int("max-routes", 0, "Maximum number of routes, 0 for no limit")
+	webhook    = flag.String("webhook", "", "URL to POST notifications of route changes and verification failures")
+	specFile   = flag.String("spec", "", "OpenAPI spec (JSON or YAML) to validate stub responses against")
+	wireMock   = flag.String("wiremock", "", "WireMock root directory, or directory or file of mappings, to load translated to routes. Bodies are read from its __files directory unless -files is given")
+	importSpec = flag.String("openapi", "", "OpenAPI spec (JSON or YAML) to generate routes for, returning examples of every operation after the routes of stub files")
+	apiPrefix  = flag.String("openapi-prefix", "", "Path prefix of the routes generated with -openapi")
+	validate   = flag.String("validate", validateRegister, "With -spec, validate responses when routes are registered (register) or served (serve)")
+	rwHosts    = flag.String("rewrite-hosts", "", "Comma separated hosts whose absolute URLs in responses point to mox instead")
+	tlsPort    = flag.String("tls-port", "", "Port for a TLS listener serving the mocked routes, with certificates selected by SNI name")
+	tlsCert    = flag.String("tls-cert", "", "Certificate file of the TLS listener for names without an -sni-cert, instead of certificates issued by the mox CA")
+	tlsKey     = flag.String("tls-key", "", "Key file of -tls-cert")
+	clientCert = flag.String("tls-client-cert", "", "Client certificates on -tls-port: request to ask for one, or require to refuse connections without one")
+	clientCA   = flag.String("tls-client-ca", "", "PEM file of the CAs client certificates on -tls-port are verified with")
+	tlsALPN    = flag.String("tls-alpn", "h2,http/1.1", "Application protocols offered by the TLS listener. Use http/1.1 to refuse HTTP/2")
+	errBodies  = flag.String("error-bodies", "", "JSON file of body templates for error responses without a body, by status or class like 4xx")
+	routeHdrs  = flag.Bool("route-headers", false, "Add X-Mox-Route-Id and X-Mox-Match-Time headers to responses, identifying the route and how long matching took")
+	stealth    = flag.Bool("stealth", false, "Remove the headers that identify mox from responses of the mock port")
+	serverHdr  = flag.String("server-header", "", "Server header of responses of the mock port, like nginx/1.25.3")
+	fallbacks  = flag.String("fallbacks", "", "JSON file of the notFound and methodNotAllowed responses to requests that match no route")
+	manifest   = flag.String("manifest", "", "sha256sum manifest that stub files given on the command line must match")
+	manifestPK = flag.String("manifest-key", "", "ed25519 public key file. The manifest must be signed with the key in MANIFEST.sig")
+	optionsM   = flag.String("options", "", "Set to auto to answer OPTIONS requests without a route with the methods the path has routes for")
+	traceM     = flag.String("trace", "", "TRACE requests without a route: echo to return the request, or reject for 405")
+	connectM   = flag.String("connect", methodReject, "CONNECT requests: reject for 405, tunnel to serve the requests in the tunnel from the mock, or intercept to also serve HTTPS requests with certificates from the mox CA")
+	egressOn   = flag.Bool("egress-guard", false, "Block and report calls to real services for unmatched requests, except to the -egress-allow hosts")
+	caFile     = flag.String("ca-file", "", "PEM file with the certificate and key of the mox CA, generated and saved if it does not exist, so trust stores keep trusting mox across restarts")
+	socksPort  = flag.String("socks-port", "", "Port for a SOCKS5 proxy serving the requests sent through it from the mock, HTTPS requests with certificates from the mox CA")
+	mappings   = flag.String("mappings", "", "Directory to load the stub files of, like stub files given as arguments. Directory arguments work the same")
+	watch      = flag.Duration("watch", time.Second, "Interval to check directories of stub files for changes and reload their routes, 0 not to watch")
+	persistDir = flag.String("persist", "", "Directory to save the routes added with the admin API to, and load them from at startup")
+	refresh    = flag.Duration("refresh", 0, "Interval to fetch remote stub files again and replace their routes if they changed")
+	maxConns   = flag.Int("max-conns", 0, "Maximum number of open connections to the mock, 0 for no limit. Connections over the limit get 503")
+	maxConnsIP = flag.Int("max-conns-per-ip", 0, "Maximum number of open connections to the mock from one client IP, 0 for no limit")
+	matchMax   = flag.Int("match-cache", 0, "Number of request signatures to cache matched routes for, 0 to match every request")
+	logLevel   = flag.String("log", logNone, "Log level of served requests: none, summary or verbose. Routes can override it")
+	admPublic  = flag.Bool("admin-public", false, "Listen for admin requests on all interfaces instead of localhost only")
+	cueBin     = flag.String("cue", "cue", "The cue command used to evaluate .cue stub files")
+	journalMax = flag.Int("journal", 1000, "Number of received requests to keep in the journal at /journal, 0 to keep none")
+	unmatchMax = flag.Int("unmatched", 1000, "Number of unmatched requests to keep for verification and /stats, 0 for no limit")
+	proxyURL   = flag.String("proxy", "", "Upstream base URL to forward requests no route matches to, recording the exchanges as routes at /recordings")
+	proxyAll   = flag.Bool("proxy-all", false, "With -proxy, forward all requests instead of the ones no route matches")
+	recordFile = flag.String("record", "", "With -proxy, file to save the recorded routes to")
+	cassettes  = flag.String("cassettes", "", "Directory of cassettes, per-test recording files that unmatched requests are replayed from, and with -proxy recorded to. Select one at /cassette or with -cassette-header")
+	cassetteHd = flag.String("cassette-header", "X-Mox-Cassette", "With -cassettes, request header naming the cassette of the request instead of the active one")
+	ordered    = flag.Bool("cassette-ordered", false, "With -cassettes, replay every cassette in the recorded order, failing requests that are not the next interaction")
+	warmStart  = flag.Bool("warm-start", false, "With -record, serve the routes recorded in earlier runs and forward only the requests they do not match, adding their recordings to the file")
+	corrHdr    = flag.String("correlation-header", "", "Request header, like X-Test-Id, whose value scopes the journal and verification to a test with test=id")
+	filesRoot  = flag.String("files", ".", "Root directory of the bodyFile files of responses")
+	filesCache = flag.Bool("files-cache", false, "Cache bodyFile files, reading them again only when they change")
+	dnsPort    = flag.String("dns-port", "", "UDP port for a DNS server answering the -dns-name host names with the address of mox")
+	dnsIP      = flag.String("dns-ip", "", "Address the DNS server answers with for names without one, the outbound address of the host by default")
+	dnsForward = flag.String("dns-forward", "", "DNS server, host:port, queries for other names are relayed to. Without it they are refused")
 )
 
+var (
+	stubs     stubFlags
+	domainMap DomainMap
+	badTLS    BadTLSFlags
+	sniCerts  SNICerts
+	forwards  Forwards
+	dnsNames  = DNSNames{}
+	allowlist EgressAllow
+)
+
+func init() {
+	flag.Var(&badTLS, "bad-tls", "Invalid TLS behavior for an SNI name on -tls-port: 'name=expired|self-signed|wrong-host|weak'. May be repeated")
+	flag.Var(&sniCerts, "sni-cert", "Certificate for an SNI name on -tls-port: 'name=certFile,keyFile'. May be repeated")
+	flag.Var(&stubs, "stub", "One-line stub: 'METHOD PATH -> STATUS [BODY]'. May be repeated")
+	flag.Var(&forwards, "forward", "Forward requests under a path prefix that match no route to a real service: '/prefix=url', '/=url' for all paths. May be repeated")
+	flag.Var(templateKeys, "template-key", "AES key of the encrypt and decrypt template functions: 'name=hexkey' with 16, 24 or 32 bytes. May be repeated")
+	flag.Var(&domainMap, "map-domain", "Rewrite links to an upstream in recordings: 'upstream=base'. May be repeated")
+	flag.Var(&allowlist, "egress-allow", "Host the egress guard lets unmatched requests through to: 'host' or '*.domain'. May be repeated")
+	flag.Var(dnsNames, "dns-name", "Host name the DNS server on -dns-port answers: 'name', 'name=ip', or '*.domain' for all its subdomains. May be repeated")
+}
+
+// ErrTooManyRoutes is returned when adding routes would exceed the
+// maximum number of routes
+var ErrTooManyRoutes = errors.New("too many routes")
+
 type (
 	// AdminHandler manages mocked routes
 	AdminHandler struct {
 		Routes []*RouteRequest
 		M      *MockHandler
+		// MaxRoutes is the maximum number of routes, 0 for no limit
+		MaxRoutes int
+		// Sources are the remote stub files the routes are loaded from
+		Sources []*RemoteSource
+		// Mappings are the stub file directories the routes are loaded
+		// from
+		Mappings []*MappingsDir
+		// Manifest, if set, verifies loaded stub files
+		Manifest *Manifest
+		// PersistFile, if set, is where the routes added with the
+		// admin API are saved when the routes change
+		PersistFile string
 	}
 
 	// MockHandler mocks routes in adminHandler
 	MockHandler struct {
 		sync.RWMutex
 		Router *mux.Router
+		// Strict mode fails verification if there are unmatched requests
+		Strict bool
+		// Strict501 returns 501 for unmatched requests in strict mode
+		Strict501 bool
+		Unmatched Unmatched
+		Received  Received
+		Journal   Journal
+		Clock     Clock
+		Stats     Stats
+		Conns     ConnTracker
+		States    States
+		Scenarios Scenarios
+		Vars      Variables
+		// Tokens are the access tokens issued by token routes
+		Tokens Tokens
+		// Chaos injects faults into the responses of all routes
+		Chaos Chaos
+		// Violations are the served responses that violated Spec
+		Violations SpecViolations
+		// Proxy, if set, forwards unmatched or all requests to an
+		// upstream and records the exchanges
+		Proxy *Proxy
+		// Cassettes replay unmatched requests from per-test recording
+		// files
+		Cassettes Cassettes
+		// Forwards pass unmatched requests under path prefixes through
+		// to real services
+		Forwards Forwards
+		// Egress guards the calls to real services
+		Egress Egress
+		// CorrelationHeader is the request header that identifies the
+		// test a request belongs to in the journal and verification
+		CorrelationHeader string
+		// Notifier receives state change events, may be nil
+		Notifier *Notifier
+		// Spec is the OpenAPI spec responses are validated against
+		Spec *OpenAPI
+		// ValidateMode is validateRegister or validateServe
+		ValidateMode string
+		// RewriteHosts lists hosts whose absolute URLs in all responses
+		// are rewritten to point to the mock server
+		RewriteHosts []string
+		// CA issues certificates for TLS listeners, nil if there are none
+		CA *CertAuthority
+		// TunnelTLS terminates TLS in intercepted CONNECT and SOCKS
+		// tunnels, nil if there are none
+		TunnelTLS *tls.Config
+		// Run tracks request arrival for route time predicates
+		Run Run
+		// ErrorBodies gives the bodies of error responses without one
+		ErrorBodies ErrorBodies
+		// Fallbacks are the responses to unmatched requests, may be
+		// nil. DefaultFallbacks are restored by a reset
+		Fallbacks        *Fallbacks
+		DefaultFallbacks *Fallbacks
+		// LogLevel is the log level of routes without a log override
+		LogLevel string
+		// Matches caches matched routes if MatchCacheSize is not 0
+		Matches        *MatchCache
+		MatchCacheSize int
+		// Limits limits connections to the mock, may be nil
+		Limits *ConnLimits
+		// Methods answers OPTIONS, TRACE and CONNECT requests without
+		// routes
+		Methods MethodControls
+		// RouteHeaders adds the id of the route and the matching time
+		// to responses
+		RouteHeaders bool
+		// Stealth removes the headers identifying mox from responses
+		Stealth bool
+		// ServerHeader is the Server header of responses, if set
+		ServerHeader string
 	}
 
 	// Pair is key-value pair, keys may be repeated so can't use map
@@ -61,15 +232,129 @@ type (
 		Status  int    `json:"status"`
 		Headers Pairs  `json:"headers"`
 		Body    string `json:"body"`
+		// BodyFile reads the body from this file under the files root
+		// instead
+		BodyFile string `json:"bodyFile,omitempty"`
+		// PadTo pads the body to this many bytes
+		PadTo int `json:"padTo,omitempty"`
+		// Problem returns an RFC 7807 problem document as the body
+		Problem *Problem `json:"problem,omitempty"`
+		// Template makes the body and header values text/templates
+		// executed with TemplateData
+		Template bool `json:"template,omitempty"`
+		// Delay waits before the response is written, as a duration
+		// like "500ms"
+		Delay string `json:"delay,omitempty"`
+		// Latency adds a random delay drawn from a distribution
+		Latency *Latency `json:"latency,omitempty"`
+		// DelayProfile adds a delay that changes during the run
+		DelayProfile *DelayProfile `json:"delayProfile,omitempty"`
+		// Checksums lists the headers computed from the final body:
+		// etag, content-md5 and digest
+		Checksums []string `json:"checksums,omitempty"`
 	}
 
 	// RouteRequest specifies a route and what to return
 	RouteRequest struct {
+		// ID identifies the route in admin requests
+		ID      string     `json:"id,omitempty"`
 		Headers Pairs      `json:"headers"`
 		Method  string     `json:"method"`
 		Path    string     `json:"path"`
 		Queries Pairs      `json:"queries"`
 		Return  ReturnData `json:"return"`
+		// MaxConcurrent is the maximum number of requests served
+		// concurrently. Requests beyond this get 503. 0 for no limit
+		MaxConcurrent int `json:"maxConcurrent,omitempty"`
+		// Action is empty to return the response, "pass" to add
+		// the response headers and continue matching later routes, or
+		// "rewrite" to change the request and match it again
+		Action string `json:"action,omitempty"`
+		// Rewrite describes the changes for the rewrite action
+		Rewrite *Rewrite `json:"rewrite,omitempty"`
+		// Auth enforces authentication before the response is returned
+		Auth *AuthPreset `json:"auth,omitempty"`
+		// Login simulates a login endpoint with failure delays,
+		// captchas and account lockout
+		Login *Login `json:"login,omitempty"`
+		// Token makes the route an OAuth 2.0 token endpoint
+		Token *TokenIssuer `json:"token,omitempty"`
+		// RateLimit limits requests with a token bucket and emits
+		// rate limit headers
+		RateLimit *RateLimit `json:"rateLimit,omitempty"`
+		// Breaker fails fast after consecutive 5xx responses, like
+		// an upstream with a circuit breaker
+		Breaker *Breaker `json:"breaker,omitempty"`
+		// Echo reflects request headers and a body hash into
+		// response headers
+		Echo *Echo `json:"echo,omitempty"`
+		// Timeout overrides the server write timeout for the response,
+		// as a duration like "10m"
+		Timeout string `json:"timeout,omitempty"`
+		// StaticDir serves files of a directory under the path prefix
+		StaticDir *StaticDir `json:"staticDir,omitempty"`
+		// RewriteHosts lists hosts whose absolute URLs in the response
+		// are rewritten to point to the mock server
+		RewriteHosts []string `json:"rewriteHosts,omitempty"`
+		// Host restricts the route to requests for this host, a
+		// template like {tenant}.example.com
+		Host string `json:"host,omitempty"`
+		// SNI restricts the route to TLS requests for this SNI name
+		SNI string `json:"sni,omitempty"`
+		// ClientCert restricts the route to TLS requests with a
+		// matching client certificate
+		ClientCert *ClientCertMatch `json:"clientCert,omitempty"`
+		// Variants are weighted alternative responses. If given,
+		// Return is not used
+		Variants []Variant `json:"variants,omitempty"`
+		// Sequence gives the responses of successive calls. If given,
+		// Return is not used
+		Sequence []ReturnData `json:"sequence,omitempty"`
+		// SequenceMode is repeatLast (default) to keep returning the
+		// last response after the sequence, or cycle to start over
+		SequenceMode string `json:"sequenceMode,omitempty"`
+		// Schedule gives responses for daily time windows of the
+		// virtual clock, overriding Return and Variants
+		Schedule []Window `json:"schedule,omitempty"`
+		// Idempotency replays stored responses for repeated
+		// idempotency keys
+		Idempotency *Idempotency `json:"idempotency,omitempty"`
+		// Cache adds caching headers and answers conditional requests
+		Cache *CacheControl `json:"cache,omitempty"`
+		// RenderCache reuses rendered responses of templated routes
+		RenderCache *RenderCache `json:"renderCache,omitempty"`
+		// When restricts the route to a part of the test run
+		When *When `json:"when,omitempty"`
+		// Body restricts the route to requests with a matching body
+		Body *BodyMatch `json:"body,omitempty"`
+		// JSONBody restricts the route to requests with a JSON body
+		// that contains the given fields or matches JSONPath predicates
+		JSONBody *JSONBodyMatch `json:"jsonBody,omitempty"`
+		// Match restricts the route to requests a boolean combination
+		// of matchers holds for, in addition to the other matchers
+		Match *MatchExpr `json:"match,omitempty"`
+		// GRPCWeb makes the route a gRPC-Web method
+		GRPCWeb *GRPCWeb `json:"grpcWeb,omitempty"`
+		// Scenario names the scenario of the route. Body templates
+		// can refer to earlier exchanges in the same scenario
+		Scenario string `json:"scenario,omitempty"`
+		// RequiredState restricts the route to requests when the
+		// scenario is in the given state
+		RequiredState string `json:"requiredState,omitempty"`
+		// NewState is the state the scenario moves to after the
+		// route serves a request
+		NewState string `json:"newState,omitempty"`
+		// Capture stores values of the request in variables
+		Capture []Capture `json:"capture,omitempty"`
+		// Vars restricts the route to requests when the variables
+		// have the given values
+		Vars Pairs `json:"vars,omitempty"`
+		// Log overrides the log level for requests to the route
+		Log *LogOptions `json:"log,omitempty"`
+
+		// source is the stub file or source the route was loaded
+		// from, empty for routes added with the admin API
+		source string
 	}
 )
 
@@ -99,6 +384,52 @@ func (p Pairs) ToA() []string {
 	return ret
 }
 
+// Validate checks the problem, delays and templates of the response
+func (ret ReturnData) Validate() error {
+	if ret.Problem != nil {
+		if err := ret.Problem.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(ret.Delay) > 0 {
+		if _, err := time.ParseDuration(ret.Delay); err != nil {
+			return err
+		}
+	}
+	if ret.Latency != nil {
+		if err := ret.Latency.Validate(); err != nil {
+			return err
+		}
+	}
+	if ret.DelayProfile != nil {
+		if err := ret.DelayProfile.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateChecksums(ret.Checksums); err != nil {
+		return err
+	}
+	if len(ret.BodyFile) > 0 {
+		if len(ret.Body) > 0 {
+			return errors.New("body and bodyFile are exclusive")
+		}
+		if err := bodyFiles.Validate(ret.BodyFile); err != nil {
+			return err
+		}
+	}
+	if ret.Template {
+		if _, err := parseTemplate(ret.Body); err != nil {
+			return err
+		}
+		for _, h := range ret.Headers {
+			if _, err := parseTemplate(h.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // BuildRoute builds a route from the request
 func (r RouteRequest) BuildRoute(router *mux.Router) (*mux.Route, error) {
 	if router == nil {
@@ -107,11 +438,137 @@ func (r RouteRequest) BuildRoute(router *mux.Router) (*mux.Route, error) {
 	if len(r.Path) == 0 {
 		return nil, errors.New("path required")
 	}
-	route := router.Path(r.Path)
+	switch r.Action {
+	case "", ActionPass:
+	case ActionRewrite:
+		if !validRewrite(r.Rewrite) {
+			return nil, errors.New("rewrite action needs a rewrite with an absolute path")
+		}
+	default:
+		return nil, errors.New("unknown action: " + r.Action)
+	}
+	if r.Auth != nil {
+		if err := r.Auth.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.Login != nil {
+		if err := r.Login.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.Token != nil {
+		if err := r.Token.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.RateLimit != nil {
+		if err := r.RateLimit.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.Breaker != nil {
+		if err := r.Breaker.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.Timeout) > 0 {
+		if _, err := time.ParseDuration(r.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateVariants(r.Variants); err != nil {
+		return nil, err
+	}
+	if err := r.validateSequence(); err != nil {
+		return nil, err
+	}
+	for _, w := range r.Schedule {
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.Idempotency != nil && len(r.Idempotency.TTL) > 0 {
+		if _, err := time.ParseDuration(r.Idempotency.TTL); err != nil {
+			return nil, err
+		}
+	}
+	if r.Cache != nil {
+		if err := r.Cache.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.RenderCache != nil {
+		if err := r.RenderCache.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.When != nil {
+		if err := r.When.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.Match != nil {
+		if err := r.Match.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.Body != nil {
+		if err := r.Body.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.JSONBody != nil {
+		if err := r.JSONBody.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.ClientCert != nil {
+		if err := r.ClientCert.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if r.GRPCWeb != nil {
+		if err := r.GRPCWeb.Validate(); err != nil {
+			return nil, err
+		}
+		for _, ret := range r.Responses() {
+			if _, err := base64.StdEncoding.DecodeString(ret.Body); err != nil && !ret.Template {
+				return nil, errors.New("grpcWeb: body must be the base64 encoded response message")
+			}
+		}
+	}
+	for _, c := range r.Capture {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.Scenario) == 0 && (len(r.RequiredState) > 0 || len(r.NewState) > 0) {
+		return nil, errors.New("requiredState and newState need a scenario")
+	}
+	if r.Log != nil {
+		if err := r.Log.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, ret := range r.Responses() {
+		if err := ret.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	var route *mux.Route
+	if r.StaticDir != nil {
+		if err := r.StaticDir.Validate(); err != nil {
+			return nil, err
+		}
+		route = staticPath(router, r.Path)
+	} else {
+		route = router.Path(r.Path)
+	}
 	if len(r.Method) > 0 {
 		route = route.Methods(r.Method)
 	}
-	pairs := r.Headers.ToA()
+	pairs := r.Headers.CanonicalHeaders().ToA()
 	if pairs != nil {
 		route = route.HeadersRegexp(pairs...)
 	}
@@ -119,28 +576,79 @@ func (r RouteRequest) BuildRoute(router *mux.Router) (*mux.Route, error) {
 	if queries != nil {
 		route = route.Queries(queries...)
 	}
-	return route, nil
+	if len(r.Host) > 0 {
+		route = route.Host(r.Host)
+	}
+	if len(r.SNI) > 0 {
+		sni := sniMatcher(r.SNI)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return sni(request) })
+	}
+	if r.ClientCert != nil {
+		cert := clientCertMatcher(*r.ClientCert)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return cert(request) })
+	}
+	if r.When != nil {
+		when := whenMatcher(*r.When)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return when(request) })
+	}
+	if r.Body != nil {
+		body := bodyMatcher(*r.Body)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return body(request) })
+	}
+	if r.JSONBody != nil {
+		body := jsonBodyMatcher(*r.JSONBody)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return body(request) })
+	}
+	if r.Match != nil {
+		match := matchExprMatcher(*r.Match)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return match(request) })
+	}
+	if r.GRPCWeb != nil {
+		grpc := grpcWebMatcher(*r.GRPCWeb)
+		route = route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return grpc(request) })
+	}
+	// Invalid path, header and query patterns are kept in the route
+	return route, route.GetError()
 }
 
 // PairsEq returns true if pairs are set-equivalent
 func PairsEq(v1, v2 Pairs) bool {
-	if v1 == nil && v2 == nil {
-		return true
-	}
-	if v1 != nil && v2 != nil {
-		if len(v1) == len(v2) {
-			for _, p1 := range v1 {
-				found := false
-				for _, p2 := range v2 {
-					if p1 == p2 {
-						found = true
-						break
-					}
-				}
-				if !found {
-					break
-				}
+	if len(v1) != len(v2) {
+		return false
+	}
+	for _, p1 := range v1 {
+		found := false
+		for _, p2 := range v2 {
+			if p1 == p2 {
+				found = true
+				break
 			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CanonicalHeaders returns a copy of the pairs with keys converted to
+// canonical header keys, so "content-type" and "Content-Type" are
+// the same header
+func (p Pairs) CanonicalHeaders() Pairs {
+	if p == nil {
+		return nil
+	}
+	ret := make(Pairs, len(p))
+	for i, x := range p {
+		ret[i] = Pair{Key: http.CanonicalHeaderKey(x.Key), Value: x.Value}
+	}
+	return ret
+}
+
+// hasContentType returns true if the headers set the content type
+func hasContentType(headers Pairs) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, "Content-Type") {
 			return true
 		}
 	}
@@ -151,136 +659,921 @@ func PairsEq(v1, v2 Pairs) bool {
 func RoutesEq(r1, r2 *RouteRequest) bool {
 	return r1.Method == r2.Method &&
 		r1.Path == r2.Path &&
-		PairsEq(r1.Headers, r2.Headers) &&
+		r1.Action == r2.Action &&
+		strings.EqualFold(r1.Host, r2.Host) &&
+		strings.EqualFold(r1.SNI, r2.SNI) &&
+		clientCertEq(r1.ClientCert, r2.ClientCert) &&
+		whenEq(r1.When, r2.When) &&
+		bodyMatchEq(r1.Body, r2.Body) &&
+		jsonBodyMatchEq(r1.JSONBody, r2.JSONBody) &&
+		matchExprEq(r1.Match, r2.Match) &&
+		grpcWebEq(r1.GRPCWeb, r2.GRPCWeb) &&
+		PairsEq(r1.Vars, r2.Vars) &&
+		r1.RequiredState == r2.RequiredState &&
+		(len(r1.RequiredState) == 0 || r1.Scenario == r2.Scenario) &&
+		(r1.StaticDir == nil) == (r2.StaticDir == nil) &&
+		PairsEq(r1.Headers.CanonicalHeaders(), r2.Headers.CanonicalHeaders()) &&
 		PairsEq(r1.Queries, r2.Queries)
 }
 
-// AddRoute adds a new route. It may replace an equivalent route
-func (h *AdminHandler) AddRoute(req RouteRequest) {
-	found := false
+// AddRoute adds a new route, and returns its id. A route without an id
+// gets one derived from its contents. If there is an equivalent route,
+// it is kept instead and its id is returned
+func (h *AdminHandler) AddRoute(req RouteRequest) string {
 	for _, r := range h.Routes {
 		if RoutesEq(&req, r) {
-			found = true
-			break
+			return r.ID
 		}
 	}
-	if !found {
-		h.Routes = append(h.Routes, &req)
+	if len(req.ID) == 0 {
+		req.ID = h.uniqueRouteID(newRouteID(req))
 	}
+	h.Routes = append(h.Routes, &req)
+	return req.ID
+}
+
+// ActionPass is the route action to continue matching
+const ActionPass = "pass"
+
+// PassHandler records the request, adds the route response headers,
+// and passes the request to the next routes
+type PassHandler struct {
+	R RouteRequest
+	// Next is the router of all routes. Only the routes after index
+	// match the passed request
+	Next  *mux.Router
+	index int
+	m     *MockHandler
+}
+
+// passKey is the request context key of the index of the last pass
+// route the request went through
+type passKey struct{}
+
+// passed returns the request to match against the routes after the
+// pass route
+func (h PassHandler) passed(request *http.Request) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), passKey{}, h.index))
+}
+
+// afterPass returns a matcher for the route at index, which skips the
+// requests passed by it or a route after it
+func afterPass(index int) mux.MatcherFunc {
+	return func(request *http.Request, _ *mux.RouteMatch) bool {
+		i, ok := request.Context().Value(passKey{}).(int)
+		return !ok || index > i
+	}
+}
+
+func (h PassHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.m.Stats.Record(h.R.Name(), 0)
+	h.R.Return.Headers.CanonicalHeaders().ToMap(writer.Header())
+	h.Next.ServeHTTP(writer, h.passed(request))
 }
 
 // MockReqHandler returns the required response
 type MockReqHandler struct {
 	R RouteRequest
+	// inFlight limits concurrent requests if the route has MaxConcurrent
+	inFlight chan struct{}
+	timeout  time.Duration
+	m        *MockHandler
+	// op is the API operation of the route if responses are validated
+	op *Operation
+}
+
+// Name returns a descriptive name for the route
+func (r RouteRequest) Name() string {
+	name := r.Method + " " + r.Path
+	if len(r.Queries) > 0 {
+		q := make([]string, len(r.Queries))
+		for i, x := range r.Queries {
+			q[i] = x.Key + "=" + x.Value
+		}
+		name += "?" + strings.Join(q, "&")
+	}
+	return strings.TrimSpace(name)
+}
+
+// NewMockReqHandler returns a handler for the route
+func NewMockReqHandler(r RouteRequest, m *MockHandler) MockReqHandler {
+	h := MockReqHandler{R: r, m: m}
+	if m.Spec != nil && m.ValidateMode == validateServe {
+		_, _, h.op = m.Spec.FindOperation(r)
+	}
+	if r.MaxConcurrent > 0 {
+		h.inFlight = make(chan struct{}, r.MaxConcurrent)
+	}
+	h.timeout, _ = time.ParseDuration(r.Timeout)
+	return h
+}
+
+// response returns the response for the request
+func (h MockReqHandler) response(request *http.Request) ReturnData {
+	ret := h.R.Return
+	injected := false
+	if len(h.R.Variants) > 0 {
+		ret = pickVariant(h.R.Variants)
+		injected = true
+	}
+	if len(h.R.Sequence) > 0 {
+		ret = h.R.next(h.m.States.Get(h.R.Key()))
+		injected = true
+	}
+	if r, ok := scheduled(h.R.Schedule, h.m.Clock.Now()); ok {
+		ret = r
+		injected = true
+	}
+	ret, failed := h.m.Chaos.inject(ret)
+	injected = injected || failed
+	if injected && ret.Status >= 500 {
+		h.m.Stats.RecordFault(h.R.Name(), faultError)
+	}
+	ret = ret.withBodyFile()
+	if ret.Template {
+		data := h.m.Scenarios.Data(h.R.Scenario, newTemplateRequest(request))
+		data.Vars = h.m.Vars.All()
+		data.PathVar = mux.Vars(request)
+		if h.R.RenderCache != nil {
+			ret = h.R.RenderCache.render(h.m.States.Get(h.R.Key()), ret, data, request)
+		} else {
+			ret = ret.render(data)
+		}
+	}
+	if len(h.m.RewriteHosts)+len(h.R.RewriteHosts) > 0 {
+		hosts := append(append([]string(nil), h.m.RewriteHosts...), h.R.RewriteHosts...)
+		ret = ret.RewriteHosts(hosts, BaseURL(request))
+	}
+	ret = ret.problem(request)
+	ret = h.m.ErrorBodies.Apply(request, ret)
+	if ret.PadTo > 0 {
+		ret.Body = Pad(ret.Body, ret.PadTo)
+	}
+	if h.R.GRPCWeb != nil {
+		ret = h.R.GRPCWeb.frame(request, ret)
+	}
+	return ret.withChecksums()
 }
 
 func (h MockReqHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	h.R.Return.Headers.ToMap(writer.Header())
-	writer.WriteHeader(h.R.Return.Status)
-	writer.Write([]byte(h.R.Return.Body))
+	start := time.Now()
+	if h.m.RouteHeaders {
+		writer.Header().Set("X-Mox-Route-Id", h.R.ID)
+		if a, ok := request.Context().Value(arrivalKey{}).(Arrival); ok {
+			writer.Header().Set("X-Mox-Match-Time", start.Sub(a.Time).String())
+		}
+	}
+	writeFailed := false
+	level := h.logLevel()
+	defer func() {
+		elapsed := time.Since(start)
+		h.m.Stats.Record(h.R.Name(), elapsed)
+		// The request context is canceled when the client closes the
+		// connection before the response is complete
+		if writeFailed || request.Context().Err() != nil {
+			h.logDisconnect(level, elapsed)
+			h.m.Stats.RecordDisconnect(h.R.Name(), elapsed)
+		}
+	}()
+	if level != logNone && len(level) > 0 {
+		lw := &loggingWriter{ResponseWriter: writer}
+		var dump []byte
+		if level == logVerbose {
+			lw.body = getBuffer()
+			dump, _ = httputil.DumpRequest(request, true)
+		}
+		writer = lw
+		defer func() { h.logRequest(request, lw, dump, time.Since(start)) }()
+	}
+	if h.timeout > 0 {
+		h.m.Conns.SetWriteDeadline(request, h.timeout)
+	}
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- struct{}{}:
+			defer func() { <-h.inFlight }()
+		default:
+			h.m.Stats.RecordFault(h.R.Name(), faultOverload)
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if h.R.Echo != nil {
+		h.R.Echo.Apply(writer.Header(), request)
+	}
+	if h.R.RateLimit != nil && !h.R.RateLimit.Take(h.m.States.Get(h.R.Key()), writer) {
+		h.m.Stats.RecordFault(h.R.Name(), faultRateLimit)
+		return
+	}
+	if h.R.Auth != nil && !h.R.Auth.Check(&h.m.Tokens, writer, request) {
+		return
+	}
+	if h.R.Login != nil && !h.R.Login.Check(h.m.States.Get(h.R.Key()), writer, request) {
+		return
+	}
+	if h.R.Token != nil {
+		h.R.Token.ServeToken(&h.m.Tokens, writer, request)
+		return
+	}
+	if len(h.R.Capture) > 0 {
+		h.m.Vars.Capture(h.R.Capture, request)
+	}
+	if h.R.Breaker != nil && !h.R.Breaker.Allow(h.m.States.Get(h.R.Key()), writer) {
+		h.m.Stats.RecordFault(h.R.Name(), faultBreaker)
+		return
+	}
+	var ret ReturnData
+	if h.R.Idempotency != nil {
+		ret = h.R.Idempotency.idempotent(h.m.States.Get(h.R.Key()), request, func() ReturnData {
+			return h.response(request)
+		})
+	} else {
+		ret = h.response(request)
+	}
+	if h.R.Cache != nil {
+		ret = h.R.Cache.Apply(request, ret)
+	}
+	if h.R.Breaker != nil {
+		h.R.Breaker.Record(h.m.States.Get(h.R.Key()), ret.Status)
+	}
+	if h.op != nil && ret.Status != http.StatusNotModified {
+		if errs := h.m.Spec.ValidateResponse(h.op, ret.Status, ret.Headers, ret.Body); len(errs) > 0 {
+			h.m.Violations.Add(SpecViolation{Route: h.R.Name(), Method: request.Method, Path: request.URL.Path,
+				Errors: errs, Time: time.Now(), Test: h.m.correlation(request)})
+			msg := fmt.Sprintf("mox: response of %s violates the spec: %s", h.R.Name(), strings.Join(errs, "; "))
+			h.logViolation(level, msg)
+			http.Error(writer, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+	releaseLock(request)
+	if !ret.wait(request, &h.m.Stats, h.R.Name()) {
+		return
+	}
+	if len(h.R.Scenario) > 0 {
+		h.m.Scenarios.Record(h.R.Scenario, &Exchange{Route: h.R.ID, Request: newTemplateRequest(request), Response: ret})
+	}
+	if len(h.R.NewState) > 0 {
+		h.m.Scenarios.SetState(h.R.Scenario, h.R.NewState)
+	}
+	ret.Headers.CanonicalHeaders().ToMap(writer.Header())
+	writer.WriteHeader(ret.Status)
+	if _, err := writer.Write([]byte(ret.Body)); err != nil {
+		writeFailed = true
+	}
 }
 
-// BuildRouter builds a router from all requests
+// BuildRouter builds a router from all requests. A pass route
+// continues matching with the routes after it in the same router
 func (h *AdminHandler) BuildRouter() *mux.Router {
 	router := mux.NewRouter()
-	for _, r := range h.Routes {
+	router.NotFoundHandler = h.M.undefined(http.StatusNotFound)
+	router.MethodNotAllowedHandler = h.M.undefined(http.StatusMethodNotAllowed)
+	passed := false
+	for i, r := range h.Routes {
 		route, _ := r.BuildRoute(router)
-		route.Handler(MockReqHandler{R: *r})
+		// A pass route skips the requests it passed itself
+		passed = passed || r.Action == ActionPass
+		if passed {
+			route.MatcherFunc(afterPass(i))
+		}
+		if len(r.Vars) > 0 {
+			vars := varsMatcher(&h.M.Vars, r.Vars)
+			route.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool { return vars(request) })
+		}
+		if len(r.RequiredState) > 0 {
+			scenario, state := r.Scenario, r.RequiredState
+			route.MatcherFunc(func(*http.Request, *mux.RouteMatch) bool { return h.M.Scenarios.State(scenario) == state })
+		}
+		if r.StaticDir != nil {
+			route.Handler(StaticHandler{R: *r, m: h.M})
+			continue
+		}
+		switch r.Action {
+		case ActionPass:
+			route.Handler(PassHandler{R: *r, m: h.M, Next: router, index: i})
+		case ActionRewrite:
+			route.Handler(RewriteHandler{R: *r, m: h.M})
+		default:
+			route.Handler(NewMockReqHandler(*r, h.M))
+		}
 	}
 	return router
 }
 
-// ProcessStream processes the given stream, parses it and creates routes
-func (h *AdminHandler) ProcessStream(rd io.Reader) ([]RouteRequest, error) {
+// addRoutes validates and adds routes, sets their ids, and rebuilds
+// the router. The caller must hold the lock on the mock handler. If
+// the routes are invalid or there would be too many routes, nothing is
+// changed
+func (h *AdminHandler) addRoutes(reqs []RouteRequest) error {
+	ids := make(map[string]bool)
+	for _, req := range reqs {
+		if _, err := req.BuildRoute(nil); err != nil {
+			return err
+		}
+		if err := h.M.validateRoute(req); err != nil {
+			return err
+		}
+		if len(req.ID) > 0 {
+			// Posting the same route again is not a conflict
+			if i := h.findRoute(req.ID); ids[req.ID] || (i >= 0 && !RoutesEq(&req, h.Routes[i])) {
+				return errors.New("duplicate route id: " + req.ID)
+			}
+			ids[req.ID] = true
+		}
+	}
+	old := h.Routes
+	for i := range reqs {
+		reqs[i].ID = h.AddRoute(reqs[i])
+	}
+	if h.MaxRoutes > 0 && len(h.Routes) > h.MaxRoutes {
+		h.Routes = old
+		return ErrTooManyRoutes
+	}
+	h.routesChanged()
+	return nil
+}
+
+// routesChanged rebuilds the router after the routes have changed.
+// The caller must hold the lock on the mock handler
+func (h *AdminHandler) routesChanged() {
+	h.M.Router = h.BuildRouter()
+	h.M.Matches = NewMatchCache(h.Routes, h.M.MatchCacheSize)
+	h.M.Notifier.Notify(Event{Type: EventRoutesChanged, Routes: len(h.Routes)})
+	if len(h.PersistFile) > 0 {
+		if err := h.saveRoutes(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// ProcessStream processes the given stream, JSON or YAML, parses it
+// and creates routes
+func (h *AdminHandler) ProcessStream(rd io.Reader, yaml bool) ([]RouteRequest, error) {
 	var reqs []RouteRequest
 	data, err := ioutil.ReadAll(rd)
+	if err == nil && yaml {
+		data, err = YAMLToJSON(data)
+	}
 	if err == nil {
-		err = json.Unmarshal(data, &reqs)
-		if err != nil {
-			reqs = make([]RouteRequest, 1)
-			err = json.Unmarshal(data, &reqs[0])
-		}
+		reqs, err = ParseRoutes(data)
 		if err == nil {
 			h.M.Lock()
 			defer h.M.Unlock()
-
-			for _, req := range reqs {
-				_, err := req.BuildRoute(nil)
-				if err == nil {
-					h.AddRoute(req)
-				} else {
-					break
-				}
-			}
-			if err == nil {
-				h.M.Router = h.BuildRouter()
-			}
+			err = h.addRoutes(reqs)
 		}
 	}
 	return reqs, err
 }
 
+// LoadFile loads routes from a stub file, see ReadStubFile
+func (h *AdminHandler) LoadFile(name string) error {
+	if h.Manifest != nil {
+		if err := h.Manifest.Verify(name, name); err != nil {
+			return err
+		}
+	}
+	reqs, err := ReadStubFile(name)
+	if err != nil {
+		return err
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	return h.addRoutes(withSource(reqs, name))
+}
+
+// ReadStubFile reads routes from a JSON file, a YAML file if the name
+// ends with .yaml or .yml, a DSL file if the name ends with .mox, a
+// CUE file if the name ends with .cue, or an HTTP Archive if the name
+// ends with .har. JSON, YAML, DSL and HAR files may be gzipped with a .gz suffix, and a .tar.gz bundle gives the routes of
+// all stub files in it
+func ReadStubFile(name string) ([]RouteRequest, error) {
+	if isBundle(name) {
+		return readBundle(name)
+	}
+	if filepath.Ext(name) == ".cue" {
+		data, err := EvalCUE(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		reqs, err := ParseRoutes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		return reqs, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var rd io.Reader = file
+	base := name
+	if filepath.Ext(name) == ".gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		defer gz.Close()
+		rd = gz
+		base = strings.TrimSuffix(name, ".gz")
+	}
+	var reqs []RouteRequest
+	if filepath.Ext(base) == ".mox" {
+		reqs, err = CompileDSL(rd, filepath.Dir(name))
+	} else {
+		var data []byte
+		if data, err = ioutil.ReadAll(rd); err == nil && isYAML(base) {
+			data, err = YAMLToJSON(data)
+		}
+		if err == nil && filepath.Ext(base) == ".har" {
+			reqs, err = ParseHAR(data)
+		} else if err == nil {
+			reqs, err = ParseRoutes(data)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return reqs, nil
+}
+
+// adminAddr returns the listen address of the admin port. The admin
+// port lets anyone change the mocks, so unless it is public it is
+// only reachable from localhost. A port given as host:port is used
+// as is
+func adminAddr(port string, public bool) string {
+	if strings.Contains(port, ":") {
+		return port
+	}
+	if public {
+		return ":" + port
+	}
+	return "localhost:" + port
+}
+
+// adminURL returns the URL of the admin port of a local mox started
+// with the same -adm flag. Wildcard addresses are reached on localhost
+func adminURL(port string) string {
+	addr := adminAddr(port, false)
+	if host, p, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+			addr = net.JoinHostPort("localhost", p)
+		}
+	}
+	return "http://" + addr
+}
+
+// writeError writes the error response for a failed admin request
+func writeError(writer http.ResponseWriter, err error) {
+	if err == ErrTooManyRoutes {
+		writer.WriteHeader(http.StatusInsufficientStorage)
+	} else {
+		writer.WriteHeader(http.StatusBadRequest)
+	}
+	writer.Write([]byte(err.Error()))
+}
+
 func (h *AdminHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	if request.Method == http.MethodPost {
-		reqs, err := h.ProcessStream(request.Body)
+	if err := gunzipBody(request); err != nil {
+		writeError(writer, err)
+		return
+	}
+	if acceptsGzip(request) {
+		gw := &gzipWriter{ResponseWriter: writer}
+		defer gw.Close()
+		writer = gw
+	}
+	switch request.URL.Path {
+	case "/verify":
+		h.serveVerify(writer, request)
+		return
+	case "/verify/all":
+		h.serveVerifyAll(writer, request)
+		return
+	case "/verify/wait":
+		h.serveWait(writer, request)
+		return
+	case "/setup":
+		h.serveSetup(writer, request)
+		return
+	case "/reset":
+		h.serveReset(writer, request)
+		return
+	case "/metrics":
+		h.serveMetrics(writer, request)
+		return
+	case "/stats":
+		h.serveStats(writer, request)
+		return
+	case "/openapi/diff":
+		h.serveOpenAPIDiff(writer, request)
+		return
+	case "/wiremock":
+		h.serveWireMock(writer, request)
+		return
+	case "/har":
+		h.serveHAR(writer, request)
+		return
+	case "/cassette":
+		h.serveCassette(writer, request)
+		return
+	case "/openapi/import":
+		h.serveOpenAPIImport(writer, request)
+		return
+	case "/tls/ca.pem", "/tls/ca.der":
+		h.serveCA(writer, request)
+		return
+	case "/journal":
+		h.serveJournal(writer, request)
+		return
+	case "/journal/replay":
+		h.serveReplay(writer, request)
+		return
+	case "/export":
+		h.serveExport(writer, request)
+		return
+	case "/recordings":
+		h.serveRecordings(writer, request)
+		return
+	case "/snapshot":
+		h.serveSnapshot(writer, request)
+		return
+	case "/egress":
+		h.serveEgress(writer, request)
+		return
+	case "/vars":
+		h.serveVars(writer, request)
+		return
+	case "/scenarios":
+		h.serveScenarios(writer, request)
+		return
+	case "/chaos":
+		h.serveChaos(writer, request)
+		return
+	}
+	if strings.HasPrefix(request.URL.Path, routesPrefix) {
+		h.serveRoute(writer, request)
+		return
+	}
+	if request.Method == http.MethodGet && (request.URL.Path == "/" || request.URL.Path == "/routes") {
+		h.serveRoutes(writer)
+	} else if request.Method == http.MethodDelete && request.URL.Path == "/routes" {
+		h.serveReset(writer, request)
+	} else if request.Method == http.MethodPost {
+		reqs, err := h.ProcessStream(request.Body, isYAMLType(request.Header.Get("Content-Type")))
 		if err == nil {
 			writer.WriteHeader(http.StatusOK)
 			ret, _ := json.Marshal(reqs)
 			writer.Write(ret)
 		} else {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte(err.Error()))
+			writeError(writer, err)
 		}
 	} else {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+// unlockKey is the request context key of the function releasing the
+// read lock of the mock handler
+type unlockKey struct{}
+
+// releaseLock releases the read lock the request is served under, so
+// delays and slow clients do not block route changes. The handler must
+// not use the routes after that
+func releaseLock(request *http.Request) {
+	if unlock, ok := request.Context().Value(unlockKey{}).(func()); ok {
+		unlock()
+	}
+}
+
 func (h *MockHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	request = withArrival(request, &h.Run)
+	test := h.correlation(request)
+	h.Received.Add(request, test)
+	if h.Stealth || len(h.ServerHeader) > 0 {
+		writer = &stealthWriter{ResponseWriter: writer, server: h.ServerHeader, stealth: h.Stealth}
+	}
 	h.RLock()
+	var once sync.Once
+	unlock := func() { once.Do(h.RUnlock) }
+	defer unlock()
+	request = request.WithContext(context.WithValue(request.Context(), unlockKey{}, unlock))
+	h.Journal.Record(h.Router, request, test)
+	if h.Methods.Serve(h, writer, request) {
+		return
+	}
+	if h.Proxy != nil && h.Proxy.All {
+		unlock()
+		if h.Egress.Check(writer, request, h.Proxy.Upstream, test) {
+			h.Proxy.ServeHTTP(writer, request)
+		}
+		return
+	}
 	if h.Router == nil {
-		writer.WriteHeader(http.StatusNotFound)
+		h.undefined(http.StatusNotFound).ServeHTTP(writer, request)
+	} else if router := h.Matches.Get(request); router != nil {
+		router.ServeHTTP(writer, request)
 	} else {
+		h.Matches.Learn(h.Router, request)
 		h.Router.ServeHTTP(writer, request)
 	}
-	h.RUnlock()
 }
 
 func main() {
 	flag.Parse()
+	bodyFiles.Root, bodyFiles.Cache = *filesRoot, *filesCache
+	if len(*wireMock) > 0 && !flagSet("files") {
+		bodyFiles.Root = filepath.Join(*wireMock, "__files")
+	}
 
-	m := MockHandler{}
-	a := AdminHandler{Routes: make([]*RouteRequest, 0), M: &m}
+	switch flag.Arg(0) {
+	case "repl":
+		runRepl(flag.Args()[1:])
+		return
+	case "top":
+		runTop(flag.Args()[1:])
+		return
+	case "gen":
+		runGen(flag.Args()[1:])
+		return
+	case "pcap":
+		runPcap(flag.Args()[1:])
+		return
+	case "har":
+		runHAR(flag.Args()[1:])
+		return
+	case "wiremock":
+		runWireMock(flag.Args()[1:])
+		return
+	case "apidiff":
+		runAPIDiff(flag.Args()[1:])
+		return
+	case "compile":
+		runCompile(flag.Args()[1:])
+		return
+	case "replay":
+		runReplay(flag.Args()[1:])
+		return
+	case "sign":
+		runSign(flag.Args()[1:])
+		return
+	}
 
-	for _, f := range flag.Args() {
-		file, err := os.Open(f)
+	m := MockHandler{Strict: *strict, Strict501: *strict501, Notifier: NewNotifier(*webhook)}
+	m.Run.Reset()
+	m.ErrorBodies = defaultErrorBodies
+	if err := validLogLevel(*logLevel); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	m.LogLevel = *logLevel
+	m.RouteHeaders = *routeHdrs
+	m.Stealth = *stealth
+	m.Journal.Size = *journalMax
+	m.Unmatched.Size = *unmatchMax
+	m.CorrelationHeader = *corrHdr
+	m.Forwards = forwards
+	m.Egress.Enabled = *egressOn || len(allowlist) > 0
+	m.Egress.Allow = allowlist
+	if len(*proxyURL) > 0 {
+		var err error
+		if m.Proxy, err = NewProxy(*proxyURL); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		m.Proxy.All = *proxyAll
+		m.Proxy.Record = true
+		m.Proxy.File = *recordFile
+		m.Proxy.Domains = domainMap
+	}
+	if len(*cassettes) > 0 {
+		m.Cassettes.Dir = *cassettes
+		m.Cassettes.Header = *cassetteHd
+		m.Cassettes.Ordered = *ordered
+		m.Cassettes.m = &m
+		if m.Proxy != nil {
+			m.Proxy.Cassettes = &m.Cassettes
+		}
+	}
+	if *warmStart && (m.Proxy == nil || len(*recordFile) == 0 || *proxyAll) {
+		fmt.Println("-warm-start needs -proxy and -record, without -proxy-all")
+		os.Exit(1)
+	}
+	m.ServerHeader = *serverHdr
+	m.Methods = MethodControls{Options: *optionsM, Trace: *traceM, Connect: *connectM}
+	if err := m.Methods.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	m.MatchCacheSize = *matchMax
+	if *maxConns > 0 || *maxConnsIP > 0 {
+		m.Limits = &ConnLimits{Max: *maxConns, PerIP: *maxConnsIP}
+	}
+	if len(*errBodies) > 0 {
+		var err error
+		if m.ErrorBodies, err = LoadErrorBodies(*errBodies); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if len(*fallbacks) > 0 {
+		var err error
+		if m.DefaultFallbacks, err = LoadFallbacks(*fallbacks); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		m.Fallbacks = m.DefaultFallbacks
+	}
+	if len(*rwHosts) > 0 {
+		m.RewriteHosts = strings.Split(*rwHosts, ",")
+	}
+	if len(*specFile) > 0 {
+		file, err := os.Open(*specFile)
+		if err == nil {
+			m.Spec, err = ParseOpenAPI(file)
+			file.Close()
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		m.ValidateMode = *validate
+	}
+	a := AdminHandler{Routes: make([]*RouteRequest, 0), M: &m, MaxRoutes: *maxRoutes}
+	if len(*manifest) > 0 {
+		var err error
+		if a.Manifest, err = LoadManifest(*manifest, *manifestPK); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	dirs := flag.Args()
+	if len(*mappings) > 0 {
+		dirs = append([]string{*mappings}, dirs...)
+	}
+	for _, f := range dirs {
+		var err error
+		if IsRemote(f) {
+			err = a.AddSource(f)
+		} else if info, serr := os.Stat(f); serr == nil && info.IsDir() {
+			err = a.AddMappings(f)
+		} else {
+			err = a.LoadFile(f)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *watch > 0 && len(a.Mappings) > 0 {
+		go func() {
+			for range time.Tick(*watch) {
+				for _, err := range a.ReloadMappings() {
+					fmt.Println(err)
+				}
+			}
+		}()
+	}
+	if *refresh > 0 && len(a.Sources) > 0 {
+		go func() {
+			for range time.Tick(*refresh) {
+				for _, err := range a.RefreshSources() {
+					fmt.Println(err)
+				}
+			}
+		}()
+	}
+	for _, s := range stubs {
+		req, err := ParseStub(s)
+		if err == nil {
+			a.M.Lock()
+			err = a.addRoutes(withSource([]RouteRequest{req}, "-stub"))
+			a.M.Unlock()
+		}
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		_, err = a.ProcessStream(file)
+	}
+	if len(*wireMock) > 0 {
+		reqs, warnings, err := ReadWireMock(*wireMock)
+		for _, w := range warnings {
+			fmt.Println(w)
+		}
+		if err == nil {
+			a.M.Lock()
+			err = a.addRoutes(withSource(reqs, *wireMock))
+			a.M.Unlock()
+		}
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		file.Close()
+	}
+	if *warmStart {
+		if err := a.WarmStart(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if len(*importSpec) > 0 {
+		if err := a.ImportOpenAPIFile(*importSpec, *apiPrefix); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if len(*persistDir) > 0 {
+		if err := a.Persist(*persistDir); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 
 	admSrv := &http.Server{
 		Handler:      &a,
-		Addr:         ":" + *adminPort,
+		Addr:         adminAddr(*adminPort, *admPublic),
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
 	}
 	go func() {
-		admSrv.ListenAndServe()
+		fmt.Printf("%v\n", admSrv.ListenAndServe())
 	}()
 
+	if (len(*tlsCert) > 0 || len(*clientCert) > 0 || len(*clientCA) > 0) && len(*tlsPort) == 0 {
+		fmt.Println("-tls-cert, -tls-client-cert and -tls-client-ca need -tls-port")
+		os.Exit(1)
+	}
+	intercept := *connectM == connectIntercept || len(*socksPort) > 0
+	if len(*tlsPort) > 0 || intercept {
+		var err error
+		if m.CA == nil {
+			if len(*caFile) > 0 {
+				m.CA, err = LoadCertAuthority(*caFile)
+			} else {
+				m.CA, err = NewCertAuthority()
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		l := SNIListener{CA: m.CA, Behaviors: badTLS, Certs: sniCerts, ALPN: ParseALPN(*tlsALPN)}
+		if len(*tlsCert) > 0 {
+			cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			l.Default = &cert
+		}
+		if l.ClientAuth, l.ClientCAs, err = ClientAuth(*clientCert, *clientCA); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if intercept {
+			m.TunnelTLS = l.Config()
+		}
+		if len(*tlsPort) > 0 {
+			go func() {
+				fmt.Printf("%v\n", ServeTLS(":"+*tlsPort, l.Config(), &m, m.Conns.ConnState, m.Limits))
+			}()
+		}
+	}
+	if len(*socksPort) > 0 {
+		go func() {
+			fmt.Printf("%v\n", ServeSOCKS(":"+*socksPort, &m))
+		}()
+	}
+
+	if (len(dnsNames) > 0 || len(*dnsIP) > 0 || len(*dnsForward) > 0) && len(*dnsPort) == 0 {
+		fmt.Println("-dns-name, -dns-ip and -dns-forward need -dns-port")
+		os.Exit(1)
+	}
+	if len(*dnsPort) > 0 {
+		d := DNSServer{Names: dnsNames, IP: HostIP(), Forward: *dnsForward}
+		if len(*dnsIP) > 0 {
+			if d.IP = net.ParseIP(*dnsIP); d.IP == nil {
+				fmt.Println("invalid -dns-ip: " + *dnsIP)
+				os.Exit(1)
+			}
+		}
+		go func() {
+			fmt.Printf("%v\n", d.ListenAndServe(":"+*dnsPort))
+		}()
+	}
+
 	mockSrv := &http.Server{
 		Handler:      &m,
-		Addr:         ":" + *mockPort,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
+		ConnState:    m.Conns.ConnState,
+	}
+	ln, err := net.Listen("tcp", ":"+*mockPort)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	fmt.Printf("%v\n", mockSrv.ListenAndServe())
+	fmt.Printf("%v\n", mockSrv.Serve(m.Limits.Listener(ln, true)))
 }
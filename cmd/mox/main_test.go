@@ -0,0 +1,138 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestAdmin returns an admin handler with the routes
+func newTestAdmin(t *testing.T, routes ...RouteRequest) *AdminHandler {
+	t.Helper()
+	a := &AdminHandler{Routes: make([]*RouteRequest, 0), M: &MockHandler{}}
+	a.M.Lock()
+	defer a.M.Unlock()
+	if err := a.addRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// serve sends a request to the mock handler
+func serve(a *AdminHandler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.M.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestPassRoutesShareRouter(t *testing.T) {
+	const n = 40
+	routes := make([]RouteRequest, 0, n+1)
+	for i := 0; i < n; i++ {
+		routes = append(routes, RouteRequest{
+			// Distinct paths, so the routes are not merged
+			Path:   fmt.Sprintf("/{p%d}", i),
+			Action: ActionPass,
+			Return: ReturnData{Headers: Pairs{{Key: fmt.Sprintf("X-Pass-%d", i), Value: "1"}}},
+		})
+	}
+	routes = append(routes, RouteRequest{Method: "GET", Path: "/x", Return: ReturnData{Status: http.StatusTeapot, Body: "done"}})
+	start := time.Now()
+	a := newTestAdmin(t, routes...)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("building %d pass routes took %v", n, d)
+	}
+	count := 0
+	a.M.Router.Walk(func(*mux.Route, *mux.Router, []*mux.Route) error {
+		count++
+		return nil
+	})
+	if count != n+1 {
+		t.Errorf("router has %d routes, expected %d", count, n+1)
+	}
+	rec := serve(a, "GET", "/x", "")
+	if rec.Code != http.StatusTeapot || rec.Body.String() != "done" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	for i := 0; i < n; i++ {
+		if rec.Header().Get(fmt.Sprintf("X-Pass-%d", i)) != "1" {
+			t.Errorf("pass route %d was not applied", i)
+		}
+	}
+}
+
+func TestPassRouteSkipsEarlierRoutes(t *testing.T) {
+	a := newTestAdmin(t,
+		RouteRequest{Method: "POST", Path: "/y", Return: ReturnData{Status: http.StatusCreated}},
+		RouteRequest{Path: "/y", Action: ActionPass, Return: ReturnData{Headers: Pairs{{Key: "X-Seen", Value: "1"}}}},
+		RouteRequest{Method: "GET", Path: "/y", Return: ReturnData{Status: http.StatusOK, Body: "after"}},
+	)
+	rec := serve(a, "GET", "/y", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "after" || rec.Header().Get("X-Seen") != "1" {
+		t.Errorf("got %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if rec := serve(a, "POST", "/y", ""); rec.Code != http.StatusCreated {
+		t.Errorf("got %d, expected the route before the pass route", rec.Code)
+	}
+}
+
+func TestRewriteAfterPass(t *testing.T) {
+	a := newTestAdmin(t,
+		RouteRequest{Path: "/{any}", Action: ActionPass},
+		RouteRequest{Method: "GET", Path: "/target", Return: ReturnData{Status: http.StatusOK, Body: "target"}},
+		RouteRequest{Path: "/src", Action: ActionPass},
+		RouteRequest{Method: "GET", Path: "/src", Action: ActionRewrite, Rewrite: &Rewrite{Path: "/target"}},
+	)
+	if rec := serve(a, "GET", "/src", ""); rec.Code != http.StatusOK || rec.Body.String() != "target" {
+		t.Errorf("got %d %q, expected the route before the pass route", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminURL(t *testing.T) {
+	tests := []struct{ port, want string }{
+		{"8001", "http://localhost:8001"},
+		{"127.0.0.1:9000", "http://127.0.0.1:9000"},
+		{":9000", "http://localhost:9000"},
+		{"0.0.0.0:9000", "http://localhost:9000"},
+		{"[::1]:9000", "http://[::1]:9000"},
+	}
+	for _, x := range tests {
+		if got := adminURL(x.port); got != x.want {
+			t.Errorf("%s: got %s, expected %s", x.port, got, x.want)
+		}
+	}
+}
+
+func TestBuildRouteErrors(t *testing.T) {
+	tests := []RouteRequest{
+		{Method: "GET"},
+		{Path: "/{id:(}"},
+		{Path: "/x", Headers: Pairs{{Key: "X-A", Value: "("}}},
+		{Path: "/x", Queries: Pairs{{Key: "q", Value: "{v:(}"}}},
+		{Path: "/x", Action: "jump"},
+	}
+	for _, x := range tests {
+		if _, err := x.BuildRoute(nil); err == nil {
+			t.Errorf("%+v: expected an error", x)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Manifest gives the SHA-256 sums of the stub files that may be
+// loaded, in sha256sum format. Files are looked up by the name they
+// are loaded with, then by base name
+type Manifest struct {
+	sums map[string][sha256.Size]byte
+}
+
+// LoadManifest reads a manifest. If keyFile is given, the manifest
+// must have a valid ed25519 signature in name.sig
+func LoadManifest(name, keyFile string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyFile) > 0 {
+		key, err := readKey(keyFile, ed25519.PublicKeySize)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := readKey(name+".sig", ed25519.SignatureSize)
+		if err != nil {
+			return nil, err
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+			return nil, errors.New(name + ": invalid signature")
+		}
+	}
+	m := &Manifest{sums: make(map[string][sha256.Size]byte)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var sum [sha256.Size]byte
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != sha256.Size || len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expecting SHA256SUM NAME", name, line)
+		}
+		copy(sum[:], b)
+		// sha256sum marks binary mode with *
+		m.sums[strings.TrimPrefix(fields[1], "*")] = sum
+	}
+	return m, nil
+}
+
+// Verify checks the stub file at file against the sum of name
+func (m *Manifest) Verify(name, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sum, ok := m.sums[name]
+	if !ok {
+		sum, ok = m.sums[path.Base(name)]
+	}
+	if !ok {
+		return errors.New(name + ": not in manifest")
+	}
+	if sha256.Sum256(data) != sum {
+		return errors.New(name + ": checksum mismatch")
+	}
+	return nil
+}
+
+// readKey reads a base64 encoded key or signature of the given size
+func readKey(name string, size int) ([]byte, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != size {
+		return nil, errors.New(name + ": invalid key")
+	}
+	return key, nil
+}
+
+// runSign signs a manifest, or generates a key pair with -new
+func runSign(args []string) {
+	if len(args) == 2 && args[0] == "-new" {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err == nil {
+			err = ioutil.WriteFile(args[1], []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0600)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(args[1]+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) != 2 {
+		fmt.Println("Usage: mox sign KEY MANIFEST\n       mox sign -new KEY")
+		os.Exit(1)
+	}
+	key, err := readKey(args[0], ed25519.PrivateKeySize)
+	var data []byte
+	if err == nil {
+		data, err = ioutil.ReadFile(args[1])
+	}
+	if err == nil {
+		sig := ed25519.Sign(ed25519.PrivateKey(key), data)
+		err = ioutil.WriteFile(args[1]+".sig", []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// MappingsDir is a directory of stub files. The stub files at its top
+// are loaded in name order, and subdirectories may hold the files
+// they refer to. Its routes are replaced when the stub files change
+type MappingsDir struct {
+	Dir    string
+	stamp  string
+	routes []*RouteRequest
+}
+
+// files returns the stub files of the directory, and a stamp of their
+// names, sizes and modification times that changes when they change
+func (d *MappingsDir) files() ([]string, string, error) {
+	infos, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return nil, "", err
+	}
+	var names []string
+	stamp := ""
+	for _, info := range infos {
+		if !info.IsDir() && isStubFile(info.Name()) {
+			names = append(names, filepath.Join(d.Dir, info.Name()))
+			stamp += fmt.Sprintf("%s %d %d\n", info.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	sort.Strings(names)
+	return names, stamp, nil
+}
+
+// AddMappings loads the routes of a mappings directory, and keeps the
+// directory to reload it when it changes
+func (h *AdminHandler) AddMappings(dir string) error {
+	d := &MappingsDir{Dir: dir}
+	if _, err := h.reloadMappings(d); err != nil {
+		return err
+	}
+	h.Mappings = append(h.Mappings, d)
+	return nil
+}
+
+// ReloadMappings reloads the mappings directories whose stub files
+// have changed
+func (h *AdminHandler) ReloadMappings() []error {
+	var errs []error
+	for _, d := range h.Mappings {
+		reloaded, err := h.reloadMappings(d)
+		if err != nil {
+			errs = append(errs, err)
+		} else if reloaded {
+			fmt.Printf("mox: reloaded %s: %d routes\n", d.Dir, len(d.routes))
+		}
+	}
+	return errs
+}
+
+// reloadMappings replaces the routes of the directory if its stub
+// files changed, and returns true if it did. A file that cannot be
+// loaded leaves the routes as they are until the files change again
+func (h *AdminHandler) reloadMappings(d *MappingsDir) (bool, error) {
+	names, stamp, err := d.files()
+	if err != nil || stamp == d.stamp {
+		return false, err
+	}
+	d.stamp = stamp
+	var reqs []RouteRequest
+	for _, name := range names {
+		if h.Manifest != nil {
+			if err := h.Manifest.Verify(name, name); err != nil {
+				return false, err
+			}
+		}
+		r, err := ReadStubFile(name)
+		if err != nil {
+			return false, err
+		}
+		reqs = append(reqs, r...)
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	routes, err := h.replaceRoutes(d.routes, withSource(reqs, d.Dir))
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", d.Dir, err)
+	}
+	d.routes = routes
+	return true, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// MatchCache remembers the route matched by requests with the same
+// signature: method, host, path, query, SNI name and the headers routes
+// match on. A cached request is dispatched to a router with only the
+// matched route, which sets the path variables as usual. The cache
+// is rebuilt when the routes change
+type MatchCache struct {
+	sync.Mutex
+	size    int
+	headers []string
+	routers map[string]*mux.Router
+}
+
+// NewMatchCache returns a cache of at most size signatures for the
+// routes. If the routes match on request arrival, body or variables,
+// matching depends on more than the signature and nil is returned
+func NewMatchCache(routes []*RouteRequest, size int) *MatchCache {
+	if size <= 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	c := &MatchCache{size: size, routers: make(map[string]*mux.Router)}
+	for _, r := range routes {
+		if r.When != nil || r.Body != nil || r.JSONBody != nil || r.Match != nil || r.GRPCWeb != nil || r.ClientCert != nil || len(r.Vars) > 0 || len(r.RequiredState) > 0 {
+			return nil
+		}
+		for _, h := range r.Headers.CanonicalHeaders() {
+			if !seen[h.Key] {
+				seen[h.Key] = true
+				c.headers = append(c.headers, h.Key)
+			}
+		}
+	}
+	sort.Strings(c.headers)
+	return c
+}
+
+func (c *MatchCache) key(request *http.Request) string {
+	fields := []string{request.Method, request.Host, request.URL.Path, request.URL.RawQuery}
+	if request.TLS != nil {
+		fields = append(fields, request.TLS.ServerName)
+	}
+	for _, h := range c.headers {
+		fields = append(fields, strings.Join(request.Header[h], ","))
+	}
+	return strings.Join(fields, "\x00")
+}
+
+// Get returns the router of the route matched by the request
+// signature, or nil if it is not cached
+func (c *MatchCache) Get(request *http.Request) *mux.Router {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.routers[c.key(request)]
+}
+
+// Learn matches the request with the router, and caches the matched
+// route for the request signature
+func (c *MatchCache) Learn(router *mux.Router, request *http.Request) {
+	if c == nil {
+		return
+	}
+	var match mux.RouteMatch
+	if !router.Match(request, &match) || match.MatchErr != nil {
+		return
+	}
+	r, ok := routeOf(match.Handler)
+	if !ok {
+		return
+	}
+	single := mux.NewRouter()
+	single.NotFoundHandler = router.NotFoundHandler
+	single.MethodNotAllowedHandler = router.MethodNotAllowedHandler
+	route, err := r.BuildRoute(single)
+	if err != nil {
+		return
+	}
+	route.Handler(match.Handler)
+	c.Lock()
+	defer c.Unlock()
+	if len(c.routers) >= c.size {
+		c.routers = make(map[string]*mux.Router)
+	}
+	c.routers[c.key(request)] = single
+}
+
+// routeOf returns the route of a route handler
+func routeOf(handler http.Handler) (RouteRequest, bool) {
+	switch h := handler.(type) {
+	case MockReqHandler:
+		return h.R, true
+	case PassHandler:
+		return h.R, true
+	case RewriteHandler:
+		return h.R, true
+	case StaticHandler:
+		return h.R, true
+	}
+	return RouteRequest{}, false
+}
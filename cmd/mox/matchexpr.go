@@ -0,0 +1,145 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxMatchDepth limits the nesting of match expressions
+const maxMatchDepth = 32
+
+// MatchExpr combines request predicates with boolean logic. An
+// expression holds if all its predicates hold: the method, headers,
+// queries and body matchers, which work as they do in routes, every
+// expression of And, at least one expression of Or, and not Not
+type MatchExpr struct {
+	And      []MatchExpr    `json:"and,omitempty"`
+	Or       []MatchExpr    `json:"or,omitempty"`
+	Not      *MatchExpr     `json:"not,omitempty"`
+	Method   string         `json:"method,omitempty"`
+	Headers  Pairs          `json:"headers,omitempty"`
+	Queries  Pairs          `json:"queries,omitempty"`
+	Body     *BodyMatch     `json:"body,omitempty"`
+	JSONBody *JSONBodyMatch `json:"jsonBody,omitempty"`
+}
+
+// Validate checks the predicates of the expression and the
+// expressions in it
+func (e MatchExpr) Validate() error {
+	return e.validate(0)
+}
+
+func (e MatchExpr) validate(depth int) error {
+	if depth > maxMatchDepth {
+		return errors.New("match: expressions nested too deep")
+	}
+	if reflect.DeepEqual(e, MatchExpr{}) {
+		return errors.New("match: empty expression")
+	}
+	for _, p := range e.Headers.CanonicalHeaders() {
+		if err := mux.NewRouter().NewRoute().HeadersRegexp(p.Key, p.Value).GetError(); err != nil {
+			return errors.New("match: " + err.Error())
+		}
+	}
+	for _, p := range e.Queries {
+		if err := mux.NewRouter().Queries(p.Key, p.Value).GetError(); err != nil {
+			return errors.New("match: " + err.Error())
+		}
+	}
+	if e.Body != nil {
+		if err := e.Body.Validate(); err != nil {
+			return err
+		}
+	}
+	if e.JSONBody != nil {
+		if err := e.JSONBody.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, x := range append(append([]MatchExpr{}, e.And...), e.Or...) {
+		if err := x.validate(depth + 1); err != nil {
+			return err
+		}
+	}
+	if e.Not != nil {
+		return e.Not.validate(depth + 1)
+	}
+	return nil
+}
+
+// matchExprMatcher returns a matcher for requests the expression holds
+// for
+func matchExprMatcher(e MatchExpr) func(*http.Request) bool {
+	var preds []func(*http.Request) bool
+	if len(e.Method) > 0 {
+		method := e.Method
+		preds = append(preds, func(request *http.Request) bool { return strings.EqualFold(request.Method, method) })
+	}
+	for _, p := range e.Headers.CanonicalHeaders() {
+		preds = append(preds, routeMatcher(mux.NewRouter().NewRoute().HeadersRegexp(p.Key, p.Value)))
+	}
+	for _, p := range e.Queries {
+		preds = append(preds, routeMatcher(mux.NewRouter().Queries(p.Key, p.Value)))
+	}
+	if e.Body != nil {
+		preds = append(preds, bodyMatcher(*e.Body))
+	}
+	if e.JSONBody != nil {
+		preds = append(preds, jsonBodyMatcher(*e.JSONBody))
+	}
+	for _, x := range e.And {
+		preds = append(preds, matchExprMatcher(x))
+	}
+	if len(e.Or) > 0 {
+		or := make([]func(*http.Request) bool, len(e.Or))
+		for i, x := range e.Or {
+			or[i] = matchExprMatcher(x)
+		}
+		preds = append(preds, func(request *http.Request) bool {
+			for _, m := range or {
+				if m(request) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if e.Not != nil {
+		not := matchExprMatcher(*e.Not)
+		preds = append(preds, func(request *http.Request) bool { return !not(request) })
+	}
+	return func(request *http.Request) bool {
+		for _, m := range preds {
+			if !m(request) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// matchExprEq returns true if the expressions are the same
+func matchExprEq(e1, e2 *MatchExpr) bool {
+	if e1 == nil || e2 == nil {
+		return e1 == e2
+	}
+	return reflect.DeepEqual(e1, e2)
+}
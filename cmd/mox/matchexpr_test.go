@@ -0,0 +1,85 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchExprValidate(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  bool
+	}{
+		{`{"method": "GET"}`, false},
+		{`{"or": [{"headers": [{"key": "X-A", "value": "1"}]}, {"not": {"method": "POST"}}]}`, false},
+		{`{}`, true},
+		{`{"and": [{}]}`, true},
+		{`{"not": {"body": {"regex": "("}}}`, true},
+		{`{"headers": [{"key": "X-A", "value": "("}]}`, true},
+		{`{"body": {}}`, true},
+	}
+	for _, x := range tests {
+		var e MatchExpr
+		if err := json.Unmarshal([]byte(x.expr), &e); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Validate(); (err != nil) != x.err {
+			t.Errorf("%s: got %v", x.expr, err)
+		}
+	}
+	deep := MatchExpr{Method: "GET"}
+	for i := 0; i <= maxMatchDepth; i++ {
+		deep = MatchExpr{Not: &deep}
+	}
+	if err := deep.Validate(); err == nil {
+		t.Errorf("expected an error for deeply nested expressions")
+	}
+}
+
+func TestMatchExprMatcher(t *testing.T) {
+	expr := `{"or": [
+	  {"method": "post", "body": {"contains": "urgent"}},
+	  {"and": [{"headers": [{"key": "X-Tier", "value": "gold"}]}, {"not": {"queries": [{"key": "dry", "value": "1"}]}}]}
+	]}`
+	var e MatchExpr
+	if err := json.Unmarshal([]byte(expr), &e); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method, target, tier, body string
+		want                       bool
+	}{
+		{"POST", "/", "", "urgent please", true},
+		{"POST", "/", "", "later", false},
+		{"GET", "/", "", "urgent", false},
+		{"GET", "/", "gold", "", true},
+		{"GET", "/?dry=1", "gold", "", false},
+		{"GET", "/", "silver", "", false},
+	}
+	m := matchExprMatcher(e)
+	for _, x := range tests {
+		request := httptest.NewRequest(x.method, x.target, strings.NewReader(x.body))
+		if len(x.tier) > 0 {
+			request.Header.Set("X-Tier", x.tier)
+		}
+		if got := m(request); got != x.want {
+			t.Errorf("%s %s tier=%q body=%q: got %v", x.method, x.target, x.tier, x.body, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MethodControls configures how the mock answers OPTIONS, TRACE and
+// CONNECT requests that no route defines. Empty values leave the
+// requests to the routes
+type MethodControls struct {
+	// Options is "auto" to answer with the methods the path has
+	// routes for
+	Options string
+	// Trace is "echo" to return the request, or "reject" for 405
+	Trace string
+	// Connect is "reject" for 405, "tunnel" to accept the tunnel
+	// and serve the plain HTTP requests in it from the mock, or
+	// "intercept" to also terminate TLS in the tunnel
+	Connect string
+}
+
+// Method control modes
+const (
+	optionsAuto      = "auto"
+	traceEcho        = "echo"
+	methodReject     = "reject"
+	connectTunnel    = "tunnel"
+	connectIntercept = "intercept"
+)
+
+// candidateMethods are the methods listed in automatic OPTIONS answers
+var candidateMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Validate checks the modes
+func (c MethodControls) Validate() error {
+	if c.Options != "" && c.Options != optionsAuto {
+		return errors.New("unknown options mode: " + c.Options)
+	}
+	if c.Trace != "" && c.Trace != traceEcho && c.Trace != methodReject {
+		return errors.New("unknown trace mode: " + c.Trace)
+	}
+	if c.Connect != "" && c.Connect != methodReject && c.Connect != connectTunnel && c.Connect != connectIntercept {
+		return errors.New("unknown connect mode: " + c.Connect)
+	}
+	return nil
+}
+
+// routed returns true if a route of the router matches the request
+// with its method
+func routed(router *mux.Router, request *http.Request) bool {
+	if router == nil {
+		return false
+	}
+	var match mux.RouteMatch
+	return router.Match(request, &match) && match.Route != nil && match.MatchErr == nil
+}
+
+// allowedMethods returns the methods routes of the router match the
+// request with
+func allowedMethods(router *mux.Router, request *http.Request) []string {
+	var allowed []string
+	for _, m := range candidateMethods {
+		r := request.WithContext(request.Context())
+		r.Method = m
+		if routed(router, r) {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed
+}
+
+// Serve answers the request if it has a controlled method and no route
+// matches it, and returns true if it did. The caller holds the read
+// lock of the mock handler
+func (c MethodControls) Serve(h *MockHandler, writer http.ResponseWriter, request *http.Request) bool {
+	var mode string
+	switch request.Method {
+	case http.MethodOptions:
+		mode = c.Options
+	case http.MethodTrace:
+		mode = c.Trace
+	case http.MethodConnect:
+		mode = c.Connect
+	}
+	if len(mode) == 0 || (request.Method != http.MethodConnect && routed(h.Router, request)) {
+		return false
+	}
+	switch mode {
+	case methodReject:
+		writer.Header().Set("Allow", strings.Join(candidateMethods, ", "))
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	case optionsAuto:
+		allowed := allowedMethods(h.Router, request)
+		if len(allowed) == 0 {
+			return false
+		}
+		writer.Header().Set("Allow", strings.Join(append([]string{http.MethodOptions}, allowed...), ", "))
+		writer.WriteHeader(http.StatusNoContent)
+	case traceEcho:
+		dump, err := httputil.DumpRequest(request, true)
+		if err != nil {
+			writeError(writer, err)
+			return true
+		}
+		writer.Header().Set("Content-Type", "message/http")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(dump)
+	case connectTunnel, connectIntercept:
+		c.tunnel(h, writer, request.Host)
+	}
+	return true
+}
+
+// tunnel accepts a CONNECT request to host, and serves the requests
+// sent through the tunnel from the mock
+func (c MethodControls) tunnel(h *MockHandler, writer http.ResponseWriter, host string) {
+	hj, ok := writer.(http.Hijacker)
+	if !ok {
+		writer.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	rw.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n")
+	rw.Flush()
+	go h.serveTunnel(&bufferedConn{Conn: conn, r: rw.Reader}, host, c.Connect == connectIntercept)
+}
+
+// bufferedConn reads what the hijacked connection has buffered first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// tunnelListener accepts the tunneled connection once
+type tunnelListener struct {
+	conn net.Conn
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	if l.conn == nil {
+		return nil, io.EOF
+	}
+	conn := l.conn
+	l.conn = nil
+	return conn, nil
+}
+
+func (l *tunnelListener) Close() error { return nil }
+
+func (l *tunnelListener) Addr() net.Addr { return dummyAddr{} }
+
+type dummyAddr struct{}
+
+func (dummyAddr) Network() string { return "tunnel" }
+func (dummyAddr) String() string  { return "tunnel" }
@@ -0,0 +1,69 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// serveMetrics writes mock metrics in Prometheus text format
+func (h *AdminHandler) serveMetrics(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	h.M.RLock()
+	nRoutes := len(h.Routes)
+	h.M.RUnlock()
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(writer, "# HELP mox_routes Number of registered routes")
+	fmt.Fprintln(writer, "# TYPE mox_routes gauge")
+	fmt.Fprintf(writer, "mox_routes %d\n", nRoutes)
+	fmt.Fprintln(writer, "# HELP mox_routes_max Maximum number of routes, 0 if unlimited")
+	fmt.Fprintln(writer, "# TYPE mox_routes_max gauge")
+	fmt.Fprintf(writer, "mox_routes_max %d\n", h.MaxRoutes)
+	fmt.Fprintln(writer, "# HELP mox_unmatched_requests Number of requests that matched no route")
+	fmt.Fprintln(writer, "# TYPE mox_unmatched_requests gauge")
+	fmt.Fprintf(writer, "mox_unmatched_requests %d\n", h.M.Unmatched.Total())
+	fmt.Fprintln(writer, "# HELP mox_connections_shed_total Number of connections closed because of connection limits")
+	fmt.Fprintln(writer, "# TYPE mox_connections_shed_total counter")
+	fmt.Fprintf(writer, "mox_connections_shed_total %d\n", h.M.Limits.Shed())
+	stats := h.M.Stats.Get()
+	fmt.Fprintln(writer, "# HELP mox_route_requests_total Number of requests served by each route")
+	fmt.Fprintln(writer, "# TYPE mox_route_requests_total counter")
+	for _, st := range stats {
+		fmt.Fprintf(writer, "mox_route_requests_total{route=%s} %d\n", promLabel(st.Route), st.Hits)
+	}
+	fmt.Fprintln(writer, "# HELP mox_faults_total Number of injected faults served, by route and type")
+	fmt.Fprintln(writer, "# TYPE mox_faults_total counter")
+	for _, st := range stats {
+		types := make([]string, 0, len(st.Faults))
+		for t := range st.Faults {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Fprintf(writer, "mox_faults_total{route=%s,type=%s} %d\n", promLabel(st.Route), promLabel(t), st.Faults[t])
+		}
+	}
+}
+
+// promLabel quotes a Prometheus label value
+func promLabel(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
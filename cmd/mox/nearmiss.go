@@ -0,0 +1,153 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// criterion is one of the conditions a route matches requests with
+	criterion struct {
+		name  string
+		match func(*http.Request) bool
+	}
+
+	// nearMiss is a route that matched some, but not all criteria of
+	// a request
+	nearMiss struct {
+		route   RouteRequest
+		matched []string
+		failed  []string
+	}
+)
+
+// maxNearMisses is the number of closest routes reported for an
+// unmatched request
+const maxNearMisses = 3
+
+// routeMatcher matches requests with a route that is not in a router
+func routeMatcher(route *mux.Route) func(*http.Request) bool {
+	return func(request *http.Request) bool {
+		var match mux.RouteMatch
+		return route.Match(request, &match)
+	}
+}
+
+// criteria returns the criteria of the route one by one
+func (h *MockHandler) criteria(r RouteRequest) []criterion {
+	var ret []criterion
+	if len(r.Method) > 0 {
+		method := r.Method
+		ret = append(ret, criterion{name: "method", match: func(request *http.Request) bool { return strings.EqualFold(request.Method, method) }})
+	}
+	if r.StaticDir != nil {
+		ret = append(ret, criterion{name: "path", match: routeMatcher(staticPath(mux.NewRouter(), r.Path))})
+	} else {
+		ret = append(ret, criterion{name: "path", match: routeMatcher(mux.NewRouter().Path(r.Path))})
+	}
+	for _, p := range r.Headers.CanonicalHeaders() {
+		ret = append(ret, criterion{name: "header " + p.Key, match: routeMatcher(mux.NewRouter().NewRoute().HeadersRegexp(p.Key, p.Value))})
+	}
+	for _, p := range r.Queries {
+		ret = append(ret, criterion{name: "query " + p.Key, match: routeMatcher(mux.NewRouter().Queries(p.Key, p.Value))})
+	}
+	if len(r.Host) > 0 {
+		ret = append(ret, criterion{name: "host", match: routeMatcher(mux.NewRouter().Host(r.Host))})
+	}
+	if len(r.SNI) > 0 {
+		ret = append(ret, criterion{name: "sni", match: sniMatcher(r.SNI)})
+	}
+	if r.ClientCert != nil {
+		ret = append(ret, criterion{name: "clientCert", match: clientCertMatcher(*r.ClientCert)})
+	}
+	if r.When != nil {
+		ret = append(ret, criterion{name: "when", match: whenMatcher(*r.When)})
+	}
+	if r.Body != nil {
+		ret = append(ret, criterion{name: "body", match: bodyMatcher(*r.Body)})
+	}
+	if r.JSONBody != nil {
+		ret = append(ret, criterion{name: "jsonBody", match: jsonBodyMatcher(*r.JSONBody)})
+	}
+	if r.Match != nil {
+		ret = append(ret, criterion{name: "match", match: matchExprMatcher(*r.Match)})
+	}
+	if r.GRPCWeb != nil {
+		ret = append(ret, criterion{name: "grpcWeb", match: grpcWebMatcher(*r.GRPCWeb)})
+	}
+	if len(r.Vars) > 0 {
+		ret = append(ret, criterion{name: "vars", match: varsMatcher(&h.Vars, r.Vars)})
+	}
+	if len(r.RequiredState) > 0 {
+		scenario, state := r.Scenario, r.RequiredState
+		ret = append(ret, criterion{name: "requiredState", match: func(*http.Request) bool { return h.Scenarios.State(scenario) == state }})
+	}
+	return ret
+}
+
+// nearMisses returns the routes that match the most criteria of an
+// unmatched request, closest first. The caller holds the read lock
+func (h *MockHandler) nearMisses(request *http.Request) []nearMiss {
+	if h.Router == nil {
+		return nil
+	}
+	var misses []nearMiss
+	h.Router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		r, ok := routeOf(route.GetHandler())
+		if !ok {
+			return nil
+		}
+		miss := nearMiss{route: r}
+		for _, c := range h.criteria(r) {
+			if c.match(request) {
+				miss.matched = append(miss.matched, c.name)
+			} else {
+				miss.failed = append(miss.failed, c.name)
+			}
+		}
+		if len(miss.matched) > 0 {
+			misses = append(misses, miss)
+		}
+		return nil
+	})
+	sort.SliceStable(misses, func(i, j int) bool { return len(misses[i].matched) > len(misses[j].matched) })
+	if len(misses) > maxNearMisses {
+		misses = misses[:maxNearMisses]
+	}
+	return misses
+}
+
+func (m nearMiss) String() string {
+	s := m.route.Name()
+	if len(m.route.ID) > 0 {
+		s += " (" + m.route.ID + ")"
+	}
+	return s + ": matched " + strings.Join(m.matched, ", ") + "; failed " + strings.Join(m.failed, ", ")
+}
+
+// nearMissReport describes the closest routes of an unmatched request
+func nearMissReport(request *http.Request, misses []nearMiss) string {
+	s := fmt.Sprintf("mox: no route matched %s %s, closest routes:\n", request.Method, request.URL.RequestURI())
+	for _, m := range misses {
+		s += "  " + m.String() + "\n"
+	}
+	return s
+}
@@ -0,0 +1,614 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// OpenAPI is the subset of an OpenAPI 3 (or Swagger 2) document
+	// used by mox
+	OpenAPI struct {
+		Paths      map[string]*PathItem `json:"paths"`
+		Components struct {
+			Schemas map[string]*Schema `json:"schemas"`
+		} `json:"components"`
+		// Definitions are Swagger 2 schemas
+		Definitions map[string]*Schema `json:"definitions"`
+		// BasePath is the Swagger 2 path prefix
+		BasePath string `json:"basePath"`
+	}
+
+	// PathItem has the operations of a path
+	PathItem struct {
+		Get     *Operation `json:"get"`
+		Put     *Operation `json:"put"`
+		Post    *Operation `json:"post"`
+		Delete  *Operation `json:"delete"`
+		Options *Operation `json:"options"`
+		Head    *Operation `json:"head"`
+		Patch   *Operation `json:"patch"`
+		Trace   *Operation `json:"trace"`
+		// Parameters are common to the operations of the path
+		Parameters []json.RawMessage `json:"parameters"`
+	}
+
+	// Operation is an API operation
+	Operation struct {
+		OperationID string               `json:"operationId"`
+		Responses   map[string]*Response `json:"responses"`
+	}
+
+	// Response is an operation response
+	Response struct {
+		Description string                `json:"description"`
+		Content     map[string]*MediaType `json:"content"`
+		// Schema is the response schema in Swagger 2
+		Schema *Schema `json:"schema"`
+		// Examples are the Swagger 2 examples by content type
+		Examples map[string]interface{} `json:"examples"`
+	}
+
+	// MediaType describes a response body of a content type
+	MediaType struct {
+		Schema   *Schema                   `json:"schema"`
+		Example  interface{}               `json:"example"`
+		Examples map[string]*ExampleObject `json:"examples"`
+	}
+
+	// ExampleObject is a named example of a media type
+	ExampleObject struct {
+		Value interface{} `json:"value"`
+	}
+
+	// Schema is a JSON schema as used in OpenAPI
+	Schema struct {
+		Ref                  string             `json:"$ref"`
+		Type                 string             `json:"type"`
+		Format               string             `json:"format"`
+		Properties           map[string]*Schema `json:"properties"`
+		AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+		Required             []string           `json:"required"`
+		Items                *Schema            `json:"items"`
+		Enum                 []interface{}      `json:"enum"`
+		AllOf                []*Schema          `json:"allOf"`
+		OneOf                []*Schema          `json:"oneOf"`
+		AnyOf                []*Schema          `json:"anyOf"`
+		Nullable             bool               `json:"nullable"`
+		Minimum              *float64           `json:"minimum"`
+		Maximum              *float64           `json:"maximum"`
+		MinLength            *int               `json:"minLength"`
+		MaxLength            *int               `json:"maxLength"`
+		Pattern              string             `json:"pattern"`
+		MinItems             *int               `json:"minItems"`
+		MaxItems             *int               `json:"maxItems"`
+		Example              interface{}        `json:"example"`
+	}
+
+	// APIOperation identifies an operation by method and path
+	APIOperation struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+	}
+
+	// InvalidStub is a stub whose response violates the spec
+	InvalidStub struct {
+		Route  string   `json:"route"`
+		Errors []string `json:"errors"`
+	}
+
+	// DiffReport is the result of comparing stubs with a spec
+	DiffReport struct {
+		// Missing operations have no stubs
+		Missing []APIOperation `json:"missing"`
+		// Invalid stubs return responses the spec does not allow
+		Invalid []InvalidStub `json:"invalid"`
+		// Undocumented stubs do not correspond to any operation
+		Undocumented []string `json:"undocumented"`
+	}
+)
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Operation returns the operation of the method, nil if there is none
+func (p *PathItem) Operation(method string) *Operation {
+	if p == nil {
+		return nil
+	}
+	switch strings.ToLower(method) {
+	case "get":
+		return p.Get
+	case "put":
+		return p.Put
+	case "post":
+		return p.Post
+	case "delete":
+		return p.Delete
+	case "options":
+		return p.Options
+	case "head":
+		return p.Head
+	case "patch":
+		return p.Patch
+	case "trace":
+		return p.Trace
+	}
+	return nil
+}
+
+// fullPath returns the path of a spec path under the Swagger 2 base
+// path
+func (spec *OpenAPI) fullPath(path string) string {
+	return strings.TrimSuffix(spec.BasePath, "/") + path
+}
+
+// ParseOpenAPI parses an OpenAPI document in JSON or YAML
+func ParseOpenAPI(rd io.Reader) (*OpenAPI, error) {
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] != '{' {
+		if data, err = YAMLToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+	var spec OpenAPI
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	if spec.Paths == nil {
+		return nil, errors.New("openapi: no paths in document")
+	}
+	return &spec, nil
+}
+
+// Resolve follows schema references
+func (spec *OpenAPI) Resolve(s *Schema) *Schema {
+	for i := 0; s != nil && len(s.Ref) > 0 && i < 32; i++ {
+		name := s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+		if x, ok := spec.Components.Schemas[name]; ok {
+			s = x
+		} else if x, ok := spec.Definitions[name]; ok {
+			s = x
+		} else {
+			return nil
+		}
+	}
+	return s
+}
+
+// pathSegments splits a path and replaces path variables with "{}"
+func pathSegments(path string) []string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segs {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			segs[i] = "{}"
+		}
+	}
+	return segs
+}
+
+// specPathMatches returns true if the stub path is served by the
+// spec path template
+func specPathMatches(specPath, stubPath string) bool {
+	spec, stub := pathSegments(specPath), pathSegments(stubPath)
+	if len(spec) != len(stub) {
+		return false
+	}
+	for i := range spec {
+		if spec[i] != "{}" && spec[i] != stub[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedPaths returns the spec paths, literal paths before templates
+// like routers match them
+func (spec *OpenAPI) sortedPaths() []string {
+	paths := make([]string, 0, len(spec.Paths))
+	for p := range spec.Paths {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		ni, nj := strings.Count(paths[i], "{"), strings.Count(paths[j], "{")
+		if ni == nj {
+			return paths[i] < paths[j]
+		}
+		return ni < nj
+	})
+	return paths
+}
+
+// FindOperation returns the method, the spec path and the operation
+// serving the route. The route path includes the base path. A route
+// without a method is served by the first operation of the path in
+// httpMethods order
+func (spec *OpenAPI) FindOperation(r RouteRequest) (string, string, *Operation) {
+	for _, p := range spec.sortedPaths() {
+		if !specPathMatches(spec.fullPath(p), r.Path) {
+			continue
+		}
+		for _, method := range httpMethods {
+			op := spec.Paths[p].Operation(method)
+			if op != nil && (len(r.Method) == 0 || strings.EqualFold(method, r.Method)) {
+				return strings.ToUpper(method), p, op
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// ResponseSchema returns the schema for the status and content type
+// of an operation response, or nil if the spec does not say
+func (op *Operation) ResponseSchema(status int, contentType string) (*Schema, bool) {
+	code := strconv.Itoa(status)
+	rsp, ok := op.Responses[code]
+	if !ok {
+		rsp, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		rsp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return nil, false
+	}
+	if rsp.Schema != nil {
+		return rsp.Schema, true
+	}
+	if mt, ok := rsp.Content[contentType]; ok {
+		return mt.Schema, true
+	}
+	return nil, true
+}
+
+// ValidateResponse validates the response of a route against the
+// spec. Only JSON bodies are checked against schemas
+func (spec *OpenAPI) ValidateResponse(op *Operation, status int, headers Pairs, body string) []string {
+	contentType := "application/json"
+	for _, h := range headers.CanonicalHeaders() {
+		if h.Key == "Content-Type" {
+			contentType, _, _ = mime.ParseMediaType(h.Value)
+		}
+	}
+	schema, ok := op.ResponseSchema(status, contentType)
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not a documented response", status)}
+	}
+	if schema == nil || !strings.HasSuffix(contentType, "json") {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return []string{"body is not valid JSON: " + err.Error()}
+	}
+	return spec.Validate(schema, value, "$")
+}
+
+// Validate validates a decoded JSON value against the schema and
+// returns the violations
+func (spec *OpenAPI) Validate(s *Schema, value interface{}, at string) []string {
+	s = spec.Resolve(s)
+	if s == nil {
+		return nil
+	}
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, at+": "+fmt.Sprintf(format, args...))
+	}
+	for _, sub := range s.AllOf {
+		errs = append(errs, spec.Validate(sub, value, at)...)
+	}
+	alts := make([]*Schema, 0, len(s.OneOf)+len(s.AnyOf))
+	alts = append(append(alts, s.OneOf...), s.AnyOf...)
+	if len(alts) > 0 {
+		matched := false
+		for _, sub := range alts {
+			if len(spec.Validate(sub, value, at)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("does not match any alternative")
+		}
+	}
+	if value == nil {
+		if !s.Nullable && len(s.Type) > 0 {
+			fail("null is not allowed")
+		}
+		return errs
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", value, s.Enum)
+		}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(s.Type) > 0 && s.Type != "object" {
+			fail("expected %s, got object", s.Type)
+			return errs
+		}
+		for _, req := range s.Required {
+			if _, ok := v[req]; !ok {
+				fail("missing required field %s", req)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				errs = append(errs, spec.Validate(prop, v[k], at+"."+k)...)
+			} else if string(s.AdditionalProperties) == "false" {
+				fail("unexpected field %s", k)
+			}
+		}
+	case []interface{}:
+		if len(s.Type) > 0 && s.Type != "array" {
+			fail("expected %s, got array", s.Type)
+			return errs
+		}
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("expected at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("expected at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, spec.Validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case string:
+		if len(s.Type) > 0 && s.Type != "string" {
+			fail("expected %s, got string", s.Type)
+			return errs
+		}
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			fail("shorter than %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && len(v) > *s.MaxLength {
+			fail("longer than %d", *s.MaxLength)
+		}
+		if len(s.Pattern) > 0 {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				fail("does not match pattern %s", s.Pattern)
+			}
+		}
+	case float64:
+		switch s.Type {
+		case "", "number":
+		case "integer":
+			if v != float64(int64(v)) {
+				fail("expected integer, got %v", v)
+			}
+		default:
+			fail("expected %s, got number", s.Type)
+			return errs
+		}
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("less than %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("greater than %v", *s.Maximum)
+		}
+	case bool:
+		if len(s.Type) > 0 && s.Type != "boolean" {
+			fail("expected %s, got boolean", s.Type)
+		}
+	}
+	return errs
+}
+
+// Response validation modes
+const (
+	validateRegister = "register"
+	validateServe    = "serve"
+)
+
+type (
+	// SpecViolation is a response that violated the spec when it was
+	// served
+	SpecViolation struct {
+		Route  string    `json:"route"`
+		Method string    `json:"method"`
+		Path   string    `json:"path"`
+		Errors []string  `json:"errors"`
+		Time   time.Time `json:"time"`
+		// Test is the correlation id of the request
+		Test string `json:"test,omitempty"`
+	}
+
+	// SpecViolations keeps the responses that violated the spec
+	SpecViolations struct {
+		sync.Mutex
+		violations []SpecViolation
+	}
+)
+
+// Add records a violation
+func (s *SpecViolations) Add(v SpecViolation) {
+	s.Lock()
+	s.violations = append(s.violations, v)
+	s.Unlock()
+}
+
+// Get returns the violations, only those with the correlation id if
+// test is not empty
+func (s *SpecViolations) Get(test string) []SpecViolation {
+	s.Lock()
+	defer s.Unlock()
+	var ret []SpecViolation
+	for _, v := range s.violations {
+		if len(test) == 0 || v.Test == test {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// Reset clears the violations
+func (s *SpecViolations) Reset() {
+	s.Lock()
+	s.violations = nil
+	s.Unlock()
+}
+
+// validateRoute validates the response of a route when it is
+// registered, if validation on registration is enabled
+func (h *MockHandler) validateRoute(r RouteRequest) error {
+	if h.Spec == nil || h.ValidateMode != validateRegister || len(r.Action) > 0 || r.StaticDir != nil {
+		return nil
+	}
+	_, _, op := h.Spec.FindOperation(r)
+	if op == nil {
+		return nil
+	}
+	for _, ret := range r.Responses() {
+		ret = ret.withBodyFile()
+		if errs := h.Spec.ValidateResponse(op, ret.Status, ret.Headers, ret.Body); len(errs) > 0 {
+			return fmt.Errorf("%s: response violates the spec: %s", r.Name(), strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// DiffOpenAPI compares routes with the spec
+func DiffOpenAPI(spec *OpenAPI, routes []RouteRequest) DiffReport {
+	report := DiffReport{Missing: []APIOperation{}, Invalid: []InvalidStub{}, Undocumented: []string{}}
+	covered := make(map[APIOperation]bool)
+	for _, r := range routes {
+		method, path, op := spec.FindOperation(r)
+		if op == nil {
+			report.Undocumented = append(report.Undocumented, r.Name())
+			continue
+		}
+		covered[APIOperation{Method: method, Path: path}] = true
+		for _, ret := range r.Responses() {
+			ret = ret.withBodyFile()
+			if errs := spec.ValidateResponse(op, ret.Status, ret.Headers, ret.Body); len(errs) > 0 {
+				report.Invalid = append(report.Invalid, InvalidStub{Route: r.Name(), Errors: errs})
+			}
+		}
+	}
+	for path, item := range spec.Paths {
+		for _, method := range httpMethods {
+			if item.Operation(method) == nil {
+				continue
+			}
+			op := APIOperation{Method: strings.ToUpper(method), Path: path}
+			if !covered[op] {
+				report.Missing = append(report.Missing, op)
+			}
+		}
+	}
+	sort.Slice(report.Missing, func(i, j int) bool {
+		if report.Missing[i].Path == report.Missing[j].Path {
+			return report.Missing[i].Method < report.Missing[j].Method
+		}
+		return report.Missing[i].Path < report.Missing[j].Path
+	})
+	return report
+}
+
+// serveOpenAPIDiff compares the current routes with the posted spec
+func (h *AdminHandler) serveOpenAPIDiff(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	spec, err := ParseOpenAPI(request.Body)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	h.M.RLock()
+	routes := make([]RouteRequest, len(h.Routes))
+	for i, r := range h.Routes {
+		routes[i] = *r
+	}
+	h.M.RUnlock()
+	ret, _ := json.Marshal(DiffOpenAPI(spec, routes))
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+// runAPIDiff runs the apidiff command:
+//
+//	mox apidiff SPEC FILE...
+//
+// It compares the routes in the files with the OpenAPI spec and exits
+// with status 2 if there are differences
+func runAPIDiff(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: mox apidiff SPEC FILE...")
+		os.Exit(1)
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	spec, err := ParseOpenAPI(file)
+	file.Close()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	a := AdminHandler{Routes: make([]*RouteRequest, 0), M: &MockHandler{}}
+	for _, f := range args[1:] {
+		if err := a.LoadFile(f); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	routes := make([]RouteRequest, len(a.Routes))
+	for i, r := range a.Routes {
+		routes[i] = *r
+	}
+	report := DiffOpenAPI(spec, routes)
+	out, _ := json.MarshalIndent(report, "", "    ")
+	fmt.Println(string(out))
+	if len(report.Missing)+len(report.Invalid)+len(report.Undocumented) > 0 {
+		os.Exit(2)
+	}
+}
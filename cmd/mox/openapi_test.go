@@ -0,0 +1,206 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testSwagger = `{
+  "swagger": "2.0",
+  "basePath": "/api/v1",
+  "paths": {
+    "/pets/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "type": "string"}],
+      "get": {"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}},
+      "delete": {"responses": {"204": {"description": "deleted"}}}
+    },
+    "/pets": {
+      "post": {"responses": {"201": {"description": "created", "examples": {"application/json": {"name": "rex"}}}}}
+    }
+  },
+  "definitions": {
+    "Pet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "age": {"type": "integer", "minimum": 0}}}
+  }
+}`
+
+const testOpenAPI3 = `openapi: 3.0.0
+paths:
+  /items:
+    parameters:
+      - name: limit
+        in: query
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              example: [1, 2]
+`
+
+func parseTestSpec(t *testing.T, doc string) *OpenAPI {
+	t.Helper()
+	spec, err := ParseOpenAPI(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestParseOpenAPI(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		path    string
+		methods []string
+		err     bool
+	}{
+		{name: "swagger with path parameters", doc: testSwagger, path: "/pets/{id}", methods: []string{"get", "delete"}},
+		{name: "yaml with path parameters", doc: testOpenAPI3, path: "/items", methods: []string{"get"}},
+		{name: "no paths", doc: `{"openapi": "3.0.0"}`, err: true},
+		{name: "invalid", doc: `{"paths": []}`, err: true},
+	}
+	for _, x := range tests {
+		spec, err := ParseOpenAPI(strings.NewReader(x.doc))
+		if x.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", x.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", x.name, err)
+			continue
+		}
+		item := spec.Paths[x.path]
+		if item == nil {
+			t.Errorf("%s: no path %s", x.name, x.path)
+			continue
+		}
+		for _, m := range x.methods {
+			if item.Operation(m) == nil {
+				t.Errorf("%s: no %s operation", x.name, m)
+			}
+		}
+	}
+}
+
+func TestFindOperation(t *testing.T) {
+	spec := parseTestSpec(t, testSwagger)
+	tests := []struct {
+		route  RouteRequest
+		method string
+		path   string
+	}{
+		{RouteRequest{Method: "GET", Path: "/api/v1/pets/1"}, "GET", "/pets/{id}"},
+		{RouteRequest{Method: "delete", Path: "/api/v1/pets/{id}"}, "DELETE", "/pets/{id}"},
+		{RouteRequest{Path: "/api/v1/pets/1"}, "GET", "/pets/{id}"},
+		{RouteRequest{Method: "POST", Path: "/api/v1/pets"}, "POST", "/pets"},
+		{RouteRequest{Method: "GET", Path: "/pets/1"}, "", ""},
+		{RouteRequest{Method: "PUT", Path: "/api/v1/pets/1"}, "", ""},
+	}
+	for _, x := range tests {
+		// Without a method, the same operation is found every time
+		for i := 0; i < 10; i++ {
+			method, path, _ := spec.FindOperation(x.route)
+			if method != x.method || path != x.path {
+				t.Errorf("%s: got %s %s, expected %s %s", x.route.Name(), method, path, x.method, x.path)
+				break
+			}
+		}
+	}
+}
+
+func TestDiffOpenAPIBasePath(t *testing.T) {
+	spec := parseTestSpec(t, testSwagger)
+	report := DiffOpenAPI(spec, []RouteRequest{
+		{Method: "GET", Path: "/api/v1/pets/{id}", Return: ReturnData{Status: 200, Body: `{"name":"rex","age":3}`}},
+		{Method: "GET", Path: "/other"},
+	})
+	if len(report.Missing) != 2 || report.Missing[0] != (APIOperation{Method: "POST", Path: "/pets"}) || report.Missing[1] != (APIOperation{Method: "DELETE", Path: "/pets/{id}"}) {
+		t.Errorf("missing: %v", report.Missing)
+	}
+	if len(report.Invalid) != 0 {
+		t.Errorf("invalid: %v", report.Invalid)
+	}
+	if len(report.Undocumented) != 1 || report.Undocumented[0] != "GET /other" {
+		t.Errorf("undocumented: %v", report.Undocumented)
+	}
+}
+
+func TestMockRoutes(t *testing.T) {
+	spec := parseTestSpec(t, testSwagger)
+	routes, err := spec.MockRoutes("/mock/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"POST /mock/api/v1/pets", "GET /mock/api/v1/pets/{id}", "DELETE /mock/api/v1/pets/{id}"}
+	if len(routes) != len(want) {
+		t.Fatalf("got %d routes", len(routes))
+	}
+	for i, r := range routes {
+		if r.Name() != want[i] {
+			t.Errorf("route %d: got %s, expected %s", i, r.Name(), want[i])
+		}
+	}
+	if routes[0].Return.Status != 201 || routes[0].Return.Body != "{\n  \"name\": \"rex\"\n}" {
+		t.Errorf("example response: %+v", routes[0].Return)
+	}
+	if routes[1].Return.Body != "{\n  \"age\": 1,\n  \"name\": \"name\"\n}" {
+		t.Errorf("synthesized response: %q", routes[1].Return.Body)
+	}
+	if routes[2].Return.Status != 204 || len(routes[2].Return.Body) != 0 {
+		t.Errorf("no content response: %+v", routes[2].Return)
+	}
+}
+
+func TestServeSpecViolation(t *testing.T) {
+	a := &AdminHandler{Routes: make([]*RouteRequest, 0), M: &MockHandler{Spec: parseTestSpec(t, testSwagger), ValidateMode: validateServe}}
+	a.M.Lock()
+	err := a.addRoutes([]RouteRequest{
+		{Method: "GET", Path: "/api/v1/pets/{id}", Return: ReturnData{Status: http.StatusOK, Body: `{"age": -1}`}},
+		{Method: "POST", Path: "/api/v1/pets", Return: ReturnData{Status: http.StatusCreated, Body: `{"name": "rex"}`}},
+	})
+	a.M.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []string{logNone, logSummary} {
+		a.M.Violations.Reset()
+		a.M.LogLevel = level
+		var rec int
+		out := captureStdout(t, func() {
+			rec = serve(a, "GET", "/api/v1/pets/1", "").Code
+			serve(a, "POST", "/api/v1/pets", "")
+		})
+		if rec != http.StatusInternalServerError {
+			t.Errorf("got %d", rec)
+		}
+		if logged := strings.Contains(out, "violates the spec"); logged != (level != logNone) {
+			t.Errorf("level %s: got %q", level, out)
+		}
+		ret := a.M.VerifyAll("")
+		if ret.Pass || len(ret.SpecViolations) != 1 || ret.SpecViolations[0].Route != "GET /api/v1/pets/{id}" || len(ret.SpecViolations[0].Errors) == 0 {
+			t.Errorf("verify: %+v", ret)
+		}
+	}
+	a.Reset()
+	if ret := a.M.VerifyAll(""); !ret.Pass {
+		t.Errorf("reset kept the violations: %+v", ret)
+	}
+}
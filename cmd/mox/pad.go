@@ -0,0 +1,48 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// paddingOverhead is the size of an empty padding field
+const paddingOverhead = len(`,"_padding":""`)
+
+// Pad pads the body to size bytes. A JSON object gets a "_padding"
+// field, other JSON values are padded with trailing whitespace, so the
+// body stays valid JSON. Other bodies are padded with '.'. Bodies
+// that are already large enough are not changed
+func Pad(body string, size int) string {
+	n := size - len(body)
+	if n <= 0 {
+		return body
+	}
+	trimmed := strings.TrimSpace(body)
+	var v interface{}
+	if json.Unmarshal([]byte(trimmed), &v) != nil {
+		return body + strings.Repeat(".", n)
+	}
+	if strings.HasPrefix(trimmed, "{") && len(trimmed) == len(body) {
+		if trimmed == "{}" && n >= paddingOverhead-1 {
+			return `{"_padding":"` + strings.Repeat("x", n-paddingOverhead+1) + `"}`
+		}
+		if trimmed != "{}" && n >= paddingOverhead {
+			return body[:len(body)-1] + `,"_padding":"` + strings.Repeat("x", n-paddingOverhead) + `"}`
+		}
+	}
+	return body + strings.Repeat(" ", n)
+}
@@ -0,0 +1,290 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Link layer types in pcap files
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+)
+
+type (
+	// tcpFlow identifies one direction of a TCP connection
+	tcpFlow struct {
+		Src, Dst string
+	}
+
+	tcpSegment struct {
+		Seq  uint32
+		Data []byte
+	}
+
+	// tcpStream collects the segments of a flow
+	tcpStream struct {
+		First    time.Time
+		Segments []tcpSegment
+	}
+
+	// PcapReader converts HTTP exchanges captured in a pcap file to routes
+	PcapReader struct {
+		streams map[tcpFlow]*tcpStream
+	}
+)
+
+// ErrNotPcap is returned if the file is not in pcap format. pcapng
+// files have to be converted with editcap -F pcap first
+var ErrNotPcap = errors.New("pcap: not a pcap file")
+
+// Read reads all packets from a pcap file
+func (p *PcapReader) Read(rd io.Reader) error {
+	p.streams = make(map[tcpFlow]*tcpStream)
+	var hdr [24]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		return ErrNotPcap
+	}
+	var order binary.ByteOrder
+	nano := false
+	switch binary.LittleEndian.Uint32(hdr[0:4]) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0x4d3cb2a1:
+		order, nano = binary.BigEndian, true
+	default:
+		return ErrNotPcap
+	}
+	link := order.Uint32(hdr[20:24])
+	var rec [16]byte
+	for {
+		if _, err := io.ReadFull(rd, rec[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		sec := int64(order.Uint32(rec[0:4]))
+		frac := int64(order.Uint32(rec[4:8]))
+		if !nano {
+			frac *= 1000
+		}
+		data := make([]byte, order.Uint32(rec[8:12]))
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return err
+		}
+		p.packet(link, data, time.Unix(sec, frac))
+	}
+}
+
+// packet decodes the link and IP layers and collects TCP payload
+func (p *PcapReader) packet(link uint32, data []byte, ts time.Time) {
+	var ipPacket []byte
+	switch link {
+	case linkEthernet:
+		if len(data) < 14 {
+			return
+		}
+		etype := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		if etype == 0x8100 && len(data) >= 4 {
+			etype = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		if etype != 0x0800 && etype != 0x86dd {
+			return
+		}
+		ipPacket = data
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return
+		}
+		ipPacket = data[16:]
+	case linkNull:
+		if len(data) < 4 {
+			return
+		}
+		ipPacket = data[4:]
+	case linkRaw:
+		ipPacket = data
+	default:
+		return
+	}
+	if len(ipPacket) == 0 {
+		return
+	}
+	var src, dst net.IP
+	var tcp []byte
+	switch ipPacket[0] >> 4 {
+	case 4:
+		ihl := int(ipPacket[0]&0x0f) * 4
+		if len(ipPacket) < 20 || ipPacket[9] != 6 {
+			return
+		}
+		total := int(binary.BigEndian.Uint16(ipPacket[2:4]))
+		if total > len(ipPacket) || ihl > total {
+			return
+		}
+		src, dst = net.IP(ipPacket[12:16]), net.IP(ipPacket[16:20])
+		tcp = ipPacket[ihl:total]
+	case 6:
+		if len(ipPacket) < 40 || ipPacket[6] != 6 {
+			return
+		}
+		total := 40 + int(binary.BigEndian.Uint16(ipPacket[4:6]))
+		if total > len(ipPacket) {
+			return
+		}
+		src, dst = net.IP(ipPacket[8:24]), net.IP(ipPacket[24:40])
+		tcp = ipPacket[40:total]
+	default:
+		return
+	}
+	if len(tcp) < 20 {
+		return
+	}
+	offset := int(tcp[12]>>4) * 4
+	if offset > len(tcp) || offset == len(tcp) {
+		return
+	}
+	flow := tcpFlow{
+		Src: net.JoinHostPort(src.String(), strconv.Itoa(int(binary.BigEndian.Uint16(tcp[0:2])))),
+		Dst: net.JoinHostPort(dst.String(), strconv.Itoa(int(binary.BigEndian.Uint16(tcp[2:4])))),
+	}
+	stream, ok := p.streams[flow]
+	if !ok {
+		stream = &tcpStream{First: ts}
+		p.streams[flow] = stream
+	}
+	stream.Segments = append(stream.Segments, tcpSegment{Seq: binary.BigEndian.Uint32(tcp[4:8]),
+		Data: append([]byte(nil), tcp[offset:]...)})
+}
+
+// Bytes reassembles the stream, dropping retransmitted data
+func (s *tcpStream) Bytes() []byte {
+	if len(s.Segments) == 0 {
+		return nil
+	}
+	base := s.Segments[0].Seq
+	for _, seg := range s.Segments {
+		if int32(seg.Seq-base) < 0 {
+			base = seg.Seq
+		}
+	}
+	sort.SliceStable(s.Segments, func(i, j int) bool {
+		return s.Segments[i].Seq-base < s.Segments[j].Seq-base
+	})
+	var buf bytes.Buffer
+	next := uint32(0)
+	for _, seg := range s.Segments {
+		rel := seg.Seq - base
+		end := rel + uint32(len(seg.Data))
+		if end <= next {
+			continue
+		}
+		if rel < next {
+			seg.Data = seg.Data[next-rel:]
+		}
+		buf.Write(seg.Data)
+		next = end
+	}
+	return buf.Bytes()
+}
+
+// Routes pairs requests and responses in the captured TCP streams
+// and returns them as routes in capture order
+func (p *PcapReader) Routes() []RouteRequest {
+	flows := make([]tcpFlow, 0, len(p.streams))
+	for flow := range p.streams {
+		flows = append(flows, flow)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		return p.streams[flows[i]].First.Before(p.streams[flows[j]].First)
+	})
+	routes := make([]RouteRequest, 0)
+	for _, flow := range flows {
+		reply, ok := p.streams[tcpFlow{Src: flow.Dst, Dst: flow.Src}]
+		if !ok {
+			continue
+		}
+		reqRd := bufio.NewReader(bytes.NewReader(p.streams[flow].Bytes()))
+		rspRd := bufio.NewReader(bytes.NewReader(reply.Bytes()))
+		for {
+			request, err := http.ReadRequest(reqRd)
+			if err != nil {
+				// Not an HTTP client stream, or end of stream
+				break
+			}
+			ioutil.ReadAll(request.Body)
+			response, err := http.ReadResponse(rspRd, request)
+			if err != nil {
+				break
+			}
+			body, _ := ioutil.ReadAll(response.Body)
+			routes = append(routes, RouteFromExchange(request, response, body))
+		}
+	}
+	return routes
+}
+
+// runPcap runs the pcap command:
+//
+//	mox pcap FILE
+//
+// It writes the HTTP exchanges captured in the pcap file as routes
+// to stdout
+func runPcap(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: mox pcap FILE")
+		os.Exit(1)
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	p := PcapReader{}
+	if err := p.Read(bufio.NewReader(file)); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	routes := p.Routes()
+	for i := range routes {
+		routes[i] = domainMap.RewriteRoute(routes[i])
+	}
+	out, _ := json.MarshalIndent(routes, "", "    ")
+	fmt.Println(string(out))
+}
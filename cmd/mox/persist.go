@@ -0,0 +1,110 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// persistFile is the file in the persist directory the routes added
+// with the admin API are saved to
+const persistFile = "routes.json"
+
+// withSource marks routes as loaded from a stub file or source, so
+// they are not saved with the routes added with the admin API
+func withSource(reqs []RouteRequest, source string) []RouteRequest {
+	for i := range reqs {
+		reqs[i].source = source
+	}
+	return reqs
+}
+
+// APIRoutes returns the routes added with the admin API, the routes
+// that were not loaded from stub files. The caller holds the lock of
+// the mock handler
+func (h *AdminHandler) APIRoutes() []RouteRequest {
+	ret := []RouteRequest{}
+	for _, r := range h.Routes {
+		if len(r.source) == 0 {
+			ret = append(ret, *r)
+		}
+	}
+	return ret
+}
+
+// Persist loads the routes saved in dir, and saves the routes added
+// with the admin API there whenever the routes change
+func (h *AdminHandler) Persist(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, persistFile)
+	var reqs []RouteRequest
+	if _, err := os.Stat(file); err == nil {
+		if reqs, err = ReadStubFile(file); err != nil {
+			return err
+		}
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	if err := h.addRoutes(reqs); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	h.PersistFile = file
+	return nil
+}
+
+// saveRoutes writes the routes added with the admin API to the persist
+// file. The caller holds the lock of the mock handler
+func (h *AdminHandler) saveRoutes() error {
+	if len(h.PersistFile) == 0 {
+		return errors.New("no -persist directory")
+	}
+	data, _ := json.MarshalIndent(h.APIRoutes(), "", "    ")
+	tmp := h.PersistFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.PersistFile)
+}
+
+// serveSnapshot returns the routes added with the admin API with GET.
+// POST also saves them to the persist directory
+func (h *AdminHandler) serveSnapshot(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	h.M.Lock()
+	routes := h.APIRoutes()
+	var err error
+	if request.Method == http.MethodPost {
+		err = h.saveRoutes()
+	}
+	h.M.Unlock()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	ret, _ := json.MarshalIndent(routes, "", "    ")
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
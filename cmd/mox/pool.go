@@ -0,0 +1,86 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+)
+
+// maxPooledBuffer is the capacity of the largest buffer returned to
+// the pool, so a few large bodies do not keep their memory
+const maxPooledBuffer = 64 * 1024
+
+// bufferPool holds the buffers used while serving requests
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool. The buffer must not be
+// used after this
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// captureBody reads the request body and restores it for later
+// readers. The body is read into a pooled buffer, so only the
+// returned copy is allocated
+func captureBody(request *http.Request) []byte {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if request.Body != nil {
+		buf.ReadFrom(request.Body)
+	}
+	body := append([]byte(nil), buf.Bytes()...)
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+// maxParsedTemplates limits the number of parsed templates kept
+const maxParsedTemplates = 1024
+
+// parsedTemplates keeps templates of routes parsed once, by source
+var parsedTemplates = struct {
+	sync.Mutex
+	m map[string]*template.Template
+}{m: make(map[string]*template.Template)}
+
+// parseTemplate returns the parsed template for the source
+func parseTemplate(s string) (*template.Template, error) {
+	parsedTemplates.Lock()
+	defer parsedTemplates.Unlock()
+	if t, ok := parsedTemplates.m[s]; ok {
+		return t, nil
+	}
+	t, err := template.New("route").Funcs(templateFuncs).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsedTemplates.m) >= maxParsedTemplates {
+		parsedTemplates.m = make(map[string]*template.Template)
+	}
+	parsedTemplates.m[s] = t
+	return t, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Problem describes an RFC 7807 problem document returned as the
+// response body. Type, Title, Detail and Instance are text/templates
+// executed with the ErrorData of the request, so they can refer to
+// the request path or method
+type Problem struct {
+	// Type defaults to about:blank, and Title to the status text
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions are additional members of the problem document
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Validate checks the templates of the problem
+func (p *Problem) Validate() error {
+	for _, s := range []string{p.Type, p.Title, p.Detail, p.Instance} {
+		if _, err := parseTemplate(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render returns the problem document for the status and request
+func (p *Problem) Render(status int, request *http.Request) string {
+	data := newErrorData(status, request)
+	expand := func(s string) string {
+		tmpl, err := parseTemplate(s)
+		if err != nil {
+			return s
+		}
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if tmpl.Execute(buf, data) != nil {
+			return s
+		}
+		return buf.String()
+	}
+	doc := jsonObject{{Name: "type", Value: "about:blank"}}
+	if len(p.Type) > 0 {
+		doc[0].Value = expand(p.Type)
+	}
+	title := data.Title
+	if len(p.Title) > 0 {
+		title = expand(p.Title)
+	}
+	doc = append(doc, jsonField{Name: "title", Value: title}, jsonField{Name: "status", Value: status})
+	if len(p.Detail) > 0 {
+		doc = append(doc, jsonField{Name: "detail", Value: expand(p.Detail)})
+	}
+	if len(p.Instance) > 0 {
+		doc = append(doc, jsonField{Name: "instance", Value: expand(p.Instance)})
+	}
+	names := make([]string, 0, len(p.Extensions))
+	for name := range p.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc = append(doc, jsonField{Name: name, Value: p.Extensions[name]})
+	}
+	out, _ := json.Marshal(doc)
+	return string(out)
+}
+
+// problem renders the problem of the response into its body
+func (ret ReturnData) problem(request *http.Request) ReturnData {
+	if ret.Problem == nil {
+		return ret
+	}
+	ret.Body = ret.Problem.Render(ret.Status, request)
+	if !hasContentType(ret.Headers) {
+		ret.Headers = append(append(Pairs(nil), ret.Headers...), Pair{Key: "Content-Type", Value: "application/problem+json"})
+	}
+	return ret
+}
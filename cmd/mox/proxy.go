@@ -0,0 +1,248 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Proxy forwards requests to an upstream, and can record the
+	// exchanges as routes that can be loaded later to run without
+	// the upstream
+	Proxy struct {
+		sync.Mutex
+		// Upstream is the base URL requests are forwarded to
+		Upstream *url.URL
+		// All forwards all requests instead of the ones no route matches
+		All bool
+		// Record records the exchanges
+		Record bool
+		// File, if set, is rewritten with the recorded routes after
+		// each new recording
+		File string
+		// Domains rewrites links to the upstream in the recordings
+		Domains DomainMap
+		// Cassettes, if set, also get the recordings of the requests
+		// that have a cassette
+		Cassettes *Cassettes
+		client    *http.Client
+		recorded  []RouteRequest
+	}
+
+	// Forward passes requests under a path prefix that match no route
+	// through to a real service
+	Forward struct {
+		Prefix string
+		Proxy  *Proxy
+	}
+
+	// Forwards are the forward targets by path prefix
+	Forwards []Forward
+)
+
+// proxyHopHeaders are request headers that are not forwarded
+var proxyHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// NewProxy returns a proxy to the upstream base URL
+func NewProxy(upstream string) (*Proxy, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("proxy: upstream must be an http or https URL: " + upstream)
+	}
+	return &Proxy{Upstream: u, client: &http.Client{Timeout: 15 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}}, nil
+}
+
+// ServeHTTP forwards the request to the upstream, writes the upstream
+// response, and records the exchange
+func (p *Proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body := captureBody(request)
+	u := *p.Upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + request.URL.Path
+	u.RawQuery = request.URL.RawQuery
+	out, err := http.NewRequest(request.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(writer, "mox: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	for k, v := range request.Header {
+		if !proxyHopHeaders[k] {
+			out.Header[k] = v
+		}
+	}
+	response, err := p.client.Do(out)
+	if err != nil {
+		http.Error(writer, "mox: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		http.Error(writer, "mox: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	for k, v := range response.Header {
+		if !hopHeaders[k] {
+			writer.Header()[k] = v
+		}
+	}
+	writer.WriteHeader(response.StatusCode)
+	writer.Write(data)
+	if p.Record {
+		route := p.Domains.RewriteRoute(RouteFromExchange(request, response, data))
+		p.record(route)
+		if p.Cassettes != nil {
+			p.Cassettes.Record(request, route)
+		}
+	}
+}
+
+// record adds a recorded route, replacing an earlier recording of an
+// equivalent route, and saves the recordings if there is a file
+func (p *Proxy) record(route RouteRequest) {
+	p.Lock()
+	defer p.Unlock()
+	replaced := false
+	for i := range p.recorded {
+		if RoutesEq(&p.recorded[i], &route) {
+			p.recorded[i] = route
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		p.recorded = append(p.recorded, route)
+	}
+	if len(p.File) > 0 {
+		data, _ := json.MarshalIndent(p.recorded, "", "    ")
+		if err := ioutil.WriteFile(p.File, data, 0644); err != nil {
+			fmt.Println("mox: cannot save recordings:", err)
+		}
+	}
+}
+
+// Recordings returns a copy of the recorded routes
+func (p *Proxy) Recordings() []RouteRequest {
+	p.Lock()
+	defer p.Unlock()
+	return append([]RouteRequest{}, p.recorded...)
+}
+
+// WarmStart adds the routes recorded in an earlier run to the file of
+// the proxy as routes, if the file exists, so only the requests they
+// do not match are forwarded. New recordings are added to them in the
+// file
+func (h *AdminHandler) WarmStart() error {
+	p := h.M.Proxy
+	if _, err := os.Stat(p.File); os.IsNotExist(err) {
+		return nil
+	}
+	reqs, err := ReadStubFile(p.File)
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	p.recorded = append([]RouteRequest{}, reqs...)
+	p.Unlock()
+	h.M.Lock()
+	defer h.M.Unlock()
+	return h.addRoutes(withSource(reqs, p.File))
+}
+
+// Reset clears the recorded routes
+func (p *Proxy) Reset() {
+	p.Lock()
+	p.recorded = nil
+	p.Unlock()
+}
+
+func (f *Forwards) String() string {
+	s := make([]string, len(*f))
+	for i, x := range *f {
+		s[i] = x.Prefix + "=" + x.Proxy.Upstream.String()
+	}
+	return strings.Join(s, ",")
+}
+
+// Set adds a forward target of the form prefix=url
+func (f *Forwards) Set(value string) error {
+	eq := strings.Index(value, "=")
+	if eq <= 0 || !strings.HasPrefix(value, "/") {
+		return errors.New("expecting /prefix=url, got " + value)
+	}
+	p, err := NewProxy(value[eq+1:])
+	if err != nil {
+		return err
+	}
+	*f = append(*f, Forward{Prefix: value[:eq], Proxy: p})
+	return nil
+}
+
+// Get returns the proxy of the longest prefix the path is under, nil
+// if there is none
+func (f Forwards) Get(path string) *Proxy {
+	var ret *Proxy
+	longest := -1
+	for _, x := range f {
+		prefix := strings.TrimSuffix(x.Prefix, "/")
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > longest {
+			ret, longest = x.Proxy, len(prefix)
+		}
+	}
+	return ret
+}
+
+// serveRecordings returns the recorded routes with GET, and clears
+// them with DELETE
+func (h *AdminHandler) serveRecordings(writer http.ResponseWriter, request *http.Request) {
+	if h.M.Proxy == nil {
+		http.NotFound(writer, request)
+		return
+	}
+	switch request.Method {
+	case http.MethodGet:
+		ret, _ := json.MarshalIndent(h.M.Proxy.Recordings(), "", "    ")
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(ret)
+	case http.MethodDelete:
+		h.M.Proxy.Reset()
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand is a random source safe for concurrent use
+type lockedRand struct {
+	sync.Mutex
+	r *rand.Rand
+}
+
+var rnd = lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Intn returns a random number in [0,n)
+func (l *lockedRand) Intn(n int) int {
+	l.Lock()
+	defer l.Unlock()
+	return l.r.Intn(n)
+}
+
+// Float64 returns a random number in [0,1)
+func (l *lockedRand) Float64() float64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.r.Float64()
+}
+
+// NormFloat64 returns a normally distributed number with mean 0 and
+// standard deviation 1
+func (l *lockedRand) NormFloat64() float64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.r.NormFloat64()
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type (
+	// RateLimit limits the requests to a route with a token bucket,
+	// and emits rate limit headers. Requests over the limit get 429
+	RateLimit struct {
+		// Limit is the bucket size, the number of requests allowed
+		// in a burst
+		Limit int `json:"limit"`
+		// Per is the duration in which a full bucket is refilled
+		Per string `json:"per"`
+		// Headers selects the headers to emit: "x" for
+		// X-RateLimit-*, "draft" for RateLimit-*, or "both" (default)
+		Headers string `json:"headers,omitempty"`
+	}
+
+	// tokenBucket is the state of a rate limit
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+// Rate limit header styles
+const (
+	rateHeadersX     = "x"
+	rateHeadersDraft = "draft"
+	rateHeadersBoth  = "both"
+)
+
+// Validate checks the rate limit definition
+func (r *RateLimit) Validate() error {
+	if r.Limit <= 0 {
+		return errors.New("rateLimit: limit must be positive")
+	}
+	if d, err := time.ParseDuration(r.Per); err != nil || d <= 0 {
+		return errors.New("rateLimit: per must be a positive duration")
+	}
+	switch r.Headers {
+	case "", rateHeadersX, rateHeadersDraft, rateHeadersBoth:
+	default:
+		return errors.New("rateLimit: unknown headers " + r.Headers)
+	}
+	return nil
+}
+
+// Take takes a token from the bucket kept in the route state, and
+// adds the rate limit headers to the response. If there are no tokens
+// left, it writes a 429 response and returns false
+func (r *RateLimit) Take(st *RouteState, writer http.ResponseWriter) bool {
+	per, _ := time.ParseDuration(r.Per)
+	rate := float64(r.Limit) / per.Seconds()
+	now := time.Now()
+
+	st.Lock()
+	if st.bucket == nil {
+		st.bucket = &tokenBucket{tokens: float64(r.Limit), last: now}
+	}
+	b := st.bucket
+	b.tokens = math.Min(float64(r.Limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	ok := b.tokens >= 1
+	if ok {
+		b.tokens--
+	}
+	tokens := b.tokens
+	st.Unlock()
+
+	remaining := int(tokens)
+	// Reset is when the bucket is full again
+	reset := int(math.Ceil((float64(r.Limit) - tokens) / rate))
+	r.setHeaders(writer.Header(), remaining, reset)
+	if ok {
+		return true
+	}
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/rate))))
+	data, _ := json.Marshal(authError{Error: "rate_limited", Message: "too many requests"})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusTooManyRequests)
+	writer.Write(data)
+	return false
+}
+
+func (r *RateLimit) setHeaders(header http.Header, remaining, reset int) {
+	if r.Headers != rateHeadersDraft {
+		header.Set("X-RateLimit-Limit", strconv.Itoa(r.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix()+int64(reset), 10))
+	}
+	if r.Headers != rateHeadersX {
+		header.Set("RateLimit-Limit", strconv.Itoa(r.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(reset))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// hopHeaders are response headers that are not recorded, since they
+// describe the recorded connection and not the response
+var hopHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// RouteFromExchange builds a route that replays a recorded request and
+// response. The body is the decoded response body. Gzip encoded
+// bodies are stored decompressed.
+func RouteFromExchange(request *http.Request, response *http.Response, body []byte) RouteRequest {
+	route := RouteRequest{Method: request.Method, Path: request.URL.Path}
+	query := request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range query[k] {
+			route.Queries = append(route.Queries, Pair{Key: k, Value: v})
+		}
+	}
+	gzipped := response.Header.Get("Content-Encoding") == "gzip"
+	if gzipped {
+		if rd, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+			if data, err := ioutil.ReadAll(rd); err == nil {
+				body = data
+			} else {
+				gzipped = false
+			}
+		} else {
+			gzipped = false
+		}
+	}
+	route.Return.Status = response.StatusCode
+	keys = keys[:0]
+	for k := range response.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if hopHeaders[k] || (gzipped && k == "Content-Encoding") {
+			continue
+		}
+		for _, v := range response.Header[k] {
+			route.Return.Headers = append(route.Return.Headers, Pair{Key: k, Value: v})
+		}
+	}
+	route.Return.Body = string(body)
+	return route
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RemoteSource is a stub file fetched from a URL, an S3 bucket or a
+// git repository. Its routes are replaced when it is refreshed and
+// has changed
+type RemoteSource struct {
+	// URL is http(s)://..., s3://bucket/key or git+URL#path
+	URL    string
+	hash   [sha256.Size]byte
+	routes []*RouteRequest
+}
+
+// remoteClient fetches remote stub files
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// IsRemote returns true if the stub file name is a remote source
+func IsRemote(name string) bool {
+	for _, prefix := range []string{"http://", "https://", "s3://", "git+"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch downloads the source into dir, and returns the name of the
+// stub file
+func (s *RemoteSource) fetch(dir string) (string, error) {
+	if strings.HasPrefix(s.URL, "git+") {
+		repo := strings.TrimPrefix(s.URL, "git+")
+		file := ""
+		if hash := strings.LastIndex(repo, "#"); hash != -1 {
+			repo, file = repo[:hash], repo[hash+1:]
+		}
+		if len(file) == 0 {
+			return "", errors.New("expecting git+URL#PATH")
+		}
+		out, err := exec.Command("git", "clone", "--quiet", "--depth", "1", repo, dir).CombinedOutput()
+		if err != nil {
+			return "", errors.New(strings.TrimSpace(string(out)))
+		}
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+file)))
+		return name, nil
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "s3" {
+		// Public objects, or presigned URLs given as https
+		u = &url.URL{Scheme: "https", Host: u.Host + ".s3.amazonaws.com", Path: u.Path}
+	}
+	rsp, err := remoteClient.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return "", errors.New(rsp.Status)
+	}
+	base := path.Base(u.Path)
+	if !isBundle(base) && !isStubFile(base) {
+		base = "stubs.json"
+	}
+	name := filepath.Join(dir, base)
+	file, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, rsp.Body)
+	file.Close()
+	return name, err
+}
+
+// read fetches and reads the routes of the source, verifying it with
+// the manifest if there is one. changed is false if the routes are the
+// same as the last time
+func (s *RemoteSource) read(manifest *Manifest) (reqs []RouteRequest, changed bool, err error) {
+	dir, err := ioutil.TempDir("", "mox-remote")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(dir)
+	name, err := s.fetch(filepath.Join(dir, "src"))
+	if err == nil && manifest != nil {
+		if err = manifest.Verify(s.URL, name); err != nil {
+			return nil, false, err
+		}
+	}
+	if err == nil {
+		reqs, err = ReadStubFile(name)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %s", s.URL, strings.TrimPrefix(err.Error(), dir+string(filepath.Separator)))
+	}
+	data, _ := json.Marshal(reqs)
+	hash := sha256.Sum256(data)
+	changed = hash != s.hash
+	s.hash = hash
+	return reqs, changed, nil
+}
+
+// AddSource loads the routes of a remote source, and keeps the source
+// to refresh it later
+func (h *AdminHandler) AddSource(u string) error {
+	s := &RemoteSource{URL: u}
+	if err := h.refreshSource(s); err != nil {
+		return err
+	}
+	h.Sources = append(h.Sources, s)
+	return nil
+}
+
+// RefreshSources fetches all remote sources again, and replaces the
+// routes of the sources that have changed
+func (h *AdminHandler) RefreshSources() []error {
+	var errs []error
+	for _, s := range h.Sources {
+		if err := h.refreshSource(s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (h *AdminHandler) refreshSource(s *RemoteSource) error {
+	reqs, changed, err := s.read(h.Manifest)
+	if err != nil || !changed {
+		return err
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	routes, err := h.replaceRoutes(s.routes, withSource(reqs, s.URL))
+	if err != nil {
+		s.hash = [sha256.Size]byte{}
+		return fmt.Errorf("%s: %s", s.URL, err)
+	}
+	s.routes = routes
+	return nil
+}
+
+// replaceRoutes replaces the routes owned by a source with reqs, and
+// returns the new routes of the source. If the new routes cannot be
+// added, the routes are left unchanged. The caller holds the lock of
+// the mock handler
+func (h *AdminHandler) replaceRoutes(owned []*RouteRequest, reqs []RouteRequest) ([]*RouteRequest, error) {
+	old := h.Routes
+	isOwned := make(map[*RouteRequest]bool)
+	for _, r := range owned {
+		isOwned[r] = true
+	}
+	kept := make([]*RouteRequest, 0, len(h.Routes))
+	for _, r := range h.Routes {
+		if !isOwned[r] {
+			kept = append(kept, r)
+		}
+	}
+	h.Routes = kept
+	if err := h.addRoutes(reqs); err != nil {
+		h.Routes = old
+		return nil, err
+	}
+	return append([]*RouteRequest(nil), h.Routes[len(kept):]...), nil
+}
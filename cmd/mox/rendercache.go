@@ -0,0 +1,121 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RenderCache reuses the rendered response of a templated route for
+// requests with the same template inputs, trading freshness for
+// throughput with expensive templates
+type RenderCache struct {
+	// TTL is how long a rendered response is reused, like "30s"
+	TTL string `json:"ttl"`
+	// Key is a template whose output identifies the template inputs.
+	// By default, they are the method, path, query and body
+	Key string `json:"key,omitempty"`
+	// Size is the maximum number of cached responses, 1000 by default
+	Size int `json:"size,omitempty"`
+}
+
+type renderedEntry struct {
+	ret     ReturnData
+	expires time.Time
+}
+
+const defaultRenderCacheSize = 1000
+
+// Validate checks the TTL, the size and the key template
+func (c *RenderCache) Validate() error {
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return errors.New("renderCache: " + err.Error())
+	}
+	if ttl <= 0 || c.Size < 0 {
+		return errors.New("renderCache: ttl must be positive and size not negative")
+	}
+	if len(c.Key) > 0 {
+		if _, err := parseTemplate(c.Key); err != nil {
+			return errors.New("renderCache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// key returns the cache key of the response for the request. The
+// unrendered response is part of the key, since variants and
+// sequences give different templates for a route
+func (c *RenderCache) key(ret ReturnData, data TemplateData, request *http.Request) (string, error) {
+	h := sha256.New()
+	response, err := json.Marshal(ret)
+	if err != nil {
+		return "", err
+	}
+	h.Write(response)
+	if len(c.Key) > 0 {
+		tmpl, err := parseTemplate(c.Key)
+		if err != nil {
+			return "", err
+		}
+		if err := tmpl.Execute(h, data); err != nil {
+			return "", err
+		}
+	} else {
+		fmt.Fprintf(h, "\x00%s\x00%s\x00%s\x00%s", request.Method, request.URL.Path, request.URL.RawQuery, data.Request.Body)
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// render renders the response, or returns the response rendered for
+// the same inputs if it has not expired
+func (c *RenderCache) render(st *RouteState, ret ReturnData, data TemplateData, request *http.Request) ReturnData {
+	key, err := c.key(ret, data, request)
+	if err != nil {
+		return ReturnData{Status: http.StatusInternalServerError, Body: "mox: renderCache: " + err.Error()}
+	}
+	now := time.Now()
+	st.Lock()
+	e, ok := st.rendered[key]
+	st.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.ret
+	}
+	rendered := ret.render(data)
+	ttl, _ := time.ParseDuration(c.TTL)
+	size := c.Size
+	if size == 0 {
+		size = defaultRenderCacheSize
+	}
+	st.Lock()
+	defer st.Unlock()
+	if len(st.rendered) >= size {
+		for k, e := range st.rendered {
+			if !now.Before(e.expires) {
+				delete(st.rendered, k)
+			}
+		}
+	}
+	if st.rendered == nil || len(st.rendered) >= size {
+		st.rendered = make(map[string]renderedEntry)
+	}
+	st.rendered[key] = renderedEntry{ret: rendered, expires: now.Add(ttl)}
+	return rendered
+}
@@ -0,0 +1,258 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repl is an interactive session against the admin port of a running
+// mox instance
+type Repl struct {
+	AdminURL string
+	In       io.Reader
+	Out      io.Writer
+	// Interrupt stops following the journal. Interrupt signals are
+	// used if nil
+	Interrupt <-chan os.Signal
+}
+
+const replHelp = `Commands:
+  stub METHOD PATH -> STATUS [BODY]  Add a one-line stub
+  load FILE                          Add routes from a JSON or YAML file
+  verify                             Run /verify/all
+  metrics                            Show metrics
+  journal [N]                        Show the last N received requests (10)
+                                     and follow new ones until interrupted
+  chaos [on [RATE [STATUS]] | off]   Show or toggle chaos: RATE of the
+                                     responses fail with STATUS (0.1, 503)
+  help                               Show this help
+  quit                               Exit
+`
+
+// Run reads commands until EOF or quit
+func (r Repl) Run() {
+	scanner := bufio.NewScanner(r.In)
+	fmt.Fprintf(r.Out, "mox %s\n> ", r.AdminURL)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "quit" || line == "exit" {
+			return
+		}
+		if len(line) > 0 {
+			r.exec(line)
+		}
+		fmt.Fprint(r.Out, "> ")
+	}
+}
+
+func (r Repl) exec(line string) {
+	cmd := line
+	arg := ""
+	if sp := strings.IndexAny(line, " \t"); sp != -1 {
+		cmd = line[:sp]
+		arg = strings.TrimSpace(line[sp:])
+	}
+	switch cmd {
+	case "help":
+		fmt.Fprint(r.Out, replHelp)
+	case "stub":
+		req, err := ParseStub(arg)
+		if err != nil {
+			fmt.Fprintln(r.Out, err)
+			return
+		}
+		data, _ := json.Marshal(req)
+		r.call(http.MethodPost, "/", data)
+	case "load":
+		data, err := ioutil.ReadFile(arg)
+		if err == nil && isYAML(arg) {
+			data, err = YAMLToJSON(data)
+		}
+		if err != nil {
+			fmt.Fprintln(r.Out, err)
+			return
+		}
+		r.call(http.MethodPost, "/", data)
+	case "verify":
+		r.call(http.MethodGet, "/verify/all", nil)
+	case "metrics":
+		r.call(http.MethodGet, "/metrics", nil)
+	case "journal":
+		n := replJournal
+		if len(arg) > 0 {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil || n <= 0 {
+				fmt.Fprintln(r.Out, "Usage: journal [N]")
+				return
+			}
+		}
+		r.journal(n)
+	case "chaos":
+		r.chaos(arg)
+	default:
+		fmt.Fprintf(r.Out, "Unknown command: %s\n", cmd)
+		fmt.Fprint(r.Out, replHelp)
+	}
+}
+
+// call calls the admin API and prints the response
+func (r Repl) call(method, path string, body []byte) {
+	request, err := http.NewRequest(method, r.AdminURL+path, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(r.Out, err)
+		return
+	}
+	rsp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Fprintln(r.Out, err)
+		return
+	}
+	defer rsp.Body.Close()
+	fmt.Fprintln(r.Out, rsp.Status)
+	data, _ := ioutil.ReadAll(rsp.Body)
+	if len(data) > 0 {
+		fmt.Fprintln(r.Out, strings.TrimSpace(string(data)))
+	}
+}
+
+// replJournal is the number of journal entries shown by default
+const replJournal = 10
+
+// replPoll is how often the journal is checked for new entries
+const replPoll = 250 * time.Millisecond
+
+// journal prints the last n requests of the journal, one per line,
+// then follows new requests until interrupted
+func (r Repl) journal(n int) {
+	interrupt := r.Interrupt
+	if interrupt == nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt)
+		defer signal.Stop(ch)
+		interrupt = ch
+	}
+	entries, err := r.getJournal()
+	if err != nil {
+		fmt.Fprintln(r.Out, err)
+		return
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	var last time.Time
+	ticker := time.NewTicker(replPoll)
+	defer ticker.Stop()
+	for {
+		for _, e := range entries {
+			if e.Time.After(last) {
+				r.printEntry(e)
+				last = e.Time
+			}
+		}
+		select {
+		case <-interrupt:
+			fmt.Fprintln(r.Out)
+			return
+		case <-ticker.C:
+		}
+		if entries, err = r.getJournal(); err != nil {
+			fmt.Fprintln(r.Out, err)
+			return
+		}
+	}
+}
+
+// getJournal returns the journal entries
+func (r Repl) getJournal() ([]JournalEntry, error) {
+	rsp, err := http.Get(r.AdminURL + "/journal")
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, errors.New(rsp.Status)
+	}
+	var entries []JournalEntry
+	err = json.NewDecoder(rsp.Body).Decode(&entries)
+	return entries, err
+}
+
+func (r Repl) printEntry(e JournalEntry) {
+	target := e.Path
+	if len(e.Query) > 0 {
+		target += "?" + e.Query
+	}
+	line := fmt.Sprintf("%s %s %s -> %s", e.Time.Format("15:04:05.000"), e.Method, target, e.Route)
+	if len(e.Test) > 0 {
+		line += " [" + e.Test + "]"
+	}
+	fmt.Fprintln(r.Out, line)
+}
+
+// chaos shows the chaos settings, or turns chaos on or off
+func (r Repl) chaos(arg string) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		r.call(http.MethodGet, "/chaos", nil)
+		return
+	}
+	usage := "Usage: chaos [on [RATE [STATUS]] | off]"
+	switch {
+	case fields[0] == "off" && len(fields) == 1:
+		r.call(http.MethodDelete, "/chaos", nil)
+	case fields[0] == "on" && len(fields) <= 3:
+		settings := ChaosSettings{Enabled: true, ErrorRate: 0.1}
+		var err error
+		if len(fields) > 1 {
+			if settings.ErrorRate, err = strconv.ParseFloat(fields[1], 64); err != nil {
+				fmt.Fprintln(r.Out, usage)
+				return
+			}
+		}
+		if len(fields) > 2 {
+			if settings.Status, err = strconv.Atoi(fields[2]); err != nil {
+				fmt.Fprintln(r.Out, usage)
+				return
+			}
+		}
+		data, _ := json.Marshal(settings)
+		r.call(http.MethodPut, "/chaos", data)
+	default:
+		fmt.Fprintln(r.Out, usage)
+	}
+}
+
+// runRepl runs the repl command. The optional argument is the admin
+// URL of the mox instance, by default the admin address of -adm
+func runRepl(args []string) {
+	url := adminURL(*adminPort)
+	if len(args) > 0 {
+		url = strings.TrimSuffix(args[0], "/")
+	}
+	Repl{AdminURL: url, In: os.Stdin, Out: os.Stdout}.Run()
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplJournal(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{Method: "GET", Path: "/a", Return: ReturnData{Status: http.StatusOK}})
+	a.M.Journal.Size = 10
+	for _, target := range []string{"/a", "/b?x=1", "/a"} {
+		serve(a, "GET", target, "")
+	}
+	server := httptest.NewServer(a)
+	defer server.Close()
+
+	var out bytes.Buffer
+	interrupt := make(chan os.Signal)
+	repl := Repl{AdminURL: server.URL, Out: &out, Interrupt: interrupt}
+	done := make(chan bool)
+	go func() {
+		repl.exec("journal 2")
+		close(done)
+	}()
+	time.Sleep(replPoll / 2)
+	serve(a, "GET", "/c", "")
+	time.Sleep(2 * replPoll)
+	interrupt <- os.Interrupt
+	<-done
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "GET /b?x=1 -> unmatched") || !strings.HasSuffix(lines[1], "GET /a -> GET /a") ||
+		!strings.HasSuffix(lines[2], "GET /c -> unmatched") {
+		t.Errorf("got %q", out.String())
+	}
+	out.Reset()
+	repl.exec("journal x")
+	if !strings.HasPrefix(out.String(), "Usage") {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestReplChaos(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{Method: "GET", Path: "/a", Return: ReturnData{Status: http.StatusOK}})
+	server := httptest.NewServer(a)
+	defer server.Close()
+	var out bytes.Buffer
+	repl := Repl{AdminURL: server.URL, Out: &out}
+
+	repl.exec("chaos on 1 502")
+	if s := a.M.Chaos.Get(); !s.Enabled || s.ErrorRate != 1 || s.Status != http.StatusBadGateway {
+		t.Fatalf("got %+v: %s", s, out.String())
+	}
+	if rec := serve(a, "GET", "/a", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("got %d with chaos on", rec.Code)
+	}
+	if n := a.M.Stats.route("GET /a").Faults[faultError]; n != 1 {
+		t.Errorf("got %d error faults", n)
+	}
+	repl.exec("chaos off")
+	if a.M.Chaos.Get().Enabled {
+		t.Errorf("chaos is still on")
+	}
+	if rec := serve(a, "GET", "/a", ""); rec.Code != http.StatusOK {
+		t.Errorf("got %d with chaos off", rec.Code)
+	}
+	for _, cmd := range []string{"chaos on x", "chaos off 1", "chaos maybe"} {
+		out.Reset()
+		repl.exec(cmd)
+		if !strings.HasPrefix(out.String(), "Usage") {
+			t.Errorf("%s: got %q", cmd, out.String())
+		}
+	}
+	out.Reset()
+	repl.exec("chaos on 2")
+	if !strings.Contains(out.String(), "errorRate") || a.M.Chaos.Get().Enabled {
+		t.Errorf("invalid rate accepted: %q", out.String())
+	}
+}
+
+func TestChaosDelay(t *testing.T) {
+	c := Chaos{}
+	c.Set(ChaosSettings{Enabled: true, Delay: "100ms"})
+	ret, failed := c.inject(ReturnData{Status: http.StatusOK, Delay: "50ms"})
+	if failed || ret.Delay != "150ms" || ret.Status != http.StatusOK {
+		t.Errorf("got %+v %v", ret, failed)
+	}
+	if err := c.Set(ChaosSettings{Delay: "soon"}); err == nil {
+		t.Errorf("expected an error for an invalid delay")
+	}
+}
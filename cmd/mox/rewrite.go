@@ -0,0 +1,111 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// Rewrite describes how a rewrite route changes the request before
+	// dispatching it again
+	Rewrite struct {
+		// Path is the new path. {name} is replaced with the path
+		// variable name of the matched route
+		Path string `json:"path,omitempty"`
+		// Headers are set on the request
+		Headers Pairs `json:"headers,omitempty"`
+		// Queries are set on the request
+		Queries Pairs `json:"queries,omitempty"`
+	}
+
+	// RewriteHandler rewrites the request and dispatches it through the
+	// router again
+	RewriteHandler struct {
+		R RouteRequest
+		m *MockHandler
+	}
+
+	rewriteKey struct{}
+)
+
+// ActionRewrite is the route action to rewrite and redispatch
+const ActionRewrite = "rewrite"
+
+// maxRewrites limits the number of times a request can be rewritten
+const maxRewrites = 10
+
+// expandVars replaces {name} in s with path variables
+func expandVars(s string, vars map[string]string) string {
+	for k, v := range vars {
+		s = strings.Replace(s, "{"+k+"}", v, -1)
+	}
+	return s
+}
+
+func (h RewriteHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.m.Stats.Record(h.R.Name(), 0)
+	n, _ := request.Context().Value(rewriteKey{}).(int)
+	if n >= maxRewrites {
+		http.Error(writer, "mox: too many rewrites for "+request.URL.Path, http.StatusLoopDetected)
+		return
+	}
+	rw := h.R.Rewrite
+	vars := mux.Vars(request)
+	u := *request.URL
+	if len(rw.Path) > 0 {
+		u.Path = expandVars(rw.Path, vars)
+		u.RawPath = ""
+	}
+	if len(rw.Queries) > 0 {
+		q := u.Query()
+		for _, x := range rw.Queries {
+			q.Set(x.Key, expandVars(x.Value, vars))
+		}
+		u.RawQuery = q.Encode()
+	}
+	// The rewritten request is matched by all routes again, even if
+	// it went through pass routes
+	ctx := context.WithValue(request.Context(), passKey{}, -1)
+	out := request.WithContext(context.WithValue(ctx, rewriteKey{}, n+1))
+	out.URL = &u
+	out.RequestURI = u.RequestURI()
+	out.Header = make(http.Header, len(request.Header))
+	for k, v := range request.Header {
+		out.Header[k] = v
+	}
+	for _, x := range rw.Headers.CanonicalHeaders() {
+		out.Header.Set(x.Key, expandVars(x.Value, vars))
+	}
+	h.m.Router.ServeHTTP(writer, out)
+}
+
+// validRewrite returns true if the rewritten path is valid
+func validRewrite(rw *Rewrite) bool {
+	if rw == nil {
+		return false
+	}
+	if len(rw.Path) > 0 {
+		if _, err := url.Parse(rw.Path); err != nil || !strings.HasPrefix(rw.Path, "/") {
+			return false
+		}
+	}
+	return true
+}
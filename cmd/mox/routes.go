@@ -0,0 +1,213 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// routesPrefix is the admin path of individual routes, followed by
+// the route id
+const routesPrefix = "/routes/"
+
+// GetRoutes returns a copy of the routes, in matching order
+func (h *AdminHandler) GetRoutes() []RouteRequest {
+	h.M.RLock()
+	defer h.M.RUnlock()
+	ret := make([]RouteRequest, len(h.Routes))
+	for i, r := range h.Routes {
+		ret[i] = *r
+	}
+	return ret
+}
+
+// newRouteID returns an id for a route without one. The id depends
+// only on the route, so loading the same stubs again gives the same ids
+func newRouteID(req RouteRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// uniqueRouteID returns the id, with a numbered suffix if a route has
+// it already. An edited route keeps its id, so posting the original
+// route again gives the same content id
+func (h *AdminHandler) uniqueRouteID(id string) string {
+	ret := id
+	for n := 2; h.findRoute(ret) >= 0; n++ {
+		ret = id + "-" + strconv.Itoa(n)
+	}
+	return ret
+}
+
+// findRoute returns the index of the route with the id, or -1
+func (h *AdminHandler) findRoute(id string) int {
+	for i, r := range h.Routes {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// PatchRoute applies a JSON Patch to the route with the id. If the
+// patched route is invalid, the route is not changed
+func (h *AdminHandler) PatchRoute(id string, patch []byte) (RouteRequest, error) {
+	h.M.Lock()
+	defer h.M.Unlock()
+	i := h.findRoute(id)
+	if i < 0 {
+		return RouteRequest{}, errRouteNotFound
+	}
+	doc, _ := json.Marshal(h.Routes[i])
+	doc, err := ApplyPatch(doc, patch)
+	if err != nil {
+		return RouteRequest{}, err
+	}
+	var req RouteRequest
+	if err := json.Unmarshal(doc, &req); err != nil {
+		return RouteRequest{}, err
+	}
+	if req.ID != id {
+		return RouteRequest{}, errors.New("route id cannot be changed")
+	}
+	return req, h.replaceRoute(i, req)
+}
+
+// PutRoute replaces the route with the id. The new route keeps its
+// place in the matching order. If it is invalid, the route is not
+// changed
+func (h *AdminHandler) PutRoute(id string, data []byte) (RouteRequest, error) {
+	var req RouteRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return RouteRequest{}, err
+	}
+	if len(req.ID) == 0 {
+		req.ID = id
+	}
+	if req.ID != id {
+		return RouteRequest{}, errors.New("route id cannot be changed")
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	i := h.findRoute(id)
+	if i < 0 {
+		return RouteRequest{}, errRouteNotFound
+	}
+	return req, h.replaceRoute(i, req)
+}
+
+// replaceRoute validates the route and puts it at index i, and
+// rebuilds the router. The route keeps the source of the route it
+// replaces. The caller must hold the lock on the mock handler
+func (h *AdminHandler) replaceRoute(i int, req RouteRequest) error {
+	req.source = h.Routes[i].source
+	if _, err := req.BuildRoute(nil); err != nil {
+		return err
+	}
+	if err := h.M.validateRoute(req); err != nil {
+		return err
+	}
+	routes := make([]*RouteRequest, len(h.Routes))
+	copy(routes, h.Routes)
+	routes[i] = &req
+	h.Routes = routes
+	h.routesChanged()
+	return nil
+}
+
+// DeleteRoute removes the route with the id, and rebuilds the router
+func (h *AdminHandler) DeleteRoute(id string) error {
+	h.M.Lock()
+	defer h.M.Unlock()
+	i := h.findRoute(id)
+	if i < 0 {
+		return errRouteNotFound
+	}
+	routes := make([]*RouteRequest, 0, len(h.Routes)-1)
+	routes = append(routes, h.Routes[:i]...)
+	h.Routes = append(routes, h.Routes[i+1:]...)
+	h.routesChanged()
+	return nil
+}
+
+var errRouteNotFound = errors.New("route not found")
+
+func (h *AdminHandler) serveRoutes(writer http.ResponseWriter) {
+	ret, _ := json.Marshal(h.GetRoutes())
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+func (h *AdminHandler) serveRoute(writer http.ResponseWriter, request *http.Request) {
+	id := strings.TrimPrefix(request.URL.Path, routesPrefix)
+	if request.Method == http.MethodGet {
+		h.M.RLock()
+		i := h.findRoute(id)
+		var ret []byte
+		if i >= 0 {
+			ret, _ = json.Marshal(h.Routes[i])
+		}
+		h.M.RUnlock()
+		if i < 0 {
+			http.Error(writer, errRouteNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(ret)
+		return
+	}
+	if request.Method == http.MethodDelete {
+		if err := h.DeleteRoute(id); err != nil {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if request.Method != http.MethodPatch && request.Method != http.MethodPut {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	var req RouteRequest
+	if request.Method == http.MethodPut {
+		req, err = h.PutRoute(id, data)
+	} else {
+		req, err = h.PatchRoute(id, data)
+	}
+	if err == errRouteNotFound {
+		http.Error(writer, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	ret, _ := json.Marshal(req)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEditKeepsSource(t *testing.T) {
+	a := newTestAdmin(t)
+	a.M.Lock()
+	err := a.addRoutes(withSource([]RouteRequest{{ID: "r", Method: "GET", Path: "/x", Return: ReturnData{Status: 200}}}, "stubs.json"))
+	a.M.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.PatchRoute("r", []byte(`[{"op": "replace", "path": "/return/status", "value": 500}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if s := a.Routes[0].source; s != "stubs.json" {
+		t.Errorf("patch: source is %q", s)
+	}
+	if _, err := a.PutRoute("r", []byte(`{"method": "GET", "path": "/y", "return": {"status": 201}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if s := a.Routes[0].source; s != "stubs.json" {
+		t.Errorf("put: source is %q", s)
+	}
+	if rec := serve(a, "GET", "/y", ""); rec.Code != http.StatusCreated {
+		t.Errorf("got %d", rec.Code)
+	}
+	a.M.RLock()
+	n := len(a.APIRoutes())
+	a.M.RUnlock()
+	if n != 0 {
+		t.Errorf("edited stub file route is persisted")
+	}
+}
+
+func TestPatchRouteErrors(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{ID: "r", Method: "GET", Path: "/x"})
+	tests := []struct {
+		id, patch string
+	}{
+		{"missing", `[]`},
+		{"r", `[{"op": "replace", "path": "/id", "value": "other"}]`},
+		{"r", `[{"op": "test", "path": "/path", "value": "/other"}]`},
+		{"r", `[{"op": "replace", "path": "/body", "value": {"regex": "("}}]`},
+		{"r", `{`},
+	}
+	for _, x := range tests {
+		if _, err := a.PatchRoute(x.id, []byte(x.patch)); err == nil {
+			t.Errorf("%s %s: expected an error", x.id, x.patch)
+		}
+	}
+	if a.Routes[0].Path != "/x" {
+		t.Errorf("failed patch changed the route: %+v", a.Routes[0])
+	}
+}
+
+func TestRepostEditedRoute(t *testing.T) {
+	a := newTestAdmin(t)
+	post := func() string {
+		reqs := []RouteRequest{{Method: "GET", Path: "/a", Return: ReturnData{Status: 200}}}
+		a.M.Lock()
+		defer a.M.Unlock()
+		if err := a.addRoutes(reqs); err != nil {
+			t.Fatal(err)
+		}
+		return reqs[0].ID
+	}
+	id := post()
+	if _, err := a.PutRoute(id, []byte(`{"method": "GET", "path": "/b", "return": {"status": 200}}`)); err != nil {
+		t.Fatal(err)
+	}
+	id2 := post()
+	if id2 == id || id2 != id+"-2" {
+		t.Errorf("got ids %s and %s", id, id2)
+	}
+	if post() != id2 {
+		t.Errorf("posting the route again added it")
+	}
+	if err := a.DeleteRoute(id2); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Routes) != 1 || a.Routes[0].Path != "/b" {
+		t.Errorf("deleted the wrong route: %+v", a.Routes)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+type (
+	// TemplateRequest is a request as seen by response templates
+	TemplateRequest struct {
+		Method  string
+		Path    string
+		Query   map[string]string
+		Headers map[string]string
+		Body    string
+		// JSON is the parsed body, nil if it is not JSON
+		JSON interface{}
+	}
+
+	// Exchange is a request to a route and the response it got
+	Exchange struct {
+		Route    string
+		Request  TemplateRequest
+		Response ReturnData
+	}
+
+	// TemplateData is available to response templates. Previous
+	// and Exchanges are from the scenario of the route
+	TemplateData struct {
+		Request TemplateRequest
+		// PathVar are the variables of the route path, like id in
+		// /users/{id}
+		PathVar map[string]string
+		// Previous is the last exchange in the scenario, nil if
+		// there is none
+		Previous *Exchange
+		// Exchanges are the last exchanges of the routes in the
+		// scenario, by route id
+		Exchanges map[string]*Exchange
+		// Vars are the captured variables
+		Vars map[string]string
+	}
+
+	// scenarioState is the history of a scenario
+	scenarioState struct {
+		last    *Exchange
+		byRoute map[string]*Exchange
+	}
+
+	// Scenarios keeps the exchanges of routes in the same scenario,
+	// so later responses can refer to earlier requests, and the
+	// current state of each scenario
+	Scenarios struct {
+		sync.Mutex
+		states  map[string]*scenarioState
+		current map[string]string
+	}
+)
+
+// scenarioStarted is the state of a scenario before any transition
+const scenarioStarted = "Started"
+
+// newTemplateRequest returns the template view of the request
+func newTemplateRequest(request *http.Request) TemplateRequest {
+	ret := TemplateRequest{Method: request.Method,
+		Path:    request.URL.Path,
+		Query:   make(map[string]string),
+		Headers: make(map[string]string),
+		Body:    string(captureBody(request))}
+	for k := range request.URL.Query() {
+		ret.Query[k] = request.URL.Query().Get(k)
+	}
+	for k := range request.Header {
+		ret.Headers[k] = request.Header.Get(k)
+	}
+	if json.Unmarshal([]byte(ret.Body), &ret.JSON) != nil {
+		ret.JSON = nil
+	}
+	return ret
+}
+
+// Data returns the template data of a request to a route in the
+// scenario. If scenario is empty, there are no earlier exchanges
+func (s *Scenarios) Data(scenario string, request TemplateRequest) TemplateData {
+	data := TemplateData{Request: request, Exchanges: make(map[string]*Exchange)}
+	if len(scenario) == 0 {
+		return data
+	}
+	s.Lock()
+	defer s.Unlock()
+	if st, ok := s.states[scenario]; ok {
+		data.Previous = st.last
+		for k, v := range st.byRoute {
+			data.Exchanges[k] = v
+		}
+	}
+	return data
+}
+
+// Record records an exchange in the scenario
+func (s *Scenarios) Record(scenario string, x *Exchange) {
+	s.Lock()
+	defer s.Unlock()
+	if s.states == nil {
+		s.states = make(map[string]*scenarioState)
+	}
+	st, ok := s.states[scenario]
+	if !ok {
+		st = &scenarioState{byRoute: make(map[string]*Exchange)}
+		s.states[scenario] = st
+	}
+	st.last = x
+	st.byRoute[x.Route] = x
+}
+
+// State returns the current state of the scenario
+func (s *Scenarios) State(scenario string) string {
+	s.Lock()
+	defer s.Unlock()
+	if st, ok := s.current[scenario]; ok {
+		return st
+	}
+	return scenarioStarted
+}
+
+// SetState moves the scenario to a new state
+func (s *Scenarios) SetState(scenario, state string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.current == nil {
+		s.current = make(map[string]string)
+	}
+	s.current[scenario] = state
+}
+
+// SetStates moves the scenarios to new states, given by scenario name
+func (s *Scenarios) SetStates(states map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.current == nil {
+		s.current = make(map[string]string)
+	}
+	for k, v := range states {
+		s.current[k] = v
+	}
+}
+
+// States returns the current states of the scenarios that left the
+// started state
+func (s *Scenarios) States() map[string]string {
+	s.Lock()
+	defer s.Unlock()
+	ret := make(map[string]string, len(s.current))
+	for k, v := range s.current {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Reset clears all scenarios, and moves them to the started state
+func (s *Scenarios) Reset() {
+	s.Lock()
+	s.states = nil
+	s.current = nil
+	s.Unlock()
+}
+
+// serveScenarios returns the scenario states with GET, and sets them
+// from a JSON object of scenario names to states with PUT
+func (h *AdminHandler) serveScenarios(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var states map[string]string
+		if err := json.NewDecoder(request.Body).Decode(&states); err != nil {
+			writeError(writer, err)
+			return
+		}
+		h.M.Scenarios.SetStates(states)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ret, _ := json.Marshal(h.M.Scenarios.States())
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+// render executes the body and header value templates of the
+// response with the data
+func (ret ReturnData) render(data TemplateData) ReturnData {
+	if !ret.Template {
+		return ret
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	expand := func(s string) (string, error) {
+		tmpl, err := parseTemplate(s)
+		if err != nil {
+			return "", err
+		}
+		buf.Reset()
+		if err := tmpl.Execute(buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	headers := make(Pairs, len(ret.Headers))
+	for i, h := range ret.Headers {
+		v, err := expand(h.Value)
+		if err != nil {
+			return ReturnData{Status: http.StatusInternalServerError, Body: "mox: " + err.Error()}
+		}
+		headers[i] = Pair{Key: h.Key, Value: v}
+	}
+	body, err := expand(ret.Body)
+	if err != nil {
+		return ReturnData{Status: http.StatusInternalServerError, Body: "mox: " + err.Error()}
+	}
+	ret.Headers, ret.Body = headers, body
+	return ret
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Window is a daily time window with its own response, such as a
+// maintenance window
+type Window struct {
+	// From and To are times of day as HH:MM or HH:MM:SS. If To is
+	// before From, the window spans midnight
+	From string `json:"from"`
+	To   string `json:"to"`
+	// TZ is the time zone of From and To, UTC by default
+	TZ     string     `json:"tz,omitempty"`
+	Return ReturnData `json:"return"`
+}
+
+// parseTimeOfDay returns the offset of HH:MM[:SS] from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04:05", s)
+	if err != nil {
+		if t, err = time.Parse("15:04", s); err != nil {
+			return 0, errors.New("invalid time of day: " + s)
+		}
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+}
+
+// Validate checks the window definition
+func (w Window) Validate() error {
+	if _, err := parseTimeOfDay(w.From); err != nil {
+		return err
+	}
+	if _, err := parseTimeOfDay(w.To); err != nil {
+		return err
+	}
+	if len(w.TZ) > 0 {
+		if _, err := time.LoadLocation(w.TZ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Contains returns true if the time is in the window
+func (w Window) Contains(t time.Time) bool {
+	from, err1 := parseTimeOfDay(w.From)
+	to, err2 := parseTimeOfDay(w.To)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	if len(w.TZ) > 0 {
+		if loc, err := time.LoadLocation(w.TZ); err == nil {
+			t = t.In(loc)
+		}
+	} else {
+		t = t.UTC()
+	}
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if from <= to {
+		return tod >= from && tod < to
+	}
+	return tod >= from || tod < to
+}
+
+// scheduled returns the response of the first window containing the
+// time
+func scheduled(schedule []Window, t time.Time) (ReturnData, bool) {
+	for _, w := range schedule {
+		if w.Contains(t) {
+			return w.Return, true
+		}
+	}
+	return ReturnData{}, false
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "errors"
+
+// Sequence modes, what happens after the last response of a sequence
+const (
+	sequenceRepeatLast = "repeatLast"
+	sequenceCycle      = "cycle"
+)
+
+// validateSequence checks the sequence of a route
+func (r RouteRequest) validateSequence() error {
+	switch r.SequenceMode {
+	case "", sequenceRepeatLast, sequenceCycle:
+	default:
+		return errors.New("unknown sequence mode: " + r.SequenceMode)
+	}
+	if len(r.Sequence) > 0 && len(r.Variants) > 0 {
+		return errors.New("a route cannot have both a sequence and variants")
+	}
+	return nil
+}
+
+// next returns the response of the next call in the sequence, counting
+// calls in the route state
+func (r RouteRequest) next(st *RouteState) ReturnData {
+	st.Lock()
+	n := st.calls
+	st.calls++
+	st.Unlock()
+	if n >= len(r.Sequence) {
+		if r.SequenceMode == sequenceCycle {
+			n %= len(r.Sequence)
+		} else {
+			n = len(r.Sequence) - 1
+		}
+	}
+	return r.Sequence[n]
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// Clock is the virtual clock of the mock. Unless it is set, it
+	// returns the real time. Once set, it keeps ticking from the set
+	// time.
+	Clock struct {
+		sync.Mutex
+		base  time.Time
+		setAt time.Time
+	}
+
+	// SetupBundle sets up the mock for a test in a single call. If
+	// Reset is true, all routes and recorded requests are cleared
+	// before loading the routes, so posting the same bundle again
+	// yields the same state
+	SetupBundle struct {
+		Reset  bool           `json:"reset"`
+		Routes []RouteRequest `json:"routes"`
+		Groups []RouteGroup   `json:"groups,omitempty"`
+		Clock  *time.Time     `json:"clock,omitempty"`
+		// Fallbacks replace the responses to unmatched requests
+		Fallbacks *Fallbacks `json:"fallbacks,omitempty"`
+		// Scenarios are the states of scenarios by name
+		Scenarios map[string]string `json:"scenarios,omitempty"`
+	}
+)
+
+// Now returns the current virtual time
+func (c *Clock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	if c.setAt.IsZero() {
+		return time.Now()
+	}
+	return c.base.Add(time.Since(c.setAt))
+}
+
+// Set sets the virtual time
+func (c *Clock) Set(t time.Time) {
+	c.Lock()
+	c.base = t
+	c.setAt = time.Now()
+	c.Unlock()
+}
+
+// Reset sets the clock back to real time
+func (c *Clock) Reset() {
+	c.Lock()
+	c.base = time.Time{}
+	c.setAt = time.Time{}
+	c.Unlock()
+}
+
+// Setup applies a setup bundle. If the bundle cannot be applied, the
+// mock is left as it was
+func (h *AdminHandler) Setup(bundle SetupBundle) error {
+	if bundle.Fallbacks != nil {
+		if err := bundle.Fallbacks.Validate(); err != nil {
+			return err
+		}
+	}
+	h.M.Lock()
+	defer h.M.Unlock()
+	old := h.Routes
+	if bundle.Reset {
+		h.Routes = make([]*RouteRequest, 0)
+	}
+	routes := bundle.Routes
+	for _, g := range bundle.Groups {
+		routes = append(routes, g.Expand()...)
+	}
+	if err := h.addRoutes(routes); err != nil {
+		h.Routes = old
+		return err
+	}
+	if bundle.Reset {
+		h.M.Unmatched.Reset()
+		h.M.Received.Reset()
+		h.M.Journal.Reset()
+		h.M.Stats.Reset()
+		h.M.States.Reset()
+		h.M.Scenarios.Reset()
+		h.M.Vars.Reset()
+		h.M.Tokens.Reset()
+		h.M.Chaos.Set(ChaosSettings{})
+		h.M.Clock.Reset()
+		h.M.Run.Reset()
+		h.M.Egress.Reset()
+		h.M.Cassettes.Reset()
+		h.M.Violations.Reset()
+		h.M.Fallbacks = h.M.DefaultFallbacks
+	}
+	if bundle.Fallbacks != nil {
+		h.M.Fallbacks = bundle.Fallbacks
+	}
+	if bundle.Clock != nil {
+		h.M.Clock.Set(*bundle.Clock)
+	}
+	h.M.Scenarios.SetStates(bundle.Scenarios)
+	return nil
+}
+
+// Reset clears all routes, recorded requests, route states,
+// scenarios, variables, issued tokens, chaos and the virtual clock,
+// like a setup bundle with only reset
+func (h *AdminHandler) Reset() {
+	h.Setup(SetupBundle{Reset: true})
+}
+
+func (h *AdminHandler) serveReset(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost && request.Method != http.MethodDelete {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	h.Reset()
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) serveSetup(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var bundle SetupBundle
+	data, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(data, &bundle)
+	}
+	if err == nil {
+		err = h.Setup(bundle)
+	}
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetupScenarios(t *testing.T) {
+	a := newTestAdmin(t)
+	a.M.Scenarios.SetState("other", "Kept")
+	err := a.Setup(SetupBundle{
+		Reset: true,
+		Routes: []RouteRequest{
+			{Method: "GET", Path: "/cart", Scenario: "checkout", RequiredState: "CartFull", Return: ReturnData{Status: http.StatusOK, Body: "full"}},
+			{Method: "GET", Path: "/cart", Return: ReturnData{Status: http.StatusOK, Body: "empty"}},
+		},
+		Scenarios: map[string]string{"checkout": "CartFull"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(a, "GET", "/cart", "").Body.String(); got != "full" {
+		t.Errorf("got %q, expected the route of the seeded state", got)
+	}
+	states := a.M.Scenarios.States()
+	if len(states) != 1 || states["checkout"] != "CartFull" {
+		t.Errorf("states: %v", states)
+	}
+
+	// An invalid bundle changes nothing
+	err = a.Setup(SetupBundle{
+		Reset:     true,
+		Routes:    []RouteRequest{{Path: "/bad", Body: &BodyMatch{Regex: "("}}},
+		Scenarios: map[string]string{"checkout": "Empty"},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if s := a.M.Scenarios.States()["checkout"]; s != "CartFull" {
+		t.Errorf("state changed to %s by an invalid bundle", s)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// SNIListener selects the certificate of a TLS connection by the SNI
+// name. Names with an invalid TLS behavior get the invalid
+// certificate, names with a configured certificate get that, and other
+// names get the default certificate, or one issued by the mox CA
+type SNIListener struct {
+	CA        *CertAuthority
+	Behaviors BadTLSFlags
+	Certs     SNICerts
+	// Default is the certificate of names without one, nil to issue
+	// certificates from the CA
+	Default *tls.Certificate
+	// ClientAuth and ClientCAs configure client certificates
+	ClientAuth tls.ClientAuthType
+	ClientCAs  *x509.CertPool
+	// ALPN lists the application protocols offered in preference
+	// order, such as h2 and http/1.1
+	ALPN []string
+}
+
+// SNICerts maps SNI names to certificates
+type SNICerts map[string]*tls.Certificate
+
+func (c *SNICerts) String() string {
+	var s []string
+	for k := range *c {
+		s = append(s, k)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set loads a certificate given as name=certFile,keyFile
+func (c *SNICerts) Set(value string) error {
+	eq := strings.Index(value, "=")
+	files := strings.Split(value[eq+1:], ",")
+	if eq <= 0 || len(files) != 2 {
+		return errors.New("expecting name=certFile,keyFile, got " + value)
+	}
+	cert, err := tls.LoadX509KeyPair(files[0], files[1])
+	if err != nil {
+		return err
+	}
+	if *c == nil {
+		*c = make(SNICerts)
+	}
+	(*c)[strings.ToLower(value[:eq])] = &cert
+	return nil
+}
+
+// Config returns the TLS configuration of the listener
+func (l *SNIListener) Config() *tls.Config {
+	return &tls.Config{GetConfigForClient: l.configFor, NextProtos: l.ALPN}
+}
+
+func (l *SNIListener) configFor(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	config, err := l.serverConfig(hello)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientAuth, config.ClientCAs = l.ClientAuth, l.ClientCAs
+	return config, nil
+}
+
+// serverConfig returns the configuration with the server certificate
+// for the SNI name
+func (l *SNIListener) serverConfig(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	name := strings.ToLower(hello.ServerName)
+	if len(name) == 0 {
+		name = "localhost"
+	}
+	behavior, bad := l.Behaviors[name]
+	if cert, ok := l.Certs[name]; ok && !bad {
+		return &tls.Config{Certificates: []tls.Certificate{*cert}, NextProtos: l.ALPN}, nil
+	}
+	if l.Default != nil && !bad {
+		return &tls.Config{Certificates: []tls.Certificate{*l.Default}, NextProtos: l.ALPN}, nil
+	}
+	opt, config := badTLSConfig(behavior, name)
+	cert, err := l.CA.Issue(behavior+"/"+name, opt)
+	if err != nil {
+		return nil, err
+	}
+	config.Certificates = []tls.Certificate{*cert}
+	if config.MaxVersion == 0 || config.MaxVersion >= tls.VersionTLS12 {
+		config.NextProtos = l.ALPN
+	} else {
+		// HTTP/2 requires TLS 1.2
+		config.NextProtos = withoutH2(l.ALPN)
+	}
+	return config, nil
+}
+
+// ParseALPN parses a comma separated list of application protocols
+func ParseALPN(s string) []string {
+	var ret []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+func withoutH2(protos []string) []string {
+	var ret []string
+	for _, p := range protos {
+		if p != "h2" {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// sniMatcher matches requests received over TLS for the SNI name
+func sniMatcher(name string) func(*http.Request) bool {
+	return func(request *http.Request) bool {
+		return request.TLS != nil && strings.EqualFold(request.TLS.ServerName, name)
+	}
+}
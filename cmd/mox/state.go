@@ -0,0 +1,69 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+)
+
+// RouteState keeps state of a route that survives rebuilding the
+// router when routes change
+type RouteState struct {
+	sync.Mutex
+	idempotent map[string]idempotentEntry
+	logins     map[string]*loginAccount
+	bucket     *tokenBucket
+	calls      int
+	breaker    breakerState
+	rendered   map[string]renderedEntry
+}
+
+// States keeps route states by route key
+type States struct {
+	sync.Mutex
+	states map[string]*RouteState
+}
+
+// Key returns the key identifying the route state. Routes get a
+// unique id when they are added, routes without one are identified by
+// all their fields
+func (r RouteRequest) Key() string {
+	if len(r.ID) > 0 {
+		return r.ID
+	}
+	return newRouteID(r)
+}
+
+// Get returns the state of a route, creating it if necessary
+func (s *States) Get(key string) *RouteState {
+	s.Lock()
+	defer s.Unlock()
+	if s.states == nil {
+		s.states = make(map[string]*RouteState)
+	}
+	st, ok := s.states[key]
+	if !ok {
+		st = &RouteState{}
+		s.states[key] = st
+	}
+	return st
+}
+
+// Reset clears all route states
+func (s *States) Reset() {
+	s.Lock()
+	s.states = nil
+	s.Unlock()
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRouteStatesAreSeparate(t *testing.T) {
+	a1, b1 := "a", "b"
+	a := newTestAdmin(t,
+		RouteRequest{Method: "POST", Path: "/x", Body: &BodyMatch{Equals: &a1},
+			Sequence: []ReturnData{{Status: 200, Body: "a1"}, {Status: 200, Body: "a2"}}},
+		RouteRequest{Method: "POST", Path: "/x", Body: &BodyMatch{Equals: &b1},
+			Sequence: []ReturnData{{Status: 200, Body: "b1"}, {Status: 200, Body: "b2"}}},
+	)
+	tests := []struct{ body, want string }{
+		{"a", "a1"},
+		{"b", "b1"},
+		{"a", "a2"},
+		{"b", "b2"},
+	}
+	for _, x := range tests {
+		if got := serve(a, "POST", "/x", x.body).Body.String(); got != x.want {
+			t.Errorf("body %s: got %q, expected %q", x.body, got, x.want)
+		}
+	}
+}
+
+func TestRouteKey(t *testing.T) {
+	a1, b1 := "a", "b"
+	r1 := RouteRequest{Method: "POST", Path: "/x", Body: &BodyMatch{Equals: &a1}}
+	r2 := RouteRequest{Method: "POST", Path: "/x", Body: &BodyMatch{Equals: &b1}}
+	if r1.Key() == r2.Key() {
+		t.Errorf("routes with different bodies have the same key")
+	}
+	if r1.Key() != r1.Key() {
+		t.Errorf("key is not stable")
+	}
+	r1.ID, r2.ID = "one", "two"
+	if r1.Key() != "one" || r2.Key() != "two" {
+		t.Errorf("got %s %s, expected the route ids", r1.Key(), r2.Key())
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// StaticDir serves a directory tree under the route path prefix
+	StaticDir struct {
+		// Dir is the directory to serve
+		Dir string `json:"dir"`
+		// Index is the file served for directories, index.html by default
+		Index string `json:"index,omitempty"`
+		// Listing enables directory listings for directories without
+		// an index file
+		Listing bool `json:"listing,omitempty"`
+		// Fallback serves the index file of the root directory for
+		// paths that do not exist, for single-page apps using the
+		// history API
+		Fallback bool `json:"fallback,omitempty"`
+	}
+
+	// StaticHandler serves files from a static directory
+	StaticHandler struct {
+		R RouteRequest
+		m *MockHandler
+	}
+)
+
+// Validate checks if the directory exists
+func (s *StaticDir) Validate() error {
+	info, err := os.Stat(s.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("staticDir: not a directory: " + s.Dir)
+	}
+	return nil
+}
+
+// staticPath adds a route for the paths under the prefix to the
+// router. The prefix matches whole path segments, so /app matches /app
+// and /app/x, but not /apple
+func staticPath(router *mux.Router, prefix string) *mux.Route {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(prefix) == 0 {
+		return router.PathPrefix("/")
+	}
+	return router.Path(prefix + "{staticPath:(?:/.*)?}")
+}
+
+func (s *StaticDir) index() string {
+	if len(s.Index) > 0 {
+		return s.Index
+	}
+	return "index.html"
+}
+
+func (h StaticHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.m.Stats.Record(h.R.Name(), 0)
+	static := h.R.StaticDir
+	rel := path.Clean("/" + strings.TrimPrefix(request.URL.Path, strings.TrimSuffix(h.R.Path, "/")))
+	name := filepath.Join(static.Dir, filepath.FromSlash(rel))
+	info, err := os.Stat(name)
+	if err != nil && static.Fallback {
+		name = filepath.Join(static.Dir, static.index())
+		info, err = os.Stat(name)
+	}
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(request.URL.Path, "/") {
+			http.Redirect(writer, request, request.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		index := filepath.Join(name, static.index())
+		if info, err = os.Stat(index); err == nil && !info.IsDir() {
+			name = index
+		} else if static.Listing {
+			http.StripPrefix(strings.TrimSuffix(h.R.Path, "/"), http.FileServer(http.Dir(static.Dir))).ServeHTTP(writer, request)
+			return
+		} else {
+			http.NotFound(writer, request)
+			return
+		}
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+	defer file.Close()
+	h.R.Return.Headers.CanonicalHeaders().ToMap(writer.Header())
+	http.ServeContent(writer, request, info.Name(), info.ModTime(), file)
+}
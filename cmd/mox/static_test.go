@@ -0,0 +1,52 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticDirPrefix(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	for _, prefix := range []string{"/app", "/app/"} {
+		a := newTestAdmin(t, RouteRequest{Path: prefix, StaticDir: &StaticDir{Dir: dir}})
+		tests := []struct {
+			path   string
+			status int
+			body   string
+		}{
+			{"/app/a.txt", http.StatusOK, "a"},
+			{"/app/", http.StatusOK, "index"},
+			{"/app", http.StatusMovedPermanently, ""},
+			{"/apple", http.StatusNotFound, ""},
+			{"/app.txt", http.StatusNotFound, ""},
+		}
+		for _, x := range tests {
+			rec := serve(a, "GET", x.path, "")
+			if rec.Code != x.status || (len(x.body) > 0 && rec.Body.String() != x.body) {
+				t.Errorf("%s %s: got %d %q", prefix, x.path, rec.Code, rec.Body.String())
+			}
+		}
+	}
+	a := newTestAdmin(t, RouteRequest{Path: "/", StaticDir: &StaticDir{Dir: dir}})
+	if rec := serve(a, "GET", "/a.txt", ""); rec.Body.String() != "a" {
+		t.Errorf("root: got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// RouteStats keeps usage statistics for a route
+	RouteStats struct {
+		Route string `json:"route"`
+		Hits  int64  `json:"hits"`
+		// TotalLatency and MaxLatency are in nanoseconds
+		TotalLatency time.Duration `json:"totalLatency"`
+		MaxLatency   time.Duration `json:"maxLatency"`
+		// Disconnects is the number of requests the client aborted
+		// before the response was written
+		Disconnects int64 `json:"disconnects"`
+		// LastDisconnect is the time from the arrival of the last
+		// aborted request until the client gave up, in nanoseconds
+		LastDisconnect time.Duration `json:"lastDisconnect,omitempty"`
+		// Faults counts the injected faults served, by fault type
+		Faults map[string]int64 `json:"faults,omitempty"`
+	}
+
+	// Stats keeps statistics for all routes
+	Stats struct {
+		sync.Mutex
+		routes map[string]*RouteStats
+	}
+
+	// StatsReport is returned from the admin /stats endpoint
+	StatsReport struct {
+		Routes []RouteStats `json:"routes"`
+		// Unmatched contains the most recent unmatched requests
+		Unmatched []UnmatchedRequest `json:"unmatched"`
+	}
+)
+
+// Injected fault types
+const (
+	// faultOverload is a 503 returned when a route has too many
+	// requests in flight
+	faultOverload = "overload"
+	// faultError is a 5xx response chosen by a variant or a schedule
+	faultError = "error"
+	// faultRateLimit is a 429 returned when a route's rate limit is
+	// exceeded
+	faultRateLimit = "ratelimit"
+	// faultBreaker is a 503 returned while a route's circuit breaker
+	// is open
+	faultBreaker = "breaker"
+	// faultDelay is a response delayed by its delay, latency or delay
+	// profile
+	faultDelay = "delay"
+)
+
+// maxRecentUnmatched is the number of unmatched requests in a stats report
+const maxRecentUnmatched = 10
+
+// Record records a hit to a route
+func (s *Stats) Record(route string, latency time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	st := s.route(route)
+	st.Hits++
+	st.TotalLatency += latency
+	if latency > st.MaxLatency {
+		st.MaxLatency = latency
+	}
+}
+
+// RecordDisconnect records a request to a route that the client
+// aborted after the given time
+func (s *Stats) RecordDisconnect(route string, after time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	st := s.route(route)
+	st.Disconnects++
+	st.LastDisconnect = after
+}
+
+// RecordFault records a fault of the given type injected into a
+// response of a route
+func (s *Stats) RecordFault(route, fault string) {
+	s.Lock()
+	defer s.Unlock()
+	st := s.route(route)
+	if st.Faults == nil {
+		st.Faults = make(map[string]int64)
+	}
+	st.Faults[fault]++
+}
+
+// route returns the statistics of a route. The caller must hold the lock
+func (s *Stats) route(route string) *RouteStats {
+	if s.routes == nil {
+		s.routes = make(map[string]*RouteStats)
+	}
+	st, ok := s.routes[route]
+	if !ok {
+		st = &RouteStats{Route: route}
+		s.routes[route] = st
+	}
+	return st
+}
+
+// Get returns statistics for all routes, sorted by route
+func (s *Stats) Get() []RouteStats {
+	s.Lock()
+	ret := make([]RouteStats, 0, len(s.routes))
+	for _, st := range s.routes {
+		cp := *st
+		if st.Faults != nil {
+			cp.Faults = make(map[string]int64, len(st.Faults))
+			for k, v := range st.Faults {
+				cp.Faults[k] = v
+			}
+		}
+		ret = append(ret, cp)
+	}
+	s.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Route < ret[j].Route })
+	return ret
+}
+
+// Reset clears all statistics
+func (s *Stats) Reset() {
+	s.Lock()
+	s.routes = nil
+	s.Unlock()
+}
+
+func (h *AdminHandler) serveStats(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	report := StatsReport{Routes: h.M.Stats.Get(), Unmatched: h.M.Unmatched.Get()}
+	if n := len(report.Unmatched); n > maxRecentUnmatched {
+		report.Unmatched = report.Unmatched[n-maxRecentUnmatched:]
+	}
+	ret, _ := json.Marshal(report)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
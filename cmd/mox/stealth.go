@@ -0,0 +1,78 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// stealthWriter sets the Server header of responses, and in stealth
+// mode removes the headers that identify mox
+type stealthWriter struct {
+	http.ResponseWriter
+	server  string
+	stealth bool
+	done    bool
+}
+
+// scrub fixes the headers before they are written
+func (w *stealthWriter) scrub() {
+	if w.done {
+		return
+	}
+	w.done = true
+	header := w.ResponseWriter.Header()
+	if w.stealth {
+		for k := range header {
+			if strings.HasPrefix(k, "X-Mox-") {
+				delete(header, k)
+			}
+		}
+		for i, v := range header["Www-Authenticate"] {
+			header["Www-Authenticate"][i] = strings.Replace(v, `realm="mox"`, `realm="api"`, 1)
+		}
+	}
+	if len(w.server) > 0 {
+		header.Set("Server", w.server)
+	}
+}
+
+func (w *stealthWriter) WriteHeader(status int) {
+	w.scrub()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *stealthWriter) Write(data []byte) (int, error) {
+	w.scrub()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *stealthWriter) Flush() {
+	w.scrub()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *stealthWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
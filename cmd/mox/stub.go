@@ -0,0 +1,69 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// stubFlags collects repeated -stub flags
+type stubFlags []string
+
+func (s *stubFlags) String() string {
+	return strings.Join(*s, ", ")
+}
+
+// Set adds a stub definition
+func (s *stubFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// ParseStub parses a one-line stub definition of the form:
+//
+//	METHOD PATH -> STATUS [BODY]
+//
+// For example: GET /ping -> 200 {"ok":true}. If the body looks like
+// JSON, the response has Content-Type: application/json
+func ParseStub(s string) (RouteRequest, error) {
+	var req RouteRequest
+	arrow := strings.Index(s, "->")
+	if arrow == -1 {
+		return req, errors.New("stub: missing '->' in " + s)
+	}
+	match := strings.Fields(s[:arrow])
+	if len(match) != 2 {
+		return req, errors.New("stub: expecting METHOD PATH before '->' in " + s)
+	}
+	req.Method = strings.ToUpper(match[0])
+	req.Path = match[1]
+	ret := strings.TrimSpace(s[arrow+2:])
+	statusStr := ret
+	if sp := strings.IndexAny(ret, " \t"); sp != -1 {
+		statusStr = ret[:sp]
+		req.Return.Body = strings.TrimSpace(ret[sp:])
+	}
+	status, err := strconv.Atoi(statusStr)
+	if err != nil {
+		return req, errors.New("stub: invalid status in " + s)
+	}
+	req.Return.Status = status
+	if strings.HasPrefix(req.Return.Body, "{") || strings.HasPrefix(req.Return.Body, "[") {
+		req.Return.Headers = Pairs{{Key: "Content-Type", Value: "application/json"}}
+	}
+	return req, nil
+}
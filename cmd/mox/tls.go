@@ -0,0 +1,221 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertAuthority is a generated CA issuing certificates for mox TLS
+// listeners. Clients trust mox by installing the CA certificate,
+// available from the admin port as /tls/ca.pem
+type CertAuthority struct {
+	sync.Mutex
+	Cert  *x509.Certificate
+	Key   crypto.Signer
+	PEM   []byte
+	cache map[string]*tls.Certificate
+}
+
+// CertOptions describe a certificate to generate
+type CertOptions struct {
+	Hosts     []string
+	NotBefore time.Time
+	NotAfter  time.Time
+	// RSABits generates an RSA key of this size instead of ECDSA
+	RSABits int
+	// SelfSigned signs the certificate with its own key
+	SelfSigned bool
+}
+
+func serialNumber() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 120))
+	return n
+}
+
+// NewCertAuthority generates a new CA
+func NewCertAuthority() (*CertAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "mox CA", Organization: []string{"mox"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return newCertAuthority(cert, key), nil
+}
+
+func newCertAuthority(cert *x509.Certificate, key crypto.Signer) *CertAuthority {
+	return &CertAuthority{Cert: cert,
+		Key:   key,
+		PEM:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		cache: make(map[string]*tls.Certificate)}
+}
+
+// LoadCertAuthority reads the CA certificate and key from a PEM file.
+// If the file does not exist, a new CA is generated and saved to it,
+// so clients keep trusting the CA when mox restarts
+func LoadCertAuthority(file string) (*CertAuthority, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		ca, err := NewCertAuthority()
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.MarshalPKCS8PrivateKey(ca.Key)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append([]byte(nil), ca.PEM...), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})...)
+		return ca, ioutil.WriteFile(file, data, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !cert.IsCA || !ok {
+		return nil, errors.New("not a CA certificate and key: " + file)
+	}
+	return newCertAuthority(cert, key), nil
+}
+
+// Issue generates a certificate. Certificates are cached by key
+func (ca *CertAuthority) Issue(cacheKey string, opt CertOptions) (*tls.Certificate, error) {
+	ca.Lock()
+	defer ca.Unlock()
+	if cert, ok := ca.cache[cacheKey]; ok {
+		return cert, nil
+	}
+	var key crypto.Signer
+	var err error
+	if opt.RSABits > 0 {
+		key, err = rsa.GenerateKey(rand.Reader, opt.RSABits)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opt.NotBefore.IsZero() {
+		opt.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if opt.NotAfter.IsZero() {
+		opt.NotAfter = time.Now().AddDate(1, 0, 0)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		NotBefore:    opt.NotBefore,
+		NotAfter:     opt.NotAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if len(opt.Hosts) > 0 {
+		tmpl.Subject.CommonName = opt.Hosts[0]
+	}
+	for _, h := range opt.Hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	parent, signer := ca.Cert, ca.Key
+	if opt.SelfSigned {
+		parent, signer = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	if !opt.SelfSigned {
+		cert.Certificate = append(cert.Certificate, ca.Cert.Raw)
+	}
+	ca.cache[cacheKey] = cert
+	return cert, nil
+}
+
+// serveCA serves the CA certificate in PEM format, or in DER format
+// for trust stores that import .der files
+func (h *AdminHandler) serveCA(writer http.ResponseWriter, request *http.Request) {
+	if h.M.CA == nil {
+		http.Error(writer, "mox: no TLS listener or intercepting proxy", http.StatusNotFound)
+		return
+	}
+	if strings.HasSuffix(request.URL.Path, ".der") {
+		writer.Header().Set("Content-Type", "application/pkix-cert")
+		writer.Write(h.M.CA.Cert.Raw)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/x-pem-file")
+	writer.Write(h.M.CA.PEM)
+}
+
+// ServeTLS serves the handler on a TLS listener. Connections are
+// limited by limits, unless it is nil
+func ServeTLS(addr string, config *tls.Config, handler http.Handler, connState func(net.Conn, http.ConnState), limits *ConnLimits) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	ln = limits.Listener(ln, false)
+	srv := &http.Server{
+		Handler:      handler,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+		ConnState:    connState,
+		TLSConfig:    config,
+	}
+	return srv.Serve(tls.NewListener(ln, config))
+}
@@ -0,0 +1,182 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// TokenIssuer makes a route behave like an OAuth 2.0 token
+	// endpoint. It issues access tokens for the client credentials
+	// grant, and answers token introspection requests (RFC 7662).
+	// Bearer auth presets with introspect accept the issued tokens
+	TokenIssuer struct {
+		// Clients maps client ids to secrets. Any client is accepted
+		// if empty
+		Clients map[string]string `json:"clients,omitempty"`
+		// TTL is how long tokens are valid, as a duration. 1h if empty
+		TTL string `json:"ttl,omitempty"`
+		// Scope is the scope of the issued tokens if the client does
+		// not ask for one
+		Scope string `json:"scope,omitempty"`
+	}
+
+	// Tokens are the access tokens issued by token routes
+	Tokens struct {
+		sync.Mutex
+		tokens map[string]IssuedToken
+	}
+
+	// IssuedToken is an access token issued by a token route
+	IssuedToken struct {
+		ClientID string
+		Scope    string
+		Expires  time.Time
+	}
+
+	// tokenResponse is the body of a successful token request
+	tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope,omitempty"`
+	}
+
+	// introspection is the body of a token introspection response
+	introspection struct {
+		Active    bool   `json:"active"`
+		ClientID  string `json:"client_id,omitempty"`
+		Scope     string `json:"scope,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		Exp       int64  `json:"exp,omitempty"`
+	}
+)
+
+// defaultTokenTTL is how long tokens are valid without a ttl
+const defaultTokenTTL = time.Hour
+
+// Validate checks the token endpoint definition
+func (t *TokenIssuer) Validate() error {
+	if len(t.TTL) > 0 {
+		if d, err := time.ParseDuration(t.TTL); err != nil || d <= 0 {
+			return fmt.Errorf("token: invalid ttl %s", t.TTL)
+		}
+	}
+	return nil
+}
+
+func (t *TokenIssuer) ttl() time.Duration {
+	if d, err := time.ParseDuration(t.TTL); err == nil && d > 0 {
+		return d
+	}
+	return defaultTokenTTL
+}
+
+// client returns the client id of the request, and false if the
+// client credentials are not accepted. Credentials are taken from
+// basic authentication, or from the client_id and client_secret
+// fields
+func (t *TokenIssuer) client(request *http.Request, fields map[string]string) (string, bool) {
+	id, secret, ok := request.BasicAuth()
+	if !ok {
+		id, secret = fields["client_id"], fields["client_secret"]
+	}
+	if len(t.Clients) == 0 {
+		return id, true
+	}
+	want, ok := t.Clients[id]
+	return id, ok && hmac.Equal([]byte(want), []byte(secret))
+}
+
+// ServeToken answers a token or introspection request. Requests with a
+// token field are introspection requests, others must use the
+// client_credentials grant
+func (t *TokenIssuer) ServeToken(tokens *Tokens, writer http.ResponseWriter, request *http.Request) {
+	fields := loginFields(request)
+	client, ok := t.client(request, fields)
+	if !ok {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="mox"`)
+		writeTokenJSON(writer, http.StatusUnauthorized, authError{Error: "invalid_client", Message: "client authentication failed"})
+		return
+	}
+	if token, ok := fields["token"]; ok {
+		ret := introspection{}
+		if it, ok := tokens.Lookup(token); ok {
+			ret = introspection{Active: true, ClientID: it.ClientID, Scope: it.Scope, TokenType: "Bearer", Exp: it.Expires.Unix()}
+		}
+		writeTokenJSON(writer, http.StatusOK, ret)
+		return
+	}
+	if grant := fields["grant_type"]; grant != "client_credentials" {
+		writeTokenJSON(writer, http.StatusBadRequest, authError{Error: "unsupported_grant_type", Message: "grant type " + grant + " is not supported"})
+		return
+	}
+	scope := fields["scope"]
+	if len(scope) == 0 {
+		scope = t.Scope
+	}
+	ttl := t.ttl()
+	token := tokens.Issue(IssuedToken{ClientID: client, Scope: scope, Expires: time.Now().Add(ttl)})
+	writer.Header().Set("Cache-Control", "no-store")
+	writeTokenJSON(writer, http.StatusOK, tokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int(ttl / time.Second), Scope: scope})
+}
+
+func writeTokenJSON(writer http.ResponseWriter, status int, v interface{}) {
+	data, _ := json.Marshal(v)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(data)
+}
+
+// Issue stores the token and returns its value
+func (t *Tokens) Issue(token IssuedToken) string {
+	var b [16]byte
+	rand.Read(b[:])
+	value := hex.EncodeToString(b[:])
+	t.Lock()
+	defer t.Unlock()
+	if t.tokens == nil {
+		t.tokens = make(map[string]IssuedToken)
+	}
+	t.tokens[value] = token
+	return value
+}
+
+// Lookup returns the token, false if it was not issued or it expired
+func (t *Tokens) Lookup(value string) (IssuedToken, bool) {
+	t.Lock()
+	defer t.Unlock()
+	token, ok := t.tokens[value]
+	if ok && !time.Now().Before(token.Expires) {
+		delete(t.tokens, value)
+		return token, false
+	}
+	return token, ok
+}
+
+// Reset revokes all tokens
+func (t *Tokens) Reset() {
+	t.Lock()
+	t.tokens = nil
+	t.Unlock()
+}
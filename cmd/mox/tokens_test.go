@@ -0,0 +1,139 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postForm sends a form to the mock handler
+func postForm(a *AdminHandler, target string, form url.Values, user, password string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(user) > 0 {
+		request.SetBasicAuth(user, password)
+	}
+	a.M.ServeHTTP(rec, request)
+	return rec
+}
+
+// getWithToken sends a GET with a bearer token to the mock handler
+func getWithToken(a *AdminHandler, target, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", target, nil)
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	a.M.ServeHTTP(rec, request)
+	return rec
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	a := newTestAdmin(t,
+		RouteRequest{Method: "POST", Path: "/oauth/token", Token: &TokenIssuer{Clients: map[string]string{"app": "secret"}, Scope: "read"}},
+		RouteRequest{Method: "GET", Path: "/api", Auth: &AuthPreset{Type: AuthBearer, Introspect: true}, Return: ReturnData{Status: http.StatusOK, Body: "ok"}},
+		RouteRequest{Method: "GET", Path: "/static", Auth: &AuthPreset{Type: AuthBearer, Values: []string{"t1"}}, Return: ReturnData{Status: http.StatusOK}},
+	)
+	rec := postForm(a, "/oauth/token", url.Values{"grant_type": {"client_credentials"}}, "app", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token: %d %s", rec.Code, rec.Body.String())
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil || len(token.AccessToken) == 0 || token.TokenType != "Bearer" || token.ExpiresIn != 3600 || token.Scope != "read" {
+		t.Fatalf("token: %s %v", rec.Body.String(), err)
+	}
+
+	tests := []struct {
+		target, token string
+		status        int
+	}{
+		{"/api", token.AccessToken, http.StatusOK},
+		{"/api", "forged", http.StatusUnauthorized},
+		{"/api", "", http.StatusUnauthorized},
+		{"/static", token.AccessToken, http.StatusUnauthorized},
+		{"/static", "t1", http.StatusOK},
+	}
+	for _, x := range tests {
+		rec := getWithToken(a, x.target, x.token)
+		if rec.Code != x.status {
+			t.Errorf("%s with %q: got %d, expected %d", x.target, x.token, rec.Code, x.status)
+		}
+		if x.status == http.StatusUnauthorized && len(x.token) > 0 && !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+			t.Errorf("%s with %q: WWW-Authenticate %q", x.target, x.token, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	rec = postForm(a, "/oauth/token", url.Values{"token": {token.AccessToken}}, "app", "secret")
+	var info introspection
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if !info.Active || info.ClientID != "app" || info.Scope != "read" {
+		t.Errorf("introspection: %s", rec.Body.String())
+	}
+	rec = postForm(a, "/oauth/token", url.Values{"token": {"forged"}}, "app", "secret")
+	if rec.Body.String() != `{"active":false}` {
+		t.Errorf("introspection of an unknown token: %s", rec.Body.String())
+	}
+
+	a.Reset()
+	if rec := postForm(a, "/oauth/token", url.Values{"token": {token.AccessToken}}, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("reset kept the token route: %d", rec.Code)
+	}
+	if _, ok := a.M.Tokens.Lookup(token.AccessToken); ok {
+		t.Errorf("reset kept the issued token")
+	}
+}
+
+func TestTokenRequestErrors(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{Method: "POST", Path: "/token", Token: &TokenIssuer{Clients: map[string]string{"app": "secret"}}})
+	tests := []struct {
+		form           url.Values
+		user, password string
+		status         int
+		err            string
+	}{
+		{url.Values{"grant_type": {"client_credentials"}}, "app", "wrong", http.StatusUnauthorized, "invalid_client"},
+		{url.Values{"grant_type": {"client_credentials"}, "client_id": {"other"}}, "", "", http.StatusUnauthorized, "invalid_client"},
+		{url.Values{"grant_type": {"password"}}, "app", "secret", http.StatusBadRequest, "unsupported_grant_type"},
+		{url.Values{"grant_type": {"client_credentials"}, "client_id": {"app"}, "client_secret": {"secret"}}, "", "", http.StatusOK, ""},
+	}
+	for _, x := range tests {
+		rec := postForm(a, "/token", x.form, x.user, x.password)
+		var body authError
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != x.status || body.Error != x.err {
+			t.Errorf("%v: got %d %s", x.form, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestTokenExpires(t *testing.T) {
+	var tokens Tokens
+	value := tokens.Issue(IssuedToken{ClientID: "app"})
+	if _, ok := tokens.Lookup(value); ok {
+		t.Errorf("expired token accepted")
+	}
+	if err := (&TokenIssuer{TTL: "soon"}).Validate(); err == nil {
+		t.Errorf("expected an error for an invalid ttl")
+	}
+	if err := (&AuthPreset{Type: AuthBearer}).Validate(); err == nil {
+		t.Errorf("expected an error for bearer without values or introspect")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Top is a terminal dashboard showing live route statistics of a
+// running mox instance
+type Top struct {
+	AdminURL string
+	Interval time.Duration
+	Out      io.Writer
+	last     map[string]int64
+}
+
+// Run refreshes the dashboard until interrupted
+func (t *Top) Run() {
+	t.last = make(map[string]int64)
+	for {
+		report, err := t.fetch()
+		// Clear screen and move the cursor home
+		fmt.Fprint(t.Out, "\033[H\033[2J")
+		fmt.Fprintf(t.Out, "mox top %s  %s\n\n", t.AdminURL, time.Now().Format("15:04:05"))
+		if err != nil {
+			fmt.Fprintln(t.Out, err)
+		} else {
+			t.print(report)
+		}
+		time.Sleep(t.Interval)
+	}
+}
+
+func (t *Top) fetch() (StatsReport, error) {
+	var report StatsReport
+	rsp, err := http.Get(t.AdminURL + "/stats")
+	if err != nil {
+		return report, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("%s/stats: %s", t.AdminURL, rsp.Status)
+	}
+	err = json.NewDecoder(rsp.Body).Decode(&report)
+	return report, err
+}
+
+func (t *Top) print(report StatsReport) {
+	fmt.Fprintf(t.Out, "%-40s %10s %8s %12s %12s %8s\n", "ROUTE", "HITS", "RATE/s", "AVG", "MAX", "ABORTED")
+	for _, st := range report.Routes {
+		var rate float64
+		if prev, ok := t.last[st.Route]; ok {
+			rate = float64(st.Hits-prev) / t.Interval.Seconds()
+		}
+		t.last[st.Route] = st.Hits
+		var avg time.Duration
+		if st.Hits > 0 {
+			avg = st.TotalLatency / time.Duration(st.Hits)
+		}
+		fmt.Fprintf(t.Out, "%-40s %10d %8.1f %12v %12v %8d\n", truncate(st.Route, 40), st.Hits, rate, avg, st.MaxLatency, st.Disconnects)
+	}
+	fmt.Fprintf(t.Out, "\nRecent unmatched requests:\n")
+	for i := len(report.Unmatched) - 1; i >= 0; i-- {
+		u := report.Unmatched[i]
+		uri := u.Path
+		if len(u.Query) > 0 {
+			uri += "?" + u.Query
+		}
+		fmt.Fprintf(t.Out, "  %s %-7s %s\n", u.Time.Format("15:04:05"), u.Method, uri)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+// runTop runs the top command. The optional argument is the admin URL
+// of the mox instance, by default the admin address of -adm
+func runTop(args []string) {
+	url := adminURL(*adminPort)
+	if len(args) > 0 {
+		url = strings.TrimSuffix(args[0], "/")
+	}
+	t := Top{AdminURL: url, Interval: time.Second, Out: os.Stdout}
+	t.Run()
+}
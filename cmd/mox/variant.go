@@ -0,0 +1,107 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "errors"
+
+// Variant is one of several weighted responses of a route
+type Variant struct {
+	// Weight is the relative frequency of the variant
+	Weight int        `json:"weight"`
+	Return ReturnData `json:"return"`
+}
+
+// validateVariants checks that variant weights are usable
+func validateVariants(variants []Variant) error {
+	total := 0
+	for _, v := range variants {
+		if v.Weight < 0 {
+			return errors.New("variant weights cannot be negative")
+		}
+		total += v.Weight
+	}
+	if len(variants) > 0 && total == 0 {
+		return errors.New("variant weights add up to 0")
+	}
+	return nil
+}
+
+// pickVariant picks a variant randomly by weight
+func pickVariant(variants []Variant) ReturnData {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	n := rnd.Intn(total)
+	for _, v := range variants {
+		if n < v.Weight {
+			return v.Return
+		}
+		n -= v.Weight
+	}
+	return variants[len(variants)-1].Return
+}
+
+// mapResponses returns a copy of the route with f applied to the
+// responses Responses returns. The route is not changed
+func (r RouteRequest) mapResponses(f func(ReturnData) (ReturnData, error)) (RouteRequest, error) {
+	var err error
+	if len(r.Variants) == 0 && len(r.Sequence) == 0 {
+		if r.Return, err = f(r.Return); err != nil {
+			return r, err
+		}
+	}
+	if r.Sequence != nil {
+		r.Sequence = append([]ReturnData(nil), r.Sequence...)
+		for i := range r.Sequence {
+			if r.Sequence[i], err = f(r.Sequence[i]); err != nil {
+				return r, err
+			}
+		}
+	}
+	if r.Variants != nil {
+		r.Variants = append([]Variant(nil), r.Variants...)
+		for i := range r.Variants {
+			if r.Variants[i].Return, err = f(r.Variants[i].Return); err != nil {
+				return r, err
+			}
+		}
+	}
+	if r.Schedule != nil {
+		r.Schedule = append([]Window(nil), r.Schedule...)
+		for i := range r.Schedule {
+			if r.Schedule[i].Return, err = f(r.Schedule[i].Return); err != nil {
+				return r, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// Responses returns all responses the route may return
+func (r RouteRequest) Responses() []ReturnData {
+	var ret []ReturnData
+	if len(r.Variants) == 0 && len(r.Sequence) == 0 {
+		ret = append(ret, r.Return)
+	}
+	ret = append(ret, r.Sequence...)
+	for _, v := range r.Variants {
+		ret = append(ret, v.Return)
+	}
+	for _, w := range r.Schedule {
+		ret = append(ret, w.Return)
+	}
+	return ret
+}
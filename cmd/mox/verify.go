@@ -0,0 +1,326 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// UnmatchedRequest records a request that did not match any route
+	UnmatchedRequest struct {
+		Method string    `json:"method"`
+		Path   string    `json:"path"`
+		Query  string    `json:"query,omitempty"`
+		Time   time.Time `json:"time"`
+		// Test is the correlation id of the request
+		Test string `json:"test,omitempty"`
+	}
+
+	// Unmatched keeps the last requests no route was found for
+	Unmatched struct {
+		sync.Mutex
+		// Size is the maximum number of requests kept, 0 for no limit
+		Size     int
+		Requests []UnmatchedRequest
+		total    int
+	}
+
+	// VerifyResult is the result of a verification
+	VerifyResult struct {
+		Pass      bool               `json:"pass"`
+		Unmatched []UnmatchedRequest `json:"unmatched,omitempty"`
+		// BlockedEgress are the calls the egress guard blocked
+		BlockedEgress []EgressCall `json:"blockedEgress,omitempty"`
+		// OutOfOrder are the requests ordered cassette replay rejected
+		OutOfOrder []ReplayFailure `json:"outOfOrder,omitempty"`
+		// SpecViolations are the served responses that violated the
+		// spec
+		SpecViolations []SpecViolation `json:"specViolations,omitempty"`
+	}
+
+	// Expectation asserts how many requests in the journal match a
+	// request matcher. The matcher fields work as they do in routes.
+	// Without a count, at least one request must match
+	Expectation struct {
+		Method   string         `json:"method,omitempty"`
+		Path     string         `json:"path"`
+		Headers  Pairs          `json:"headers,omitempty"`
+		Queries  Pairs          `json:"queries,omitempty"`
+		Body     *BodyMatch     `json:"body,omitempty"`
+		JSONBody *JSONBodyMatch `json:"jsonBody,omitempty"`
+		Match    *MatchExpr     `json:"match,omitempty"`
+		// Test limits the expectation to a correlation id
+		Test    string `json:"test,omitempty"`
+		Exactly *int   `json:"exactly,omitempty"`
+		AtLeast *int   `json:"atLeast,omitempty"`
+		AtMost  *int   `json:"atMost,omitempty"`
+	}
+
+	// ExpectationResult is the result of checking an expectation,
+	// with the matching requests
+	ExpectationResult struct {
+		Pass     bool           `json:"pass"`
+		Count    int            `json:"count"`
+		Requests []JournalEntry `json:"requests"`
+	}
+)
+
+// Add records an unmatched request with its correlation id, dropping
+// the oldest one if there are Size requests already, and returns it
+// with the number of unmatched requests since the last reset
+func (u *Unmatched) Add(request *http.Request, test string) (UnmatchedRequest, int) {
+	req := UnmatchedRequest{Method: request.Method,
+		Path:  request.URL.Path,
+		Query: request.URL.RawQuery,
+		Time:  time.Now(),
+		Test:  test}
+	u.Lock()
+	defer u.Unlock()
+	if u.Size > 0 && len(u.Requests) >= u.Size {
+		u.Requests = append(u.Requests[:0], u.Requests[len(u.Requests)-u.Size+1:]...)
+	}
+	u.Requests = append(u.Requests, req)
+	u.total++
+	return req, u.total
+}
+
+// Total returns the number of unmatched requests since the last
+// reset, including the ones that were dropped
+func (u *Unmatched) Total() int {
+	u.Lock()
+	defer u.Unlock()
+	return u.total
+}
+
+// Get returns a copy of unmatched requests
+func (u *Unmatched) Get() []UnmatchedRequest {
+	u.Lock()
+	defer u.Unlock()
+	ret := make([]UnmatchedRequest, len(u.Requests))
+	copy(ret, u.Requests)
+	return ret
+}
+
+// Reset clears unmatched requests
+func (u *Unmatched) Reset() {
+	u.Lock()
+	u.Requests = nil
+	u.total = 0
+	u.Unlock()
+}
+
+// undefined handles requests that match no route. With the egress
+// guard, it passes forward proxy requests through to their
+// destination. It replays requests from their cassette if it has a
+// route for them. It forwards requests to the forward target of their
+// path or the proxy upstream if there is one, unless the egress guard
+// blocks it. In strict mode
+// with strict501, it returns 501 with a body identifying the
+// request, otherwise it returns the fallback response or the given
+// status. A 404 lists and logs the routes that came closest to
+// matching, and a 405 has an Allow header with the methods the path
+// has routes for
+func (h *MockHandler) undefined(status int) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		test := h.correlation(request)
+		if dest, ok := destination(request); ok && h.Egress.Enabled {
+			h.Egress.PassThrough(writer, request, dest, test)
+			return
+		}
+		if h.Cassettes.Serve(writer, request, test) {
+			return
+		}
+		if p := h.Forwards.Get(request.URL.Path); p != nil {
+			if h.Egress.Check(writer, request, p.Upstream, test) {
+				p.ServeHTTP(writer, request)
+			}
+			return
+		}
+		if h.Proxy != nil {
+			if h.Egress.Check(writer, request, h.Proxy.Upstream, test) {
+				h.Proxy.ServeHTTP(writer, request)
+			}
+			return
+		}
+		req, n := h.Unmatched.Add(request, test)
+		if h.Strict {
+			h.Notifier.Notify(Event{Type: EventVerificationFailed, Unmatched: n, Request: &req})
+		}
+		if h.Strict && h.Strict501 {
+			writer.WriteHeader(http.StatusNotImplemented)
+			fmt.Fprintf(writer, "mox: undefined interaction: %s %s\n", request.Method, request.URL.RequestURI())
+			return
+		}
+		var misses []nearMiss
+		if status == http.StatusNotFound {
+			if misses = h.nearMisses(request); len(misses) > 0 {
+				fmt.Print(nearMissReport(request, misses))
+			}
+		}
+		if status == http.StatusMethodNotAllowed {
+			if allowed := allowedMethods(h.Router, request); len(allowed) > 0 {
+				writer.Header().Set("Allow", strings.Join(allowed, ", "))
+			}
+		}
+		if ret, ok := h.Fallbacks.get(status); ok {
+			h.writeFallback(writer, request, ret)
+			return
+		}
+		if status == http.StatusNotFound {
+			if len(misses) == 0 || h.Stealth {
+				http.NotFound(writer, request)
+				return
+			}
+			http.Error(writer, "404 page not found\n"+strings.TrimSuffix(nearMissReport(request, misses), "\n"), status)
+			return
+		}
+		writer.WriteHeader(status)
+	})
+}
+
+// VerifyAll checks that the mock was used as expected. In strict
+// mode, any unmatched request fails verification, and any call the
+// egress guard blocked, request ordered replay rejected or response
+// that violated the spec always does. If test is not empty, only the
+// requests with that correlation id are checked
+func (h *MockHandler) VerifyAll(test string) VerifyResult {
+	ret := VerifyResult{Pass: true}
+	if h.Strict {
+		for _, u := range h.Unmatched.Get() {
+			if len(test) == 0 || u.Test == test {
+				ret.Unmatched = append(ret.Unmatched, u)
+			}
+		}
+		ret.Pass = len(ret.Unmatched) == 0
+	}
+	if blocked := h.Egress.Blocked(test); len(blocked) > 0 {
+		ret.BlockedEgress = blocked
+		ret.Pass = false
+	}
+	if failures := h.Cassettes.Failures(test); len(failures) > 0 {
+		ret.OutOfOrder = failures
+		ret.Pass = false
+	}
+	if violations := h.Violations.Get(test); len(violations) > 0 {
+		ret.SpecViolations = violations
+		ret.Pass = false
+	}
+	return ret
+}
+
+// matcher returns a router that matches the requests of the
+// expectation
+func (e Expectation) matcher() (*mux.Router, error) {
+	if len(e.Path) == 0 {
+		return nil, errors.New("path required")
+	}
+	for _, n := range []*int{e.Exactly, e.AtLeast, e.AtMost} {
+		if n != nil && *n < 0 {
+			return nil, errors.New("negative count")
+		}
+	}
+	r := RouteRequest{Method: e.Method, Path: e.Path, Headers: e.Headers, Queries: e.Queries, Body: e.Body, JSONBody: e.JSONBody, Match: e.Match}
+	router := mux.NewRouter()
+	route, err := r.BuildRoute(router)
+	if err != nil {
+		return nil, err
+	}
+	route.Handler(http.NotFoundHandler())
+	return router, nil
+}
+
+// Check checks the expectation against journal entries
+func (e Expectation) Check(entries []JournalEntry) (ExpectationResult, error) {
+	router, err := e.matcher()
+	if err != nil {
+		return ExpectationResult{}, err
+	}
+	ret := ExpectationResult{Requests: []JournalEntry{}}
+	for _, x := range entries {
+		if len(e.Test) > 0 && x.Test != e.Test {
+			continue
+		}
+		var match mux.RouteMatch
+		if router.Match(x.Request(), &match) && match.MatchErr == nil {
+			ret.Requests = append(ret.Requests, x)
+		}
+	}
+	ret.Count = len(ret.Requests)
+	ret.Pass = true
+	if e.Exactly != nil && ret.Count != *e.Exactly {
+		ret.Pass = false
+	}
+	if e.AtLeast != nil && ret.Count < *e.AtLeast {
+		ret.Pass = false
+	}
+	if e.AtMost != nil && ret.Count > *e.AtMost {
+		ret.Pass = false
+	}
+	if e.Exactly == nil && e.AtLeast == nil && e.AtMost == nil && ret.Count == 0 {
+		ret.Pass = false
+	}
+	return ret, nil
+}
+
+// serveVerify checks an expectation against the journal
+func (h *AdminHandler) serveVerify(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var e Expectation
+	if err := json.NewDecoder(request.Body).Decode(&e); err != nil {
+		writeError(writer, err)
+		return
+	}
+	result, err := e.Check(h.M.Journal.Get(e.Test))
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	ret, _ := json.Marshal(result)
+	writer.Header().Set("Content-Type", "application/json")
+	if result.Pass {
+		writer.WriteHeader(http.StatusOK)
+	} else {
+		writer.WriteHeader(http.StatusExpectationFailed)
+	}
+	writer.Write(ret)
+}
+
+func (h *AdminHandler) serveVerifyAll(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	result := h.M.VerifyAll(request.URL.Query().Get("test"))
+	ret, _ := json.Marshal(result)
+	writer.Header().Set("Content-Type", "application/json")
+	if result.Pass {
+		writer.WriteHeader(http.StatusOK)
+	} else {
+		writer.WriteHeader(http.StatusExpectationFailed)
+	}
+	writer.Write(ret)
+}
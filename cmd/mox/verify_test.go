@@ -0,0 +1,52 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnmatchedSize(t *testing.T) {
+	u := Unmatched{Size: 3}
+	for _, target := range []string{"/1", "/2", "/3", "/4", "/5"} {
+		u.Add(httptest.NewRequest("GET", target, nil), "")
+	}
+	got := u.Get()
+	if len(got) != 3 || got[0].Path != "/3" || got[2].Path != "/5" {
+		t.Errorf("got %+v", got)
+	}
+	if n := u.Total(); n != 5 {
+		t.Errorf("got total %d", n)
+	}
+	u.Reset()
+	if len(u.Get()) != 0 || u.Total() != 0 {
+		t.Errorf("reset kept requests")
+	}
+}
+
+func TestStrictVerifyAfterDrop(t *testing.T) {
+	a := newTestAdmin(t, RouteRequest{Method: "GET", Path: "/a", Return: ReturnData{Status: http.StatusOK}})
+	a.M.Strict = true
+	a.M.Unmatched.Size = 2
+	for _, target := range []string{"/x", "/y", "/z"} {
+		serve(a, "GET", target, "")
+	}
+	ret := a.M.VerifyAll("")
+	if ret.Pass || len(ret.Unmatched) != 2 || ret.Unmatched[1].Path != "/z" {
+		t.Errorf("got %+v", ret)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Received counts the requests the mock received by method and
+	// path, and wakes up waiters when a request arrives
+	Received struct {
+		sync.Mutex
+		counts  map[receivedKey]int
+		arrived chan struct{}
+	}
+
+	receivedKey struct {
+		method, path, test string
+	}
+
+	// WaitResult is the result of waiting for requests
+	WaitResult struct {
+		Pass  bool `json:"pass"`
+		Count int  `json:"count"`
+	}
+)
+
+// maxWait limits how long a wait request blocks
+const maxWait = 5 * time.Minute
+
+// Add counts a received request with its correlation id
+func (r *Received) Add(request *http.Request, test string) {
+	r.Lock()
+	defer r.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[receivedKey]int)
+	}
+	r.counts[receivedKey{method: request.Method, path: request.URL.Path, test: test}]++
+	if r.arrived != nil {
+		close(r.arrived)
+		r.arrived = nil
+	}
+}
+
+// count returns the number of requests received with the path, and
+// the method and the correlation id unless they are empty, and a
+// channel closed when another request arrives. The caller holds the
+// lock
+func (r *Received) count(method, path, test string) (int, chan struct{}) {
+	n := 0
+	for k, v := range r.counts {
+		if k.path == path && (len(method) == 0 || k.method == method) && (len(test) == 0 || k.test == test) {
+			n += v
+		}
+	}
+	if r.arrived == nil {
+		r.arrived = make(chan struct{})
+	}
+	return n, r.arrived
+}
+
+// Wait blocks until n requests with the method, path and correlation
+// id are received since the last reset, the timeout expires, or
+// cancel is closed. It returns the number of received requests, and
+// whether there were n
+func (r *Received) Wait(method, path, test string, n int, timeout time.Duration, cancel <-chan struct{}) (int, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		r.Lock()
+		count, arrived := r.count(method, path, test)
+		r.Unlock()
+		if count >= n {
+			return count, true
+		}
+		select {
+		case <-arrived:
+		case <-timer.C:
+			return count, false
+		case <-cancel:
+			return count, false
+		}
+	}
+}
+
+// Reset clears the received requests
+func (r *Received) Reset() {
+	r.Lock()
+	r.counts = nil
+	r.Unlock()
+}
+
+// parseWait returns the method, path, count and timeout of a wait
+// request
+func parseWait(request *http.Request) (string, string, int, time.Duration, error) {
+	q := request.URL.Query()
+	path := q.Get("path")
+	if len(path) == 0 {
+		return "", "", 0, 0, errors.New("path required")
+	}
+	n := 1
+	if s := q.Get("count"); len(s) > 0 {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 1 {
+			return "", "", 0, 0, errors.New("invalid count: " + s)
+		}
+	}
+	timeout := 10 * time.Second
+	if s := q.Get("timeout"); len(s) > 0 {
+		var err error
+		if timeout, err = time.ParseDuration(s); err != nil {
+			return "", "", 0, 0, err
+		}
+		if timeout > maxWait {
+			timeout = maxWait
+		}
+	}
+	return strings.ToUpper(q.Get("method")), path, n, timeout, nil
+}
+
+func (h *AdminHandler) serveWait(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	method, path, n, timeout, err := parseWait(request)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	var result WaitResult
+	result.Count, result.Pass = h.M.Received.Wait(method, path, request.URL.Query().Get("test"), n, timeout, request.Context().Done())
+	ret, _ := json.Marshal(result)
+	writer.Header().Set("Content-Type", "application/json")
+	if result.Pass {
+		writer.WriteHeader(http.StatusOK)
+	} else {
+		writer.WriteHeader(http.StatusExpectationFailed)
+	}
+	writer.Write(ret)
+}
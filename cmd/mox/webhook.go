@@ -0,0 +1,75 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type (
+	// Notifier posts events to a webhook URL
+	Notifier struct {
+		URL    string
+		Client *http.Client
+	}
+
+	// Event is a notification about a change in mock state
+	Event struct {
+		// Type is "routesChanged" or "verificationFailed"
+		Type string    `json:"type"`
+		Time time.Time `json:"time"`
+		// Routes is the number of routes after a change
+		Routes int `json:"routes"`
+		// Unmatched is the number of unmatched requests so far
+		Unmatched int `json:"unmatched"`
+		// Request is the request that caused a verification failure
+		Request *UnmatchedRequest `json:"request,omitempty"`
+	}
+)
+
+// Event types
+const (
+	EventRoutesChanged      = "routesChanged"
+	EventVerificationFailed = "verificationFailed"
+)
+
+// NewNotifier returns a notifier for the URL, or nil if the URL is empty
+func NewNotifier(url string) *Notifier {
+	if len(url) == 0 {
+		return nil
+	}
+	return &Notifier{URL: url, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Notify posts the event asynchronously. It is a no-op for a nil notifier
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	event.Time = time.Now()
+	data, _ := json.Marshal(event)
+	go func() {
+		rsp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(data))
+		if err != nil {
+			fmt.Printf("webhook: %v\n", err)
+			return
+		}
+		rsp.Body.Close()
+	}()
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// Run keeps track of the current test run: the number of requests
+	// received and the time the run started. A run starts when mox
+	// starts, and restarts with a resetting setup bundle
+	Run struct {
+		sync.Mutex
+		start time.Time
+		seq   int64
+	}
+
+	// Arrival describes when a request arrived in the run
+	Arrival struct {
+		// Seq is the arrival order of the request, starting from 1
+		Seq int64
+		// Elapsed is the time since the start of the run
+		Elapsed time.Duration
+		// Time is when the request arrived
+		Time time.Time
+	}
+
+	// When restricts a route to requests that arrive in a part of the
+	// run, such as after a warm-up period
+	When struct {
+		// After and Before are durations since the start of the run
+		After  string `json:"after,omitempty"`
+		Before string `json:"before,omitempty"`
+		// FromRequest and ToRequest are the first and the last
+		// arrival order of matching requests, inclusive
+		FromRequest int64 `json:"fromRequest,omitempty"`
+		ToRequest   int64 `json:"toRequest,omitempty"`
+	}
+)
+
+type arrivalKey struct{}
+
+// Arrive records the arrival of a request
+func (r *Run) Arrive() Arrival {
+	r.Lock()
+	defer r.Unlock()
+	r.seq++
+	now := time.Now()
+	return Arrival{Seq: r.seq, Elapsed: now.Sub(r.start), Time: now}
+}
+
+// Reset starts a new run
+func (r *Run) Reset() {
+	r.Lock()
+	r.start = time.Now()
+	r.seq = 0
+	r.Unlock()
+}
+
+// withArrival records the arrival of the request in the run, unless
+// it is already recorded
+func withArrival(request *http.Request, run *Run) *http.Request {
+	if _, ok := request.Context().Value(arrivalKey{}).(Arrival); ok {
+		return request
+	}
+	return request.WithContext(context.WithValue(request.Context(), arrivalKey{}, run.Arrive()))
+}
+
+// Validate checks the durations and the request range
+func (w When) Validate() error {
+	for _, d := range []string{w.After, w.Before} {
+		if len(d) > 0 {
+			if _, err := time.ParseDuration(d); err != nil {
+				return err
+			}
+		}
+	}
+	if w.FromRequest < 0 || w.ToRequest < 0 || (w.ToRequest > 0 && w.ToRequest < w.FromRequest) {
+		return errors.New("invalid request range")
+	}
+	return nil
+}
+
+// Matches returns true if the arrival satisfies all predicates
+func (w When) Matches(a Arrival) bool {
+	if len(w.After) > 0 {
+		if d, _ := time.ParseDuration(w.After); a.Elapsed < d {
+			return false
+		}
+	}
+	if len(w.Before) > 0 {
+		if d, _ := time.ParseDuration(w.Before); a.Elapsed >= d {
+			return false
+		}
+	}
+	if w.FromRequest > 0 && a.Seq < w.FromRequest {
+		return false
+	}
+	if w.ToRequest > 0 && a.Seq > w.ToRequest {
+		return false
+	}
+	return true
+}
+
+// whenMatcher matches requests whose arrival satisfies the predicates
+func whenMatcher(w When) func(*http.Request) bool {
+	return func(request *http.Request) bool {
+		a, ok := request.Context().Value(arrivalKey{}).(Arrival)
+		return ok && w.Matches(a)
+	}
+}
+
+// whenEq returns true if the predicates are the same
+func whenEq(w1, w2 *When) bool {
+	if w1 == nil || w2 == nil {
+		return w1 == w2
+	}
+	return *w1 == *w2
+}
@@ -0,0 +1,489 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// WireMockMapping is a WireMock stub mapping
+	WireMockMapping struct {
+		ID       string `json:"id"`
+		UUID     string `json:"uuid"`
+		Priority int    `json:"priority"`
+		Request  struct {
+			Method          string                     `json:"method"`
+			URL             string                     `json:"url"`
+			URLPath         string                     `json:"urlPath"`
+			URLPattern      string                     `json:"urlPattern"`
+			URLPathPattern  string                     `json:"urlPathPattern"`
+			Headers         map[string]WireMockPattern `json:"headers"`
+			QueryParameters map[string]WireMockPattern `json:"queryParameters"`
+			BodyPatterns    []WireMockPattern          `json:"bodyPatterns"`
+		} `json:"request"`
+		Response struct {
+			Status                 int                        `json:"status"`
+			Headers                map[string]json.RawMessage `json:"headers"`
+			Body                   string                     `json:"body"`
+			JSONBody               json.RawMessage            `json:"jsonBody"`
+			Base64Body             string                     `json:"base64Body"`
+			BodyFileName           string                     `json:"bodyFileName"`
+			FixedDelayMilliseconds int                        `json:"fixedDelayMilliseconds"`
+			Transformers           []string                   `json:"transformers"`
+			Fault                  string                     `json:"fault"`
+			ProxyBaseURL           string                     `json:"proxyBaseUrl"`
+		} `json:"response"`
+		ScenarioName          string `json:"scenarioName"`
+		RequiredScenarioState string `json:"requiredScenarioState"`
+		NewScenarioState      string `json:"newScenarioState"`
+	}
+
+	// WireMockPattern is a WireMock value matcher. Only one of the
+	// operators is used
+	WireMockPattern struct {
+		EqualTo         *string         `json:"equalTo"`
+		Contains        *string         `json:"contains"`
+		Matches         *string         `json:"matches"`
+		CaseInsensitive bool            `json:"caseInsensitive"`
+		EqualToJSON     json.RawMessage `json:"equalToJson"`
+		MatchesJSONPath json.RawMessage `json:"matchesJsonPath"`
+		Absent          bool            `json:"absent"`
+	}
+)
+
+// wireMockDefaultPriority is the priority of mappings without one
+const wireMockDefaultPriority = 5
+
+// ParseWireMock parses a mapping file and translates the mappings to
+// routes, see WireMockRoutes
+func ParseWireMock(data []byte) ([]RouteRequest, []string, error) {
+	mappings, err := parseMappings(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return WireMockRoutes(mappings)
+}
+
+// parseMappings parses a mapping file, a single mapping or an object
+// with a mappings array
+func parseMappings(data []byte) ([]WireMockMapping, error) {
+	var file struct {
+		Mappings []WireMockMapping `json:"mappings"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Mappings == nil {
+		var m WireMockMapping
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		file.Mappings = []WireMockMapping{m}
+	}
+	return file.Mappings, nil
+}
+
+// WireMockRoutes translates mappings to routes ordered by priority.
+// Features mox has no equivalent for are left out, and reported as
+// warnings
+func WireMockRoutes(mappings []WireMockMapping) ([]RouteRequest, []string, error) {
+	sort.SliceStable(mappings, func(i, j int) bool {
+		return mappings[i].priority() < mappings[j].priority()
+	})
+	routes := make([]RouteRequest, 0, len(mappings))
+	var warnings []string
+	for i, m := range mappings {
+		r, w := m.Route()
+		name := m.ID
+		if len(name) == 0 {
+			name = m.UUID
+		}
+		if len(name) == 0 {
+			name = strconv.Itoa(i)
+		}
+		for _, x := range w {
+			warnings = append(warnings, "wiremock: mapping "+name+": "+x)
+		}
+		if _, err := r.BuildRoute(nil); err != nil {
+			return nil, warnings, fmt.Errorf("wiremock: mapping %s: %s", name, err)
+		}
+		routes = append(routes, r)
+	}
+	return routes, warnings, nil
+}
+
+func (m WireMockMapping) priority() int {
+	if m.Priority == 0 {
+		return wireMockDefaultPriority
+	}
+	return m.Priority
+}
+
+// Route translates the mapping to a route, and returns the features
+// that could not be translated
+func (m WireMockMapping) Route() (RouteRequest, []string) {
+	var r RouteRequest
+	var warnings []string
+	unsupported := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	if len(m.ID) > 0 {
+		r.ID = m.ID
+	} else {
+		r.ID = m.UUID
+	}
+	if m.Request.Method != "ANY" {
+		r.Method = m.Request.Method
+	}
+	req := m.Request
+	switch {
+	case len(req.URL) > 0:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			unsupported("url: %s", err)
+			break
+		}
+		r.Path = u.Path
+		query := u.Query()
+		keys := make([]string, 0, len(query))
+		for k := range query {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range query[k] {
+				r.Queries = append(r.Queries, Pair{Key: k, Value: templateLiteral(v, len(r.Queries))})
+			}
+		}
+	case len(req.URLPath) > 0:
+		r.Path = req.URLPath
+	case len(req.URLPathPattern) > 0:
+		r.Path = pathPattern(req.URLPathPattern)
+	case len(req.URLPattern) > 0:
+		if strings.Contains(req.URLPattern, "?") {
+			unsupported("urlPattern with a query is matched on the path only")
+			req.URLPattern = req.URLPattern[:strings.Index(req.URLPattern, "?")]
+		}
+		r.Path = pathPattern(req.URLPattern)
+	default:
+		r.Path = "/{path:.*}"
+	}
+	for _, k := range sortedPatternKeys(req.Headers) {
+		if re, ok := req.Headers[k].regex(); ok {
+			r.Headers = append(r.Headers, Pair{Key: k, Value: re})
+		} else {
+			unsupported("header %s: unsupported matcher", k)
+		}
+	}
+	for _, k := range sortedPatternKeys(req.QueryParameters) {
+		p := req.QueryParameters[k]
+		if p.EqualTo != nil && !p.CaseInsensitive {
+			r.Queries = append(r.Queries, Pair{Key: k, Value: templateLiteral(*p.EqualTo, len(r.Queries))})
+		} else if re, ok := p.valueRegex(); ok {
+			r.Queries = append(r.Queries, Pair{Key: k, Value: fmt.Sprintf("{q%d:%s}", len(r.Queries), re)})
+		} else {
+			unsupported("query parameter %s: unsupported matcher", k)
+		}
+	}
+	for _, p := range req.BodyPatterns {
+		if !r.bodyPattern(p) {
+			unsupported("unsupported body pattern")
+		}
+	}
+	rsp := m.Response
+	r.Return.Status = rsp.Status
+	if r.Return.Status == 0 {
+		r.Return.Status = http.StatusOK
+	}
+	keys := make([]string, 0, len(rsp.Headers))
+	for k := range rsp.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var values []string
+		var value string
+		if err := json.Unmarshal(rsp.Headers[k], &value); err == nil {
+			values = []string{value}
+		} else if err := json.Unmarshal(rsp.Headers[k], &values); err != nil {
+			unsupported("response header %s: %s", k, err)
+		}
+		for _, v := range values {
+			r.Return.Headers = append(r.Return.Headers, Pair{Key: k, Value: v})
+		}
+	}
+	switch {
+	case len(rsp.BodyFileName) > 0:
+		r.Return.BodyFile = rsp.BodyFileName
+	case len(rsp.Base64Body) > 0:
+		body, err := base64.StdEncoding.DecodeString(rsp.Base64Body)
+		if err != nil {
+			unsupported("base64Body: %s", err)
+		}
+		r.Return.Body = string(body)
+	case len(rsp.JSONBody) > 0:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, rsp.JSONBody, "", "  "); err != nil {
+			unsupported("jsonBody: %s", err)
+		}
+		r.Return.Body = buf.String()
+	default:
+		r.Return.Body = rsp.Body
+	}
+	if rsp.FixedDelayMilliseconds > 0 {
+		r.Return.Delay = strconv.Itoa(rsp.FixedDelayMilliseconds) + "ms"
+	}
+	for _, t := range rsp.Transformers {
+		if t == "response-template" {
+			unsupported("response templates are Handlebars, the body is returned as is")
+		} else {
+			unsupported("transformer %s", t)
+		}
+	}
+	if len(rsp.Fault) > 0 {
+		unsupported("fault %s", rsp.Fault)
+	}
+	if len(rsp.ProxyBaseURL) > 0 {
+		unsupported("proxyBaseUrl, use -forward instead")
+	}
+	if len(m.ScenarioName) > 0 {
+		r.Scenario = m.ScenarioName
+		r.RequiredState = m.RequiredScenarioState
+		r.NewState = m.NewScenarioState
+	}
+	return r, warnings
+}
+
+// bodyPattern adds a body pattern to the route, false if it cannot be
+// translated
+func (r *RouteRequest) bodyPattern(p WireMockPattern) bool {
+	body := BodyMatch{}
+	if r.Body != nil {
+		body = *r.Body
+	}
+	switch {
+	case p.EqualTo != nil && !p.CaseInsensitive && body.Equals == nil:
+		body.Equals = p.EqualTo
+	case p.Contains != nil && !p.CaseInsensitive && len(body.Contains) == 0:
+		body.Contains = *p.Contains
+	case (p.Matches != nil || p.EqualTo != nil || p.Contains != nil) && len(body.Regex) == 0:
+		body.Regex, _ = p.regex()
+	case len(p.EqualToJSON) > 0:
+		// Extra fields are allowed, like ignoreExtraElements
+		var value interface{}
+		if err := json.Unmarshal(p.EqualToJSON, &value); err != nil {
+			return false
+		}
+		if s, ok := value.(string); ok {
+			// equalToJson may be the JSON document as a string
+			value = json.RawMessage(s)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return false
+		}
+		if r.JSONBody == nil {
+			r.JSONBody = &JSONBodyMatch{}
+		}
+		r.JSONBody.Contains = data
+	case len(p.MatchesJSONPath) > 0:
+		var path string
+		if err := json.Unmarshal(p.MatchesJSONPath, &path); err != nil {
+			return false
+		}
+		if r.JSONBody == nil {
+			r.JSONBody = &JSONBodyMatch{}
+		}
+		r.JSONBody.Paths = append(r.JSONBody.Paths, JSONPathMatch{Path: path})
+	default:
+		return false
+	}
+	if body != (BodyMatch{}) {
+		r.Body = &body
+	}
+	return true
+}
+
+// valueRegex returns a regular expression for the whole value, to be
+// anchored by the caller, false if the pattern has no string operator
+func (p WireMockPattern) valueRegex() (string, bool) {
+	var re string
+	switch {
+	case p.EqualTo != nil:
+		re = regexp.QuoteMeta(*p.EqualTo)
+	case p.Contains != nil:
+		re = ".*" + regexp.QuoteMeta(*p.Contains) + ".*"
+	case p.Matches != nil:
+		re = "(?:" + *p.Matches + ")"
+	default:
+		return "", false
+	}
+	if p.CaseInsensitive {
+		re = "(?i)" + re
+	}
+	return re, true
+}
+
+// regex returns an anchored regular expression matching the whole
+// value, false if the pattern has no string operator
+func (p WireMockPattern) regex() (string, bool) {
+	re, ok := p.valueRegex()
+	if !ok {
+		return "", false
+	}
+	return "^(?s:" + re + ")$", true
+}
+
+// pathPattern returns a path template matching the whole path with a
+// regular expression
+func pathPattern(re string) string {
+	return "/{path:" + strings.TrimPrefix(re, "/") + "}"
+}
+
+// templateLiteral escapes a query value that would be taken for a
+// template variable, with a variable numbered n
+func templateLiteral(s string, n int) string {
+	if strings.ContainsAny(s, "{}") {
+		return fmt.Sprintf("{q%d:%s}", n, regexp.QuoteMeta(s))
+	}
+	return s
+}
+
+func sortedPatternKeys(m map[string]WireMockPattern) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReadWireMock reads the mappings of a WireMock root directory, from
+// its mappings directory, or from a directory of mapping files or a
+// single mapping file. The mappings of all files are ordered by
+// priority together
+func ReadWireMock(name string) ([]RouteRequest, []string, error) {
+	files := []string{name}
+	if info, err := os.Stat(name); err != nil {
+		return nil, nil, err
+	} else if info.IsDir() {
+		dir := name
+		if info, err := os.Stat(filepath.Join(name, "mappings")); err == nil && info.IsDir() {
+			dir = filepath.Join(name, "mappings")
+		}
+		if files, err = filepath.Glob(filepath.Join(dir, "*.json")); err != nil {
+			return nil, nil, err
+		}
+	}
+	var mappings []WireMockMapping
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err == nil {
+			var m []WireMockMapping
+			if m, err = parseMappings(data); err == nil {
+				mappings = append(mappings, m...)
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", f, err)
+		}
+	}
+	return WireMockRoutes(mappings)
+}
+
+// flagSet returns true if the flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// serveWireMock adds the routes of the posted WireMock mappings, and
+// returns them with the warnings
+func (h *AdminHandler) serveWireMock(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	reqs, warnings, err := ParseWireMock(data)
+	if err == nil {
+		h.M.Lock()
+		err = h.addRoutes(reqs)
+		h.M.Unlock()
+	}
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+	ret, _ := json.Marshal(struct {
+		Routes   []RouteRequest `json:"routes"`
+		Warnings []string       `json:"warnings"`
+	}{reqs, warnings})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(ret)
+}
+
+// runWireMock runs the wiremock command:
+//
+//	mox wiremock DIR|FILE
+//
+// It writes the routes translated from WireMock mappings to stdout,
+// and the features that could not be translated to stderr. Body files
+// are checked in the __files directory of DIR unless -files is given
+func runWireMock(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: mox wiremock DIR|FILE")
+		os.Exit(1)
+	}
+	if !flagSet("files") {
+		bodyFiles.Root = filepath.Join(args[0], "__files")
+	}
+	routes, warnings, err := ReadWireMock(args[0])
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	out, _ := json.MarshalIndent(routes, "", "    ")
+	fmt.Println(string(out))
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWireMock(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  string
+		method   string
+		path     string
+		queries  Pairs
+		headers  Pairs
+		body     string
+		delay    string
+		warnings int
+	}{
+		{name: "url with query",
+			mapping: `{"request": {"method": "GET", "url": "/u?b=2&a=1"}, "response": {"status": 200, "body": "ok"}}`,
+			method:  "GET", path: "/u", queries: Pairs{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}, body: "ok"},
+		{name: "any method",
+			mapping: `{"request": {"method": "ANY", "urlPath": "/p"}, "response": {"fixedDelayMilliseconds": 25}}`,
+			path:    "/p", delay: "25ms"},
+		{name: "path pattern",
+			mapping: `{"request": {"urlPathPattern": "/users/[0-9]+"}, "response": {"status": 204}}`,
+			path:    "/{path:users/[0-9]+}"},
+		{name: "no url",
+			mapping: `{"request": {}, "response": {}}`,
+			path:    "/{path:.*}"},
+		{name: "query matchers",
+			mapping: `{"request": {"urlPath": "/q", "queryParameters": {"x": {"equalTo": "1"}, "y": {"matches": "a|b"}}}, "response": {}}`,
+			path:    "/q", queries: Pairs{{Key: "x", Value: "1"}, {Key: "y", Value: "{q1:(?:a|b)}"}}},
+		{name: "response headers and json body",
+			mapping: `{"request": {"urlPath": "/j"}, "response": {"headers": {"X-One": "1", "X-Many": ["a", "b"]}, "jsonBody": {"a": 1}}}`,
+			path:    "/j", headers: Pairs{{Key: "X-Many", Value: "a"}, {Key: "X-Many", Value: "b"}, {Key: "X-One", Value: "1"}}, body: "{\n  \"a\": 1\n}"},
+		{name: "base64 body",
+			mapping: `{"request": {"urlPath": "/b"}, "response": {"base64Body": "aGk="}}`,
+			path:    "/b", body: "hi"},
+		{name: "unsupported features",
+			mapping: `{"request": {"urlPattern": "/x/.+?y=1", "headers": {"X-A": {"absent": true}}}, "response": {"fault": "EMPTY_RESPONSE", "transformers": ["response-template"]}}`,
+			path:    "/{path:x/.+}", warnings: 4},
+	}
+	for _, x := range tests {
+		routes, warnings, err := ParseWireMock([]byte(x.mapping))
+		if err != nil {
+			t.Errorf("%s: %s", x.name, err)
+			continue
+		}
+		if len(routes) != 1 {
+			t.Errorf("%s: got %d routes", x.name, len(routes))
+			continue
+		}
+		r := routes[0]
+		if r.Method != x.method || r.Path != x.path || r.Return.Body != x.body || r.Return.Delay != x.delay ||
+			!reflect.DeepEqual(r.Queries, x.queries) || !reflect.DeepEqual(r.Return.Headers, x.headers) {
+			t.Errorf("%s: got %+v", x.name, r)
+		}
+		if len(warnings) != x.warnings {
+			t.Errorf("%s: got warnings %v", x.name, warnings)
+		}
+	}
+}
+
+func TestParseWireMockMappings(t *testing.T) {
+	routes, _, err := ParseWireMock([]byte(`{"mappings": [
+	  {"id": "low", "priority": 9, "request": {"urlPath": "/a"}, "response": {}},
+	  {"id": "default", "request": {"urlPath": "/b"}, "response": {}},
+	  {"id": "high", "priority": 1, "request": {"urlPath": "/c"}, "response": {},
+	   "scenarioName": "s", "requiredScenarioState": "Started", "newScenarioState": "done"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.ID)
+	}
+	if strings.Join(ids, " ") != "high default low" {
+		t.Errorf("got %v, expected the mappings by priority", ids)
+	}
+	if r := routes[0]; r.Scenario != "s" || r.RequiredState != "Started" || r.NewState != "done" {
+		t.Errorf("scenario: %+v", r)
+	}
+	if _, _, err := ParseWireMock([]byte(`{"request": {"urlPath": "/x", "headers": {"X-A": {"matches": "("}}}}`)); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+	if _, _, err := ParseWireMock([]byte(`[`)); err == nil {
+		t.Errorf("expected an error for invalid JSON")
+	}
+}
+
+func TestWireMockBodyPatterns(t *testing.T) {
+	routes, warnings, err := ParseWireMock([]byte(`{"request": {"urlPath": "/b", "bodyPatterns": [
+	  {"contains": "x"},
+	  {"equalToJson": "{\"a\": 1}"},
+	  {"matchesJsonPath": "$.id"},
+	  {"absent": true}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := routes[0]
+	if r.Body == nil || r.Body.Contains != "x" {
+		t.Errorf("body: %+v", r.Body)
+	}
+	if r.JSONBody == nil || string(r.JSONBody.Contains) != `{"a":1}` || len(r.JSONBody.Paths) != 1 || r.JSONBody.Paths[0].Path != "$.id" {
+		t.Errorf("json body: %+v", r.JSONBody)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %v", warnings)
+	}
+}
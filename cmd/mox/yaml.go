@@ -0,0 +1,579 @@
+// Copyright 2017 Burak Serdar
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlParser parses the subset of YAML used for stub files: block
+// mappings and sequences, plain and quoted scalars, literal and folded
+// block scalars, flow collections and comments. Anchors, aliases and
+// tags are not supported
+type yamlParser struct {
+	lines []string
+	// first is the line number of the first line, for errors
+	first int
+	i     int
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// isYAML returns true if the file name has a YAML extension
+func isYAML(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// isYAMLType returns true for YAML content types
+func isYAMLType(contentType string) bool {
+	t, _, _ := mime.ParseMediaType(contentType)
+	switch t {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// YAMLToJSON converts a YAML stream to JSON. A stream of several
+// documents gives a JSON array of the routes in all of them
+func YAMLToJSON(data []byte) ([]byte, error) {
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	var docs []interface{}
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && !isDocumentMarker(lines[i]) {
+			continue
+		}
+		p := &yamlParser{lines: lines[start:i], first: start + 1}
+		doc, err := p.document()
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+		start = i + 1
+	}
+	if len(docs) == 1 {
+		return json.Marshal(docs[0])
+	}
+	var all []interface{}
+	for _, doc := range docs {
+		if items, ok := doc.([]interface{}); ok {
+			all = append(all, items...)
+		} else {
+			all = append(all, doc)
+		}
+	}
+	return json.Marshal(all)
+}
+
+func isDocumentMarker(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	return line == "---" || line == "..." || strings.HasPrefix(line, "--- ")
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %s", p.first+p.i, fmt.Sprintf(format, args...))
+}
+
+// document parses the lines of a document, nil if it is empty
+func (p *yamlParser) document() (interface{}, error) {
+	ind, ok := p.next()
+	if !ok {
+		return nil, nil
+	}
+	v, err := p.node(ind)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.next(); ok {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+// next skips blank and comment lines, and returns the indentation of
+// the next line
+func (p *yamlParser) next() (int, bool) {
+	for ; p.i < len(p.lines); p.i++ {
+		if len(p.content()) > 0 {
+			return indentation(p.lines[p.i]), true
+		}
+	}
+	return 0, false
+}
+
+// content returns the current line without indentation and comment
+func (p *yamlParser) content() string {
+	return stripComment(strings.TrimSpace(p.lines[p.i]))
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// stripComment removes a comment outside quotes
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t[{,:-", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return s
+}
+
+func isSeqItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+// node parses the node starting at the current line, whose
+// indentation is at least ind. It is null if the line is less
+// indented
+func (p *yamlParser) node(ind int) (interface{}, error) {
+	at, ok := p.next()
+	if !ok || at < ind {
+		return nil, nil
+	}
+	if strings.HasPrefix(p.lines[p.i], "\t") {
+		return nil, p.errorf("tabs are not allowed in indentation")
+	}
+	s := p.content()
+	if isSeqItem(s) {
+		return p.sequence(at)
+	}
+	if _, _, ok := splitKey(s); ok {
+		return p.mapping(at)
+	}
+	p.i++
+	return p.value(s, at-1)
+}
+
+// sequence parses the items at indentation ind
+func (p *yamlParser) sequence(ind int) (interface{}, error) {
+	ret := []interface{}{}
+	for {
+		at, ok := p.next()
+		if !ok || at != ind || !isSeqItem(p.content()) {
+			if ok && at > ind {
+				return nil, p.errorf("unexpected indentation")
+			}
+			return ret, nil
+		}
+		s := p.content()
+		rest := strings.TrimLeft(s[1:], " ")
+		var item interface{}
+		var err error
+		if len(rest) == 0 {
+			p.i++
+			item, err = p.node(ind + 1)
+		} else if _, _, isKey := splitKey(rest); isKey || isSeqItem(rest) {
+			// The item is a collection starting on the same line.
+			// Parse it as if it started on the next line
+			col := ind + len(s) - len(rest)
+			p.lines[p.i] = strings.Repeat(" ", col) + rest
+			item, err = p.node(col)
+		} else {
+			p.i++
+			item, err = p.value(rest, ind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+}
+
+// mapping parses the keys at indentation ind
+func (p *yamlParser) mapping(ind int) (interface{}, error) {
+	ret := map[string]interface{}{}
+	for {
+		at, ok := p.next()
+		if !ok || at < ind || (at == ind && isSeqItem(p.content())) {
+			return ret, nil
+		}
+		if at > ind {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, ok := splitKey(p.content())
+		if !ok {
+			return nil, p.errorf("expecting key: value")
+		}
+		p.i++
+		var v interface{}
+		var err error
+		if len(rest) > 0 {
+			v, err = p.value(rest, ind)
+		} else if at, ok := p.next(); ok && at == ind && isSeqItem(p.content()) {
+			v, err = p.sequence(ind)
+		} else {
+			v, err = p.node(ind + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret[key] = v
+	}
+}
+
+// splitKey splits a mapping line into the key and the value
+func splitKey(s string) (string, string, bool) {
+	if len(s) == 0 || strings.ContainsRune("[{&*!|>%@`", rune(s[0])) || isSeqItem(s) {
+		return "", "", false
+	}
+	var key string
+	var rest string
+	if s[0] == '"' || s[0] == '\'' {
+		end := quotedEnd(s)
+		if end < 0 {
+			return "", "", false
+		}
+		k, err := unquote(s[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		key, rest = k, strings.TrimLeft(s[end+1:], " ")
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.Index(s, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(s, ":") {
+				return "", "", false
+			}
+			i = len(s) - 1
+		}
+		key, rest = strings.TrimSpace(s[:i]), s[i+1:]
+	}
+	if len(rest) > 0 && rest[0] != ' ' {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(rest), true
+}
+
+// quotedEnd returns the index of the closing quote of the quoted
+// string at the start of s, -1 if there is none
+func quotedEnd(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// unquote decodes a single or double quoted string
+func unquote(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	return strconv.Unquote(s)
+}
+
+// value parses the value s of a mapping key or sequence item whose
+// parent has indentation parent. Block scalars and flow collections
+// continue on the following lines
+func (p *yamlParser) value(s string, parent int) (interface{}, error) {
+	switch s[0] {
+	case '|', '>':
+		return p.blockScalar(s, parent)
+	case '[', '{':
+		for !flowClosed(s) {
+			if p.i >= len(p.lines) {
+				return nil, p.errorf("unterminated flow collection")
+			}
+			s += " " + p.content()
+			p.i++
+		}
+		f := &flowParser{s: s}
+		v, err := f.value()
+		if err == nil {
+			if f.skipSpace(); f.pos < len(f.s) {
+				err = fmt.Errorf("unexpected %q", f.s[f.pos:])
+			}
+		}
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		return v, nil
+	case '"', '\'':
+		if quotedEnd(s) != len(s)-1 {
+			return nil, p.errorf("invalid quoted string: %s", s)
+		}
+		v, err := unquote(s)
+		if err != nil {
+			return nil, p.errorf("invalid quoted string: %s", s)
+		}
+		return v, nil
+	case '&', '*', '!':
+		return nil, p.errorf("anchors, aliases and tags are not supported")
+	}
+	return plainScalar(s), nil
+}
+
+// flowClosed returns true if the brackets of s are balanced
+func flowClosed(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if end := quotedEnd(s[i:]); end > 0 {
+				i += end
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// blockScalar parses a literal (|) or folded (>) block scalar with the
+// header h. The lines of the scalar are indented more than parent
+func (p *yamlParser) blockScalar(h string, parent int) (interface{}, error) {
+	chomp := byte(0)
+	ind := -1
+	for _, c := range h[1:] {
+		switch {
+		case c == '-' || c == '+':
+			chomp = byte(c)
+		case c >= '1' && c <= '9':
+			ind = parent + 1 + int(c-'1')
+		default:
+			return nil, p.errorf("invalid block scalar header: %s", h)
+		}
+	}
+	var lines []string
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if len(strings.TrimSpace(line)) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		at := indentation(line)
+		if ind < 0 {
+			if at <= parent {
+				break
+			}
+			ind = at
+		}
+		if at < ind {
+			break
+		}
+		lines = append(lines, line[ind:])
+	}
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	var text string
+	if h[0] == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		text = fold(lines)
+	}
+	switch {
+	case len(lines) == 0 && chomp != '+':
+		return "", nil
+	case chomp == '-':
+		return text, nil
+	case chomp == '+':
+		return text + "\n" + strings.Repeat("\n", trailing), nil
+	}
+	return text + "\n", nil
+}
+
+// fold joins the lines of a folded scalar. Line breaks between text
+// lines become spaces, and empty and more indented lines keep theirs
+func fold(lines []string) string {
+	var b bytes.Buffer
+	for i, line := range lines {
+		switch {
+		case i == 0:
+		case line == "":
+			b.WriteByte('\n')
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(lines[i-1], " "):
+			b.WriteByte('\n')
+		case lines[i-1] != "":
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// plainScalar resolves an unquoted scalar to null, a boolean, a
+// number or a string
+func plainScalar(s string) interface{} {
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlInt.MatchString(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	}
+	if yamlFloat.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// flowParser parses flow collections like [a, b] and {a: 1}
+type flowParser struct {
+	s   string
+	pos int
+}
+
+func (f *flowParser) skipSpace() {
+	for f.pos < len(f.s) && (f.s[f.pos] == ' ' || f.s[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *flowParser) value() (interface{}, error) {
+	f.skipSpace()
+	if f.pos >= len(f.s) {
+		return nil, fmt.Errorf("unexpected end of flow collection")
+	}
+	switch f.s[f.pos] {
+	case '[':
+		f.pos++
+		ret := []interface{}{}
+		for {
+			if f.skipSpace(); f.pos < len(f.s) && f.s[f.pos] == ']' {
+				f.pos++
+				return ret, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.pos++
+		ret := map[string]interface{}{}
+		for {
+			if f.skipSpace(); f.pos < len(f.s) && f.s[f.pos] == '}' {
+				f.pos++
+				return ret, nil
+			}
+			k, err := f.scalar(true)
+			if err != nil {
+				return nil, err
+			}
+			f.skipSpace()
+			if f.pos >= len(f.s) || f.s[f.pos] != ':' {
+				return nil, fmt.Errorf("expecting : after %v", k)
+			}
+			f.pos++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			ret[fmt.Sprint(k)] = v
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f.scalar(false)
+}
+
+// separator consumes a comma, and leaves the closing bracket
+func (f *flowParser) separator(end byte) error {
+	f.skipSpace()
+	if f.pos < len(f.s) && f.s[f.pos] == ',' {
+		f.pos++
+		return nil
+	}
+	if f.pos < len(f.s) && f.s[f.pos] == end {
+		return nil
+	}
+	return fmt.Errorf("expecting , or %c", end)
+}
+
+// scalar parses a quoted or plain scalar in a flow collection
+func (f *flowParser) scalar(key bool) (interface{}, error) {
+	f.skipSpace()
+	if c := f.s[f.pos]; c == '"' || c == '\'' {
+		end := quotedEnd(f.s[f.pos:])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		s, err := unquote(f.s[f.pos : f.pos+end+1])
+		f.pos += end + 1
+		return s, err
+	}
+	start := f.pos
+	for ; f.pos < len(f.s); f.pos++ {
+		c := f.s[f.pos]
+		if c == ',' || c == ']' || c == '}' {
+			break
+		}
+		if c == ':' && (key || f.pos+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.pos+1]) >= 0) {
+			break
+		}
+	}
+	s := strings.TrimSpace(f.s[start:f.pos])
+	if key {
+		return s, nil
+	}
+	return plainScalar(s), nil
+}